@@ -1,9 +1,19 @@
 package client
 
-import "github.com/cutlery47/key-value-storage/client/internal/client"
+import (
+	"log"
+
+	"github.com/cutlery47/key-value-storage/client/internal/client"
+)
 
 func Run() {
-	cl := client.NewHTTP()
-	app := client.New(cl)
+	grpcClient, err := client.NewGRPC()
+	if err != nil {
+		log.Fatal("couldn't configure grpc client: ", err)
+	}
+	defer grpcClient.Close()
+
+	app := client.New("http", client.NewHTTP())
+	app.Register("grpc", grpcClient)
 	app.Run()
 }
@@ -1,12 +1,18 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,6 +22,58 @@ type Client interface {
 	Set(key, value string, ttl time.Duration) error
 	Get(key string) (string, error)
 	Del(key string) error
+	Txn(txn Txn) error
+	MGet(keys []string) ([]Result, error)
+	MSet(entries []KeyValue, ttl time.Duration) ([]Result, error)
+	MDel(keys []string) ([]Result, error)
+	Incr(key string, by int64, ttl time.Duration) (int64, error)
+	IncrFloat(key string, by float64, ttl time.Duration) (float64, error)
+	ZAdd(key string, members []ZMember, ttl time.Duration) (int, error)
+	ZRem(key string, members []string) (int, error)
+	ZScore(key, member string) (float64, error)
+	ZRank(key, member string, reverse bool) (int, error)
+	ZRange(key string, start, stop int, reverse bool) ([]ZMember, error)
+	ZRangeByScore(key string, min, max float64, reverse bool, limit int) ([]ZMember, error)
+	Watch(ctx context.Context, key string, prefix bool, fromRevision uint64) (<-chan Event, error)
+	Publish(channel, message string) (int, error)
+	Subscribe(ctx context.Context, channels, patterns []string) (<-chan Message, error)
+}
+
+// max amount of operations, sent in a single batch request
+const batchChunk = 1000
+
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// outcome of a single batch operation
+type Result struct {
+	Key string
+	// entry, as returned by Get (MGet only)
+	Value string
+	Err   error
+}
+
+// operations, applied atomically, only if every condition holds
+type Txn struct {
+	Conditions []TxnCondition
+	Ops        []TxnOp
+}
+
+// expected version of an entry before the transaction
+// zero version means the entry should not exist
+type TxnCondition struct {
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+// op is one of: add, set, del
+type TxnOp struct {
+	Op    string
+	Key   string
+	Value string
+	TTL   time.Duration
 }
 
 // client implementation over HTTP
@@ -83,7 +141,186 @@ func (c *HTTPClient) Del(key string) error {
 	return err
 }
 
+// atomically adds by to the integer value of the key and returns the result
+// missing key is created, ttl is only applied in that case
+func (c *HTTPClient) Incr(key string, by int64, ttl time.Duration) (int64, error) {
+	res, err := c.incr("http://localhost:8080/api/v1/incr", key, strconv.FormatInt(by, 10), ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(res, 10, 64)
+}
+
+// same as Incr, but for floating point values
+func (c *HTTPClient) IncrFloat(key string, by float64, ttl time.Duration) (float64, error) {
+	res, err := c.incr("http://localhost:8080/api/v1/incrbyfloat", key, strconv.FormatFloat(by, 'f', -1, 64), ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(res, 64)
+}
+
+func (c *HTTPClient) incr(endpoint, key, by string, ttl time.Duration) (string, error) {
+	form := url.Values{}
+	form.Add("key", key)
+	form.Add("by", by)
+	if ttl != 0 {
+		form.Add("expires_at", time.Now().Add(ttl).Format(time.RFC3339))
+	}
+
+	res, err := c.http.PostForm(endpoint, form)
+	if err != nil {
+		return "", err
+	}
+
+	return c.handleResponse(res)
+}
+
+func (c *HTTPClient) Txn(txn Txn) error {
+	type txnOp struct {
+		Op        string `json:"op"`
+		Key       string `json:"key"`
+		Value     string `json:"value"`
+		ExpiresAt string `json:"expires_at,omitempty"`
+	}
+
+	body := struct {
+		Conditions []TxnCondition `json:"conditions"`
+		Ops        []txnOp        `json:"ops"`
+	}{
+		Conditions: txn.Conditions,
+		Ops:        []txnOp{},
+	}
+
+	for _, op := range txn.Ops {
+		var expirationTime string
+		if op.TTL != 0 {
+			expirationTime = time.Now().Add(op.TTL).Format(time.RFC3339)
+		}
+
+		body.Ops = append(body.Ops, txnOp{Op: op.Op, Key: op.Key, Value: op.Value, ExpiresAt: expirationTime})
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/api/v1/txn", bytes.NewReader(jsonBody))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.handleResponse(res)
+
+	return err
+}
+
+func (c *HTTPClient) MGet(keys []string) ([]Result, error) {
+	ops := []batchOp{}
+	for _, key := range keys {
+		ops = append(ops, batchOp{Op: "get", Key: key})
+	}
+
+	return c.batch(ops)
+}
+
+// creates missing keys and overwrites existing ones
+func (c *HTTPClient) MSet(entries []KeyValue, ttl time.Duration) ([]Result, error) {
+	var expirationTime string
+	if ttl != 0 {
+		expirationTime = time.Now().Add(ttl).Format(time.RFC3339)
+	}
+
+	ops := []batchOp{}
+	for _, entry := range entries {
+		ops = append(ops, batchOp{Op: "put", Key: entry.Key, Value: entry.Value, ExpiresAt: expirationTime})
+	}
+
+	return c.batch(ops)
+}
+
+func (c *HTTPClient) MDel(keys []string) ([]Result, error) {
+	ops := []batchOp{}
+	for _, key := range keys {
+		ops = append(ops, batchOp{Op: "del", Key: key})
+	}
+
+	return c.batch(ops)
+}
+
+type batchOp struct {
+	Op        string `json:"op"`
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// sends operations in chunks of batchChunk
+// results are returned in the order of operations
+func (c *HTTPClient) batch(ops []batchOp) ([]Result, error) {
+	results := []Result{}
+
+	for len(ops) > 0 {
+		chunk := ops[:min(len(ops), batchChunk)]
+		ops = ops[len(chunk):]
+
+		jsonBody, err := json.Marshal(chunk)
+		if err != nil {
+			return results, err
+		}
+
+		req, err := http.NewRequest("POST", "http://localhost:8080/api/v1/batch", bytes.NewReader(jsonBody))
+		if err != nil {
+			return results, err
+		}
+
+		req.Header.Add("Content-Type", "application/json")
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			return results, err
+		}
+
+		msg, err := c.handleResponse(res)
+		if err != nil {
+			return results, err
+		}
+
+		var items []struct {
+			Key    string          `json:"key"`
+			Status int             `json:"status"`
+			Entry  json.RawMessage `json:"entry"`
+			Error  string          `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(msg), &items); err != nil {
+			return results, err
+		}
+
+		for _, item := range items {
+			result := Result{Key: item.Key, Value: string(item.Entry)}
+			if item.Status != http.StatusOK {
+				result.Err = errors.New(item.Error)
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
 func (c *HTTPClient) handleResponse(res *http.Response) (msg string, err error) {
+	defer res.Body.Close()
+
 	// read response body
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -141,28 +378,46 @@ func (c *HTTPClient) createGetDelRequest(method, url, key string) (*http.Request
 	return req, nil
 }
 
-// aggregate over client and parser
+// aggregate over clients and parser
 type ClientApp struct {
-	cl Client
-	p  Parser
+	// clients by their transport names
+	clients map[string]Client
+	cl      Client
+	p       Parser
 }
 
-func New(client Client) *ClientApp {
+// first client is used by default, if no transport is provided
+func New(transport string, client Client) *ClientApp {
 	return &ClientApp{
-		cl: client,
-		p:  Parser{},
+		clients: map[string]Client{transport: client},
+		cl:      client,
+		p:       Parser{},
 	}
 }
 
+// adds a client, which can be chosen with the -transport flag
+func (app *ClientApp) Register(transport string, client Client) {
+	app.clients[transport] = client
+}
+
 // run the entire client app
 func (app ClientApp) Run() {
 	// receiving user input
-	op, key, val, ttl, err := app.p.Parse()
+	op, key, val, ttl, transport, err := app.p.Parse()
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
+	if *transport != "" {
+		cl, ok := app.clients[*transport]
+		if !ok {
+			fmt.Println("Error:", ErrTransportUnsupported)
+			return
+		}
+		app.cl = cl
+	}
+
 	var res string
 
 	// mapping operation to its corresponding handler
@@ -175,6 +430,52 @@ func (app ClientApp) Run() {
 		res, err = app.cl.Get(*key)
 	case "del":
 		err = app.cl.Del(*key)
+	case "incr", "decr", "incrby":
+		// amount is passed in -val, 1 by default
+		by := int64(1)
+		if *val != "" {
+			if by, err = strconv.ParseInt(*val, 10, 64); err != nil {
+				err = ErrNotNumber
+				break
+			}
+		}
+		if *op == "decr" {
+			by = -by
+		}
+
+		var n int64
+		if n, err = app.cl.Incr(*key, by, *ttl); err == nil {
+			res = strconv.FormatInt(n, 10)
+		}
+	case "incrbyfloat":
+		var by, f float64
+		if by, err = strconv.ParseFloat(*val, 64); err != nil {
+			err = ErrNotNumber
+			break
+		}
+
+		if f, err = app.cl.IncrFloat(*key, by, *ttl); err == nil {
+			res = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	case "publish":
+		// channel is passed in -key, message in -val
+		var n int
+		if n, err = app.cl.Publish(*key, *val); err == nil {
+			res = strconv.Itoa(n)
+		}
+	case "subscribe", "psubscribe":
+		// channel (or pattern) is passed in -key, messages are printed until interrupted
+		var channels, patterns []string
+		if *op == "subscribe" {
+			channels = []string{*key}
+		} else {
+			patterns = []string{*key}
+		}
+
+		err = app.subscribe(channels, patterns)
+		if err == nil {
+			return
+		}
 	default:
 		err = ErrOpUnsupported
 	}
@@ -190,14 +491,38 @@ func (app ClientApp) Run() {
 	}
 }
 
+// prints messages of the channels, until interrupted
+func (app ClientApp) subscribe(channels, patterns []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	messages, err := app.cl.Subscribe(ctx, channels, patterns)
+	if err != nil {
+		return err
+	}
+
+	for msg := range messages {
+		if msg.Err != nil {
+			return msg.Err
+		}
+		if msg.Dropped != 0 {
+			fmt.Printf("(%d messages dropped)\n", msg.Dropped)
+		}
+		fmt.Printf("%v: %v\n", msg.Channel, msg.Payload)
+	}
+
+	return nil
+}
+
 // incoming flag params parser
 type Parser struct{}
 
-func (p Parser) Parse() (op, key, val *string, ttl *time.Duration, err error) {
+func (p Parser) Parse() (op, key, val *string, ttl *time.Duration, transport *string, err error) {
 	op = flag.String("op", "", "operation to be executed")
 	key = flag.String("key", "", "key to be inserted")
 	val = flag.String("val", "", "value to be paired with the key")
 	ttl = flag.Duration("ttl", 0, "key's time to live in the object storage")
+	transport = flag.String("transport", "", "transport of the requests: http (default) or grpc")
 
 	flag.Parse()
 
@@ -209,5 +534,5 @@ func (p Parser) Parse() (op, key, val *string, ttl *time.Duration, err error) {
 		err = ErrOpNotProvided
 	}
 
-	return op, key, val, ttl, err
+	return op, key, val, ttl, transport, err
 }
@@ -0,0 +1,356 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/api/kvspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// client implementation over gRPC
+//
+// the gRPC API covers only key operations, batches and watches,
+// so the rest of the operations fail with ErrOpUnsupported
+type GRPCClient struct {
+	conn *grpc.ClientConn
+	kv   kvspb.KVClient
+}
+
+// connection is established on the first call
+func NewGRPC() (*GRPCClient, error) {
+	conn, err := grpc.NewClient("localhost:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCClient{
+		conn: conn,
+		kv:   kvspb.NewKVClient(conn),
+	}, nil
+}
+
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCClient) Add(key, value string, ttl time.Duration) error {
+	return c.put(key, value, ttl, kvspb.PutMode_PUT_MODE_CREATE)
+}
+
+func (c *GRPCClient) Set(key, value string, ttl time.Duration) error {
+	return c.put(key, value, ttl, kvspb.PutMode_PUT_MODE_UPDATE)
+}
+
+func (c *GRPCClient) put(key, value string, ttl time.Duration, mode kvspb.PutMode) error {
+	_, err := c.kv.Put(context.Background(), &kvspb.PutRequest{
+		Key:       key,
+		Value:     value,
+		ExpiresAt: expiration(ttl),
+		Mode:      mode,
+	})
+
+	return statusErr(err)
+}
+
+// returns the entry in the same JSON form, as the http client does
+func (c *GRPCClient) Get(key string) (string, error) {
+	res, err := c.kv.Get(context.Background(), &kvspb.GetRequest{Key: key})
+	if err != nil {
+		return "", statusErr(err)
+	}
+
+	return entryJSON(res.Entry)
+}
+
+func (c *GRPCClient) Del(key string) error {
+	_, err := c.kv.Delete(context.Background(), &kvspb.DeleteRequest{Key: key})
+
+	return statusErr(err)
+}
+
+func (c *GRPCClient) MGet(keys []string) ([]Result, error) {
+	ops := []*kvspb.BatchOp{}
+	for _, key := range keys {
+		ops = append(ops, &kvspb.BatchOp{Op: kvspb.BatchOpType_BATCH_OP_GET, Key: key})
+	}
+
+	return c.batch(ops)
+}
+
+// creates missing keys and overwrites existing ones
+func (c *GRPCClient) MSet(entries []KeyValue, ttl time.Duration) ([]Result, error) {
+	expiresAt := expiration(ttl)
+
+	ops := []*kvspb.BatchOp{}
+	for _, entry := range entries {
+		ops = append(ops, &kvspb.BatchOp{Op: kvspb.BatchOpType_BATCH_OP_PUT, Key: entry.Key, Value: entry.Value, ExpiresAt: expiresAt})
+	}
+
+	return c.batch(ops)
+}
+
+func (c *GRPCClient) MDel(keys []string) ([]Result, error) {
+	ops := []*kvspb.BatchOp{}
+	for _, key := range keys {
+		ops = append(ops, &kvspb.BatchOp{Op: kvspb.BatchOpType_BATCH_OP_DELETE, Key: key})
+	}
+
+	return c.batch(ops)
+}
+
+// sends operations in chunks of batchChunk
+// results are returned in the order of operations
+func (c *GRPCClient) batch(ops []*kvspb.BatchOp) ([]Result, error) {
+	results := []Result{}
+
+	for len(ops) > 0 {
+		chunk := ops[:min(len(ops), batchChunk)]
+		ops = ops[len(chunk):]
+
+		res, err := c.kv.Batch(context.Background(), &kvspb.BatchRequest{Ops: chunk})
+		if err != nil {
+			return results, statusErr(err)
+		}
+
+		for _, item := range res.Results {
+			result := Result{Key: item.Key}
+			if item.Entry != nil {
+				if result.Value, err = entryJSON(item.Entry); err != nil {
+					return results, err
+				}
+			}
+			if codes.Code(item.Code) != codes.OK {
+				result.Err = errors.New(item.Error)
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+func (c *GRPCClient) Txn(txn Txn) error {
+	return ErrOpUnsupported
+}
+
+func (c *GRPCClient) Incr(key string, by int64, ttl time.Duration) (int64, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) IncrFloat(key string, by float64, ttl time.Duration) (float64, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) ZAdd(key string, members []ZMember, ttl time.Duration) (int, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) ZRem(key string, members []string) (int, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) ZScore(key, member string) (float64, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) ZRank(key, member string, reverse bool) (int, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	return nil, ErrOpUnsupported
+}
+
+func (c *GRPCClient) ZRangeByScore(key string, min, max float64, reverse bool, limit int) ([]ZMember, error) {
+	return nil, ErrOpUnsupported
+}
+
+func (c *GRPCClient) Publish(channel, message string) (int, error) {
+	return 0, ErrOpUnsupported
+}
+
+func (c *GRPCClient) Subscribe(ctx context.Context, channels, patterns []string) (<-chan Message, error) {
+	return nil, ErrOpUnsupported
+}
+
+// watches the key or, if prefix is set, every key with such prefix
+// works the same way as the http watch: broken streams are reconnected,
+// resuming right after the last received event
+func (c *GRPCClient) Watch(ctx context.Context, key string, prefix bool, fromRevision uint64) (<-chan Event, error) {
+	req := &kvspb.WatchRequest{Key: key, Prefix: prefix, FromRevision: fromRevision}
+
+	stream, err := c.openWatch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, watchBuffer)
+
+	go func() {
+		defer close(events)
+
+		// revision of the last received event
+		last := stream.start
+
+		for {
+			last = c.readWatch(ctx, stream, last, events)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(watchRetry):
+				}
+
+				req.FromRevision = last + 1
+
+				stream, err = c.openWatch(ctx, req)
+				if err == nil {
+					break
+				}
+
+				var rejected watchRejected
+				if errors.As(err, &rejected) {
+					select {
+					case events <- Event{Err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// the same names, as in the http watch
+var eventTypes = map[kvspb.EventType]string{
+	kvspb.EventType_EVENT_TYPE_PUT:    "put",
+	kvspb.EventType_EVENT_TYPE_DELETE: "delete",
+	kvspb.EventType_EVENT_TYPE_EXPIRE: "expire",
+	kvspb.EventType_EVENT_TYPE_EVICT:  "evict",
+}
+
+type grpcWatch struct {
+	grpc.ServerStreamingClient[kvspb.WatchResponse]
+	// revision, after which events are delivered
+	start uint64
+}
+
+// opens the stream and waits for the server to accept the watch
+// errors, other than unavailability of the server, are reported as watchRejected
+func (c *GRPCClient) openWatch(ctx context.Context, req *kvspb.WatchRequest) (grpcWatch, error) {
+	stream, err := c.kv.Watch(ctx, req)
+	if err != nil {
+		return grpcWatch{}, err
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		if code := status.Code(err); code != codes.Unavailable && code != codes.Canceled {
+			return grpcWatch{}, watchRejected{msg: status.Convert(err).Message()}
+		}
+		return grpcWatch{}, err
+	}
+
+	return grpcWatch{ServerStreamingClient: stream, start: res.StartRevision}, nil
+}
+
+// delivers events of the stream, until it ends
+// returns the revision of the last received event
+func (c *GRPCClient) readWatch(ctx context.Context, stream grpcWatch, last uint64, events chan<- Event) uint64 {
+	for {
+		res, err := stream.Recv()
+		// server has stopped the watch, e.g. because the receiver doesn't keep up
+		if err != nil {
+			return last
+		}
+
+		if res.Event == nil {
+			continue
+		}
+
+		ev := res.Event
+		last = ev.Revision
+
+		received := Event{
+			Revision: ev.Revision,
+			Type:     eventTypes[ev.Type],
+			Key:      ev.Key,
+			At:       ev.At.AsTime(),
+		}
+		if ev.Entry != nil {
+			received.Value = ev.Entry.Data
+		}
+
+		select {
+		case events <- received:
+		case <-ctx.Done():
+			return last
+		}
+	}
+}
+
+// expiration time of an entry with the ttl, unset if there's no ttl
+func expiration(ttl time.Duration) *timestamppb.Timestamp {
+	if ttl == 0 {
+		return nil
+	}
+
+	return timestamppb.New(time.Now().Add(ttl))
+}
+
+// converts the status into an error with the same message, as the http client returns
+func statusErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return errors.New(st.Message())
+	}
+
+	return err
+}
+
+// entry in the form, it is encoded by the storage
+func entryJSON(entry *kvspb.Entry) (string, error) {
+	type value struct {
+		Data      string    `json:"data"`
+		Type      string    `json:"type,omitempty"`
+		UpdatedAt time.Time `json:"updated_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Version   uint64    `json:"version"`
+	}
+
+	encoded := struct {
+		Key   string `json:"key"`
+		Value value
+	}{
+		Key: entry.Key,
+		Value: value{
+			Data:      entry.Data,
+			Type:      entry.Type,
+			UpdatedAt: entry.UpdatedAt.AsTime(),
+			Version:   entry.Version,
+		},
+	}
+	if entry.ExpiresAt != nil {
+		encoded.Value.ExpiresAt = entry.ExpiresAt.AsTime()
+	}
+
+	raw, err := json.Marshal(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
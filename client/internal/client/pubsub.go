@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// message of a pub/sub channel
+type Message struct {
+	Channel string `json:"channel"`
+	// pattern, which the channel was matched by, empty for plain subscriptions
+	Pattern string    `json:"pattern"`
+	Payload string    `json:"payload"`
+	At      time.Time `json:"at"`
+	// amount of messages, lost before this one, because the receiver didn't keep up
+	Dropped uint64 `json:"-"`
+	// set on the last message, if the subscription has failed
+	Err error `json:"-"`
+}
+
+// sends the message to subscribers of the channel
+// returns the amount of subscriptions, which have received it
+func (c *HTTPClient) Publish(channel, message string) (int, error) {
+	form := url.Values{"channel": {channel}, "message": {message}}
+
+	res, err := c.http.PostForm("http://localhost:8080/api/v1/publish", form)
+	if err != nil {
+		return 0, err
+	}
+
+	msg, err := c.handleResponse(res)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(msg)
+}
+
+// subscribes to the channels and to every channel, matching one of the patterns (e.g. news.*)
+// messages are not kept by the server, so nothing is received while the subscription is broken
+// channel is closed once ctx is done or the subscription is over, the failure is reported by the last message
+func (c *HTTPClient) Subscribe(ctx context.Context, channels, patterns []string) (<-chan Message, error) {
+	query := url.Values{"channel": channels, "pattern": patterns}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost:8080/api/v1/subscribe?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		_, err := c.handleResponse(res)
+		return nil, err
+	}
+
+	messages := make(chan Message, watchBuffer)
+
+	go func() {
+		defer close(messages)
+		defer res.Body.Close()
+
+		var (
+			dropped uint64
+			failure error
+		)
+
+		readSSE(res.Body, func(sse sseEvent) bool {
+			switch sse.event {
+			case "dropped":
+				n, _ := strconv.ParseUint(sse.data, 10, 64)
+				dropped += n
+				return true
+			case "error":
+				failure = errors.New(sse.data)
+				return false
+			}
+
+			// comments and unknown events
+			if sse.event != "message" {
+				return true
+			}
+
+			var msg Message
+			if err := json.Unmarshal([]byte(sse.data), &msg); err != nil {
+				failure = err
+				return false
+			}
+			msg.Dropped, dropped = dropped, 0
+
+			select {
+			case messages <- msg:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+
+		if failure == nil && ctx.Err() == nil {
+			failure = ErrStreamClosed
+		}
+
+		if failure != nil {
+			select {
+			case messages <- Message{Err: failure}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return messages, nil
+}
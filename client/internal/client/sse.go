@@ -0,0 +1,56 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// event of a server-sent events stream
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// reads events of the stream, until it ends or handle returns false
+func readSSE(stream io.Reader, handle func(ev sseEvent) bool) {
+	rd := bufio.NewReader(stream)
+
+	var (
+		ev   sseEvent
+		data []string
+	)
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		// not a blank line - a field of the event or a comment
+		if line != "" {
+			name, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+
+			switch name {
+			case "id":
+				ev.id = value
+			case "event":
+				ev.event = value
+			case "data":
+				data = append(data, value)
+			}
+			continue
+		}
+
+		// blank line ends the event
+		ev.data = strings.Join(data, "\n")
+		if !handle(ev) {
+			return
+		}
+
+		ev, data = sseEvent{}, nil
+	}
+}
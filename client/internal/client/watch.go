@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// pause before a broken watch stream is reconnected
+	watchRetry = time.Second
+	// amount of events, buffered for the receiver
+	watchBuffer = 64
+)
+
+// change of a watched key
+type Event struct {
+	Revision uint64
+	// put, delete, expire or evict
+	Type string
+	Key  string
+	// written value, only for put events
+	Value string
+	At    time.Time
+	// set on the last event, if the watch has failed
+	Err error
+}
+
+// event, as it is sent by the server
+type watchEvent struct {
+	Revision uint64 `json:"revision"`
+	Type     string `json:"type"`
+	Key      string `json:"key"`
+	Value    *struct {
+		Data string `json:"data"`
+	} `json:"value"`
+	At time.Time `json:"at"`
+}
+
+// error, which the server has rejected the watch with
+type watchRejected struct {
+	msg string
+}
+
+func (e watchRejected) Error() string { return e.msg }
+
+// watches the key or, if prefix is set, every key with such prefix
+// events are delivered starting with fromRevision, zero one means only new changes
+//
+// broken streams are reconnected, resuming right after the last received event,
+// so no events are missed, unless the server doesn't keep them anymore
+// channel is closed once ctx is done or the watch fails, the failure is reported by the last event
+func (c *HTTPClient) Watch(ctx context.Context, key string, prefix bool, fromRevision uint64) (<-chan Event, error) {
+	stream, err := c.openWatch(ctx, key, prefix, fromRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, watchBuffer)
+
+	go func() {
+		defer close(events)
+
+		// revision of the last received event
+		var last uint64
+		if fromRevision != 0 {
+			last = fromRevision - 1
+		}
+
+		for {
+			last = c.readWatch(ctx, stream, last, events)
+			stream.Body.Close()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(watchRetry):
+				}
+
+				stream, err = c.openWatch(ctx, key, prefix, last+1)
+				if err == nil {
+					break
+				}
+
+				var rejected watchRejected
+				if errors.As(err, &rejected) {
+					select {
+					case events <- Event{Err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func (c *HTTPClient) openWatch(ctx context.Context, key string, prefix bool, fromRevision uint64) (*http.Response, error) {
+	query := url.Values{"key": {key}, "prefix": {strconv.FormatBool(prefix)}}
+	if fromRevision != 0 {
+		query.Set("rev", strconv.FormatUint(fromRevision, 10))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://localhost:8080/api/v1/watch?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := c.handleResponse(res)
+		return nil, watchRejected{msg: msg}
+	}
+
+	return res, nil
+}
+
+// delivers events of the stream, until it ends
+// returns the revision of the last received event
+func (c *HTTPClient) readWatch(ctx context.Context, stream *http.Response, last uint64, events chan<- Event) uint64 {
+	readSSE(stream.Body, func(sse sseEvent) bool {
+		if parsed, err := strconv.ParseUint(sse.id, 10, 64); err == nil {
+			last = parsed
+		}
+
+		// server has stopped the watch, e.g. because the receiver doesn't keep up
+		if sse.event == "error" {
+			return false
+		}
+
+		// event without data only moves the cursor
+		if sse.data == "" {
+			return true
+		}
+
+		var ev watchEvent
+		if err := json.Unmarshal([]byte(sse.data), &ev); err != nil {
+			return false
+		}
+
+		received := Event{Revision: ev.Revision, Type: ev.Type, Key: ev.Key, At: ev.At}
+		if ev.Value != nil {
+			received.Value = ev.Value.Data
+		}
+
+		select {
+		case events <- received:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+
+	return last
+}
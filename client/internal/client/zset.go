@@ -0,0 +1,128 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// member of a sorted set along with its score
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// adds members to the sorted set or updates their scores
+// ttl is only applied if the set gets created
+// returns the amount of added members
+func (c *HTTPClient) ZAdd(key string, members []ZMember, ttl time.Duration) (int, error) {
+	form := url.Values{}
+	form.Add("key", key)
+	for _, m := range members {
+		form.Add("member", m.Member)
+		form.Add("score", strconv.FormatFloat(m.Score, 'f', -1, 64))
+	}
+	if ttl != 0 {
+		form.Add("expires_at", time.Now().Add(ttl).Format(time.RFC3339))
+	}
+
+	res, err := c.http.PostForm("http://localhost:8080/api/v1/zset/add", form)
+	if err != nil {
+		return 0, err
+	}
+
+	msg, err := c.handleResponse(res)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(msg)
+}
+
+// returns the amount of removed members
+func (c *HTTPClient) ZRem(key string, members []string) (int, error) {
+	msg, err := c.zset("DELETE", "rem", url.Values{"key": {key}, "member": members})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(msg)
+}
+
+func (c *HTTPClient) ZScore(key, member string) (float64, error) {
+	msg, err := c.zset("GET", "score", url.Values{"key": {key}, "member": {member}})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(msg, 64)
+}
+
+// returns position of the member by ascending scores, or by descending ones if reverse is set
+func (c *HTTPClient) ZRank(key, member string, reverse bool) (int, error) {
+	msg, err := c.zset("GET", "rank", url.Values{"key": {key}, "member": {member}, "rev": {strconv.FormatBool(reverse)}})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(msg)
+}
+
+// returns members with ranks between start and stop, both inclusive
+// negative ranks count from the end, -1 being the last member
+func (c *HTTPClient) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	msg, err := c.zset("GET", "range", url.Values{
+		"key":   {key},
+		"start": {strconv.Itoa(start)},
+		"stop":  {strconv.Itoa(stop)},
+		"rev":   {strconv.FormatBool(reverse)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var members []ZMember
+	err = json.Unmarshal([]byte(msg), &members)
+
+	return members, err
+}
+
+// returns up to limit members with scores between min and max, both inclusive
+// zero limit means no limit
+func (c *HTTPClient) ZRangeByScore(key string, min, max float64, reverse bool, limit int) ([]ZMember, error) {
+	msg, err := c.zset("GET", "rangebyscore", url.Values{
+		"key":   {key},
+		"min":   {strconv.FormatFloat(min, 'f', -1, 64)},
+		"max":   {strconv.FormatFloat(max, 'f', -1, 64)},
+		"rev":   {strconv.FormatBool(reverse)},
+		"limit": {strconv.Itoa(limit)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var members []ZMember
+	err = json.Unmarshal([]byte(msg), &members)
+
+	return members, err
+}
+
+// sends a request with query params to one of the sorted set endpoints
+func (c *HTTPClient) zset(method, endpoint string, query url.Values) (string, error) {
+	req, err := http.NewRequest(method, "http://localhost:8080/api/v1/zset/"+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	msg, err := c.handleResponse(res)
+
+	return strings.TrimSpace(msg), err
+}
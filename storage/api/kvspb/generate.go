@@ -0,0 +1,4 @@
+// Package kvspb holds the gRPC API of the storage, generated from kvs.proto
+package kvspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kvs.proto
@@ -3,7 +3,11 @@ package storage
 import (
 	"log"
 
+	"github.com/cutlery47/key-value-storage/storage/internal/memcache"
+	"github.com/cutlery47/key-value-storage/storage/internal/pubsub"
+	"github.com/cutlery47/key-value-storage/storage/internal/resp"
 	"github.com/cutlery47/key-value-storage/storage/internal/router"
+	"github.com/cutlery47/key-value-storage/storage/internal/rpc"
 	"github.com/cutlery47/key-value-storage/storage/internal/service"
 	"github.com/cutlery47/key-value-storage/storage/internal/storage"
 	"github.com/cutlery47/key-value-storage/storage/logger"
@@ -11,7 +15,20 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func Run() {
+// values of the sync flag
+var syncPolicies = map[string]storage.SyncPolicy{
+	"always":   storage.SyncAlways,
+	"interval": storage.SyncInterval,
+	"never":    storage.SyncNever,
+}
+
+// protocol listener, running alongside the http server
+type listener interface {
+	Serve()
+	Close() error
+}
+
+func Run(conf Config) {
 	// request logger
 	reqLog, err := logger.NewJsonFile("logger/logs/requests.log", logrus.InfoLevel)
 	if err != nil {
@@ -19,7 +36,7 @@ func Run() {
 	}
 
 	// cleanup logger
-	_, err = logger.NewJsonFile("logger/logs/cleanup.log", logrus.InfoLevel)
+	cleanupLog, err := logger.NewJsonFile("logger/logs/cleanup.log", logrus.InfoLevel)
 	if err != nil {
 		log.Fatal("couldn't configure cleanup logger", err)
 	}
@@ -30,13 +47,61 @@ func Run() {
 		log.Fatal("couldn't configure error logger", err)
 	}
 
-	ls, err := storage.NewImprovedStorage("data", errLog)
+	syncPolicy, ok := syncPolicies[conf.SyncPolicy]
+	if !ok {
+		log.Fatal("unknown sync policy: ", conf.SyncPolicy)
+	}
+
+	spaces, err := storage.OpenNamespaces(conf.Engine, storage.EngineConfig{
+		Path:         conf.DataPath,
+		InfoLog:      cleanupLog,
+		ErrLog:       errLog,
+		SyncPolicy:   syncPolicy,
+		SyncInterval: conf.SyncInterval,
+	}, storage.NamespaceConfig{
+		DefaultTTL:     conf.DefaultTTL,
+		MaxMemory:      conf.MaxMemory,
+		EvictionPolicy: storage.EvictionPolicy(conf.EvictionPolicy),
+	})
 	if err != nil {
-		log.Fatal("storage.NewImprovedStorage: ", err)
+		log.Fatal("storage.OpenNamespaces: ", err)
+	}
+
+	slowPolicy := pubsub.SlowPolicy(conf.PubSubSlowPolicy)
+	if slowPolicy != pubsub.Drop && slowPolicy != pubsub.Disconnect {
+		log.Fatal("unknown pub/sub slow policy: ", conf.PubSubSlowPolicy)
 	}
-	se := service.New(ls)
+	broker := pubsub.New(pubsub.WithBuffer(conf.PubSubBuffer), pubsub.WithSlowPolicy(slowPolicy))
+
+	se := service.New(spaces, service.WithCounterTTL(conf.CounterTTL), service.WithBroker(broker), service.WithKeyspaceQueue(conf.KeyspaceQueue))
 	rt := router.New(se, reqLog, errLog)
-	serv := server.New(rt.Handler())
+	serv := server.New(rt.Handler(), server.WithAddr(conf.Addr), server.WithOnShutdown(rt.Close))
+
+	// protocol listeners run alongside the http server and are shut down right after it
+	var listeners []listener
+	if conf.RESPAddr != "" {
+		listeners = append(listeners, server.NewTCP("resp", conf.RESPAddr, resp.New(se, errLog)))
+	}
+	if conf.GRPCAddr != "" {
+		listeners = append(listeners, server.NewGRPC(conf.GRPCAddr, rpc.New(se, errLog)))
+	}
+	if conf.MemcacheAddr != "" {
+		listeners = append(listeners, server.NewTCP("memcache", conf.MemcacheAddr, memcache.New(se, errLog)))
+	}
+
+	for _, listener := range listeners {
+		go listener.Serve()
+	}
 
 	serv.Run()
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+
+	if err := spaces.Close(); err != nil {
+		log.Println("failed to close storage:", err)
+	}
+
+	se.Close()
 }
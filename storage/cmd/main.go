@@ -3,5 +3,5 @@ package main
 import storage "github.com/cutlery47/key-value-storage/storage"
 
 func main() {
-	storage.Run()
+	storage.Run(storage.ParseConfig())
 }
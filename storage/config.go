@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+const (
+	defaultEngine   = "snapshot"
+	defaultDataPath = "data"
+	defaultAddr     = "127.0.0.1:8080"
+	defaultTTL      = 24 * time.Hour
+
+	defaultPubSubBuffer     = 256
+	defaultPubSubSlowPolicy = "disconnect"
+	defaultKeyspaceQueue    = 4096
+
+	defaultSyncPolicy   = "interval"
+	defaultSyncInterval = time.Second
+)
+
+// storage app configuration
+type Config struct {
+	// name of the registered storage engine
+	Engine string
+	// path (or path prefix) of the engine's data files
+	DataPath string
+	// http server address
+	Addr string
+	// address of the Redis protocol listener, empty one disables it
+	RESPAddr string
+	// address of the gRPC listener, empty one disables it
+	GRPCAddr string
+	// address of the memcached protocol listener, empty one disables it
+	MemcacheAddr string
+	// ttl of entries in the default namespace, created without one
+	// zero means that such entries don't expire
+	DefaultTTL time.Duration
+	// ttl of counters, created by increments
+	// zero means that counters don't expire
+	CounterTTL time.Duration
+	// amount of pub/sub messages, buffered for each subscriber
+	PubSubBuffer int
+	// what happens to subscribers, whose buffer is full: drop or disconnect
+	PubSubSlowPolicy string
+	// amount of removals of keys, waiting to be published to the keyspace channels
+	KeyspaceQueue int
+	// approximate memory limit of the default namespace in bytes
+	// zero means no limit
+	MaxMemory int64
+	// which entries of the default namespace get evicted, once the memory limit is reached
+	// empty one means noeviction
+	EvictionPolicy string
+	// how often logs are fsynced: always, interval or never
+	SyncPolicy string
+	// fsync interval for the interval policy
+	SyncInterval time.Duration
+}
+
+// parses configuration from command line flags
+func ParseConfig() Config {
+	conf := Config{}
+
+	names := []string{}
+	for _, engine := range storage.Engines() {
+		names = append(names, engine.Name)
+	}
+
+	flag.StringVar(&conf.Engine, "engine", defaultEngine, "storage engine: "+strings.Join(names, ", "))
+	flag.StringVar(&conf.DataPath, "data", defaultDataPath, "path prefix of the data files")
+	flag.StringVar(&conf.Addr, "addr", defaultAddr, "http server address")
+	flag.StringVar(&conf.RESPAddr, "resp-addr", "", "address of the Redis protocol (RESP) listener, e.g. 127.0.0.1:6379 (empty - disabled)")
+	flag.StringVar(&conf.GRPCAddr, "grpc-addr", "", "address of the gRPC listener, e.g. 127.0.0.1:9090 (empty - disabled)")
+	flag.StringVar(&conf.MemcacheAddr, "memcache-addr", "", "address of the memcached text protocol listener, e.g. 127.0.0.1:11211 (empty - disabled)")
+	flag.DurationVar(&conf.DefaultTTL, "default-ttl", defaultTTL, "ttl of entries in the default namespace, created without one (0 - no expiration)")
+	flag.DurationVar(&conf.CounterTTL, "counter-ttl", 0, "ttl of counters, created by increments (0 - no expiration)")
+	flag.IntVar(&conf.PubSubBuffer, "pubsub-buffer", defaultPubSubBuffer, "amount of pub/sub messages, buffered for each subscriber")
+	flag.StringVar(&conf.PubSubSlowPolicy, "pubsub-slow", defaultPubSubSlowPolicy, "what happens to subscribers, whose buffer is full: drop (messages) or disconnect")
+	flag.IntVar(&conf.KeyspaceQueue, "keyspace-queue", defaultKeyspaceQueue, "amount of key removals, waiting to be published to the keyspace channels, further ones are dropped")
+	flag.Int64Var(&conf.MaxMemory, "max-memory", 0, "approximate memory limit of the default namespace in bytes (0 - no limit)")
+	flag.StringVar(&conf.EvictionPolicy, "eviction-policy", "", "eviction policy of the default namespace: noeviction (default), allkeys-lru, allkeys-lfu, volatile-lru or volatile-ttl")
+	flag.StringVar(&conf.SyncPolicy, "sync", defaultSyncPolicy, "how often logs are fsynced: always, interval or never")
+	flag.DurationVar(&conf.SyncInterval, "sync-interval", defaultSyncInterval, "fsync interval for the interval sync policy")
+	listEngines := flag.Bool("engines", false, "list available storage engines and exit")
+
+	flag.Parse()
+
+	if *listEngines {
+		for _, engine := range storage.Engines() {
+			fmt.Printf("%-10v %v\n\t%+v\n", engine.Name, engine.Description, engine.Capabilities)
+		}
+		os.Exit(0)
+	}
+
+	return conf
+}
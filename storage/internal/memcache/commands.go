@@ -0,0 +1,317 @@
+package memcache
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// exptime above this amount of seconds is an absolute unix time, as in memcached
+const maxRelativeExptime = 30 * 24 * 60 * 60
+
+// get <key>*
+// gets <key>*
+// missing keys and keys of collection types are skipped
+func (h *Handler) get(c *conn, args []string) error {
+	if len(args) < 2 {
+		return errBadFormat
+	}
+
+	for _, key := range args[1:] {
+		if len(key) > maxKeySize {
+			return errBadFormat
+		}
+	}
+
+	for _, key := range args[1:] {
+		entry, err := h.service.Read(key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.Value.Type != storage.TypeString {
+			continue
+		}
+
+		line := "VALUE " + key + " " + strconv.FormatUint(uint64(entry.Value.Flags), 10) + " " + strconv.Itoa(len(entry.Value.Data))
+		if args[0] == "gets" {
+			// version of the entry serves as the cas unique
+			line += " " + strconv.FormatUint(entry.Value.Version, 10)
+		}
+
+		c.w.WriteString(line + "\r\n" + entry.Value.Data + "\r\n")
+	}
+
+	c.w.WriteString("END\r\n")
+
+	return nil
+}
+
+// set <key> <flags> <exptime> <bytes> [noreply]
+// add, replace: the same as set
+// cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+//
+// the item gets exactly the provided exptime and flags, zero exptime means that it never expires
+func (h *Handler) store(c *conn, args []string) error {
+	if len(args) < 5 {
+		return errBadFormat
+	}
+
+	size, err := strconv.Atoi(args[4])
+	if err != nil || size < 0 {
+		return errBadFormat
+	}
+
+	argc := 5
+	if args[0] == "cas" {
+		argc = 6
+	}
+
+	var (
+		flags   uint64
+		exptime int64
+	)
+	valid := len(args) == argc && len(args[1]) <= maxKeySize
+	if valid {
+		flags, err = strconv.ParseUint(args[2], 10, 32)
+		if err == nil {
+			exptime, err = strconv.ParseInt(args[3], 10, 64)
+		}
+		valid = err == nil
+	}
+
+	// once the size is known, data is skipped, so that it's not taken for the next command
+	if !valid || size > maxValueSize {
+		if _, err := io.CopyN(io.Discard, c.r, int64(size)+2); err != nil {
+			c.quit = true
+			return nil
+		}
+		if !valid {
+			return errBadFormat
+		}
+		c.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+
+	data, err := c.readData(size)
+	if errors.As(err, new(clientError)) {
+		return err
+	}
+	// connection is broken
+	if err != nil {
+		c.quit = true
+		return nil
+	}
+
+	key, expiresAt := args[1], expiration(exptime)
+
+	switch args[0] {
+	case "set":
+		err = h.service.Write(key, data, expiresAt, uint32(flags), storage.PutOptions{})
+	case "add":
+		err = h.service.Write(key, data, expiresAt, uint32(flags), storage.PutOptions{OnlyNew: true})
+	case "replace":
+		err = h.service.Write(key, data, expiresAt, uint32(flags), storage.PutOptions{OnlyExisting: true})
+	case "cas":
+		return h.cas(c, key, data, expiresAt, uint32(flags), args[5])
+	}
+
+	if errors.Is(err, storage.ErrKeyAlreadyExists) || errors.Is(err, storage.ErrKeyNotFound) {
+		c.reply("NOT_STORED")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.reply("STORED")
+
+	return nil
+}
+
+func (h *Handler) cas(c *conn, key, data, expiresAt string, flags uint32, rawUnique string) error {
+	unique, err := strconv.ParseUint(rawUnique, 10, 64)
+	if err != nil {
+		return errBadFormat
+	}
+
+	// zero version would write the entry unconditionally
+	err = storage.ErrVersionMismatch
+	if unique != 0 {
+		err = h.service.Write(key, data, expiresAt, flags, storage.PutOptions{OnlyExisting: true, Version: unique})
+	}
+
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		// finding out, whether the entry was modified or removed
+		if _, err := h.service.Read(key); errors.Is(err, storage.ErrKeyNotFound) {
+			c.reply("NOT_FOUND")
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		c.reply("EXISTS")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.reply("STORED")
+
+	return nil
+}
+
+// delete <key> [noreply]
+func (h *Handler) delete(c *conn, args []string) error {
+	if len(args) != 2 || len(args[1]) > maxKeySize {
+		return errBadFormat
+	}
+
+	err := h.service.Delete(args[1])
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.reply("DELETED")
+
+	return nil
+}
+
+// incr <key> <value> [noreply]
+// decr <key> <value> [noreply]
+//
+// values are unsigned 64-bit integers: incr wraps around, while decr stops at zero
+// missing keys are not created
+func (h *Handler) incr(c *conn, args []string) error {
+	if len(args) != 3 || len(args[1]) > maxKeySize {
+		return errBadFormat
+	}
+
+	delta, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return clientError{msg: "invalid numeric delta argument"}
+	}
+
+	key := args[1]
+
+	// retrying, until the entry is not modified in between
+	for {
+		entry, err := h.service.Read(key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			c.reply("NOT_FOUND")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		cur, err := strconv.ParseUint(strings.TrimRight(entry.Value.Data, " "), 10, 64)
+		if err != nil || entry.Value.Type != storage.TypeString {
+			return clientError{msg: "cannot increment or decrement non-numeric value"}
+		}
+
+		switch {
+		case args[0] == "incr":
+			cur += delta
+		case delta > cur:
+			cur = 0
+		default:
+			cur -= delta
+		}
+
+		res := strconv.FormatUint(cur, 10)
+
+		// ttl and flags are kept
+		err = h.service.Write(key, res, "", entry.Value.Flags, storage.PutOptions{KeepTTL: true, Version: entry.Value.Version})
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		c.reply(res)
+
+		return nil
+	}
+}
+
+// touch <key> <exptime> [noreply]
+// zero exptime removes the ttl
+func (h *Handler) touch(c *conn, args []string) error {
+	if len(args) != 3 || len(args[1]) > maxKeySize {
+		return errBadFormat
+	}
+
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return clientError{msg: "invalid exptime argument"}
+	}
+
+	if expiresAt := expiration(exptime); expiresAt != "" {
+		err = h.service.Expire(args[1], expiresAt)
+	} else {
+		_, err = h.service.Persist(args[1])
+	}
+
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.reply("TOUCHED")
+
+	return nil
+}
+
+// version
+func (h *Handler) version(c *conn, args []string) error {
+	c.w.WriteString("VERSION key-value-storage\r\n")
+	return nil
+}
+
+// quit
+func (h *Handler) quit(c *conn, args []string) error {
+	c.quit = true
+	return nil
+}
+
+// converts exptime into expiration time of the service:
+// zero means no expiration time, negative one means the item has already expired,
+// up to 30 days it's an amount of seconds, otherwise - unix time
+func expiration(exptime int64) string {
+	var expiresAt time.Time
+
+	switch {
+	case exptime == 0:
+		return ""
+	case exptime < 0:
+		expiresAt = time.Now().Add(-time.Second)
+	case exptime <= maxRelativeExptime:
+		expiresAt = time.Now().Add(time.Duration(exptime) * time.Second)
+	default:
+		expiresAt = time.Unix(exptime, 0)
+	}
+
+	return expiresAt.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,215 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// max length of a command line, e.g. get with many keys
+	maxLineSize = 64 << 10
+	// max length of a key, as in memcached
+	maxKeySize = 250
+	// max size of a value, as the default item size limit of memcached
+	maxValueSize = 1 << 20
+)
+
+// malformed command line, reported with CLIENT_ERROR
+type clientError struct {
+	msg string
+}
+
+func (e clientError) Error() string { return e.msg }
+
+var errBadFormat = clientError{msg: "bad command line format"}
+
+// errors, which are reported to the client as they are
+// the rest are logged and hidden behind a generic message
+var knownErrors = []error{
+	storage.ErrUnsupported,
+	storage.ErrNamespaceNotFound,
+	storage.ErrFeedClosed,
+}
+
+// serves the memcached text protocol on top of the service,
+// so that memcached clients can be used with the storage
+//
+// commands are applied to the default namespace
+// client flags are stored along with the value
+type Handler struct {
+	service *service.Service
+	errLog  *logrus.Logger
+}
+
+// state of a single connection
+type conn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+	// set by the noreply argument of the current command
+	noreply bool
+	// set by quit
+	quit bool
+}
+
+type command func(h *Handler, c *conn, args []string) error
+
+// commands by their names, along with whether they accept noreply
+var commands = map[string]struct {
+	fn      command
+	noreply bool
+}{
+	"get":     {(*Handler).get, false},
+	"gets":    {(*Handler).get, false},
+	"set":     {(*Handler).store, true},
+	"add":     {(*Handler).store, true},
+	"replace": {(*Handler).store, true},
+	"cas":     {(*Handler).store, true},
+	"delete":  {(*Handler).delete, true},
+	"incr":    {(*Handler).incr, true},
+	"decr":    {(*Handler).incr, true},
+	"touch":   {(*Handler).touch, true},
+	"version": {(*Handler).version, false},
+	"quit":    {(*Handler).quit, false},
+}
+
+func New(service *service.Service, errLog *logrus.Logger) *Handler {
+	return &Handler{
+		service: service,
+		errLog:  errLog,
+	}
+}
+
+// runs commands of the connection, until it is closed
+// replies to pipelined commands are flushed at once
+func (h *Handler) ServeConn(netConn net.Conn) {
+	c := &conn{
+		r: bufio.NewReader(netConn),
+		w: bufio.NewWriter(netConn),
+	}
+
+	for !c.quit {
+		line, err := c.readLine()
+		if errors.As(err, new(clientError)) {
+			// the rest of the line can't be told apart from the next command
+			c.w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+			c.w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		h.run(c, strings.Fields(line))
+
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	c.w.Flush()
+}
+
+func (h *Handler) run(c *conn, args []string) {
+	if len(args) == 0 {
+		c.w.WriteString("ERROR\r\n")
+		return
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		c.w.WriteString("ERROR\r\n")
+		return
+	}
+
+	c.noreply = cmd.noreply && len(args) > 1 && args[len(args)-1] == "noreply"
+	if c.noreply {
+		args = args[:len(args)-1]
+	}
+
+	if err := cmd.fn(h, c, args); err != nil {
+		h.fail(c, err)
+	}
+}
+
+// writes the reply, unless noreply is set
+func (c *conn) reply(line string) {
+	if !c.noreply {
+		c.w.WriteString(line + "\r\n")
+	}
+}
+
+// reads a line without the trailing CRLF
+func (c *conn) readLine() (string, error) {
+	var line []byte
+
+	for {
+		chunk, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		line = append(line, chunk...)
+		if len(line) > maxLineSize {
+			return "", clientError{msg: "line too long"}
+		}
+
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// reads the data block of a storage command
+func (c *conn) readData(size int) (string, error) {
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return "", err
+	}
+
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return "", clientError{msg: "bad data chunk"}
+	}
+
+	return string(buf[:size]), nil
+}
+
+// replies with the error
+// malformed commands are reported even with noreply, as memcached does
+func (h *Handler) fail(c *conn, err error) {
+	var clientErr clientError
+	if errors.As(err, &clientErr) {
+		c.w.WriteString("CLIENT_ERROR " + clientErr.msg + "\r\n")
+		return
+	}
+
+	if errors.Is(err, storage.ErrOutOfMemory) {
+		c.reply("SERVER_ERROR out of memory storing object")
+		return
+	}
+
+	for _, known := range knownErrors {
+		if errors.Is(err, known) {
+			c.reply("SERVER_ERROR " + err.Error())
+			return
+		}
+	}
+
+	h.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+
+	c.reply("SERVER_ERROR internal server error")
+}
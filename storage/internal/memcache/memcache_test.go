@@ -0,0 +1,192 @@
+package memcache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// serves a fresh storage over an in-memory connection
+func serve(t *testing.T) (*bufio.Reader, io.Writer) {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	spaces, err := storage.OpenNamespaces("memory", storage.EngineConfig{
+		Path:    filepath.Join(t.TempDir(), "data"),
+		InfoLog: log,
+		ErrLog:  log,
+	}, storage.NamespaceConfig{DefaultTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := service.New(spaces)
+	client, server := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		New(srv, log).ServeConn(server)
+		server.Close()
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+		srv.Close()
+		spaces.Close()
+	})
+
+	return bufio.NewReader(client), client
+}
+
+// sends the request and checks, that the next lines of the reply are the expected ones
+func exchange(t *testing.T, r *bufio.Reader, w io.Writer, req string, want ...string) {
+	t.Helper()
+
+	if req != "" {
+		if _, err := io.WriteString(w, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, line := range want {
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%q: %v", req, err)
+		}
+		if got != line+"\r\n" {
+			t.Fatalf("%q: got %q, want %q", req, strings.TrimSpace(got), line)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "set a 42 0 3\r\nfoo\r\n", "STORED")
+	exchange(t, r, w, "get a\r\n", "VALUE a 42 3", "foo", "END")
+	exchange(t, r, w, "add a 0 0 1\r\nx\r\n", "NOT_STORED")
+	exchange(t, r, w, "replace b 0 0 1\r\nx\r\n", "NOT_STORED")
+	exchange(t, r, w, "replace a 7 0 3\r\nbar\r\n", "STORED")
+	exchange(t, r, w, "get a b\r\n", "VALUE a 7 3", "bar", "END")
+
+	// noreply suppresses the reply
+	exchange(t, r, w, "set b 0 0 2 noreply\r\nhi\r\nget b\r\n", "VALUE b 0 2", "hi", "END")
+}
+
+func TestBadFormat(t *testing.T) {
+	r, w := serve(t)
+
+	// data of a rejected command is not taken for the next command
+	exchange(t, r, w, "set a x 0 3\r\nget\r\n", "CLIENT_ERROR bad command line format")
+	exchange(t, r, w, "set "+strings.Repeat("k", maxKeySize+1)+" 0 0 3\r\nget\r\n", "CLIENT_ERROR bad command line format")
+	exchange(t, r, w, "set a 0 0 3 4 5\r\nget\r\n", "CLIENT_ERROR bad command line format")
+	exchange(t, r, w, "get a\r\n", "END")
+
+	// too large data is skipped as well
+	big := strings.Repeat("x", maxValueSize+1)
+	// the pipe is synchronous, so the request is written, while the reply is read
+	go io.WriteString(w, "set a 0 0 "+strconv.Itoa(len(big))+"\r\n"+big+"\r\nget a\r\n")
+	exchange(t, r, w, "", "SERVER_ERROR object too large for cache", "END")
+
+	exchange(t, r, w, "foo\r\n", "ERROR")
+	exchange(t, r, w, "\r\n", "ERROR")
+	exchange(t, r, w, "incr a\r\n", "CLIENT_ERROR bad command line format")
+	exchange(t, r, w, "set a 0 0 3\r\nfoobar\r\n", "CLIENT_ERROR bad data chunk")
+}
+
+func TestLineTooLong(t *testing.T) {
+	r, w := serve(t)
+
+	// the rest of the line can't be told apart from the next command, so the connection is closed
+	go io.WriteString(w, "get "+strings.Repeat("k", maxLineSize)+"\r\n")
+	exchange(t, r, w, "", "CLIENT_ERROR line too long")
+
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Fatal("connection is not closed after a too long line")
+	}
+}
+
+func TestCas(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "cas a 0 0 1 1\r\nx\r\n", "NOT_FOUND")
+	exchange(t, r, w, "set a 0 0 1\r\nx\r\n", "STORED")
+
+	if _, err := io.WriteString(w, "gets a\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, _ := r.ReadString('\n')
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		t.Fatalf("gets: %q", line)
+	}
+	exchange(t, r, w, "", "x", "END")
+
+	unique := fields[4]
+	exchange(t, r, w, "cas a 5 0 1 "+unique+"\r\ny\r\n", "STORED")
+	exchange(t, r, w, "cas a 5 0 1 "+unique+"\r\nz\r\n", "EXISTS")
+	exchange(t, r, w, "get a\r\n", "VALUE a 5 1", "y", "END")
+}
+
+func TestExptime(t *testing.T) {
+	r, w := serve(t)
+
+	// negative exptime expires the item at once
+	exchange(t, r, w, "set a 0 -1 1\r\nx\r\n", "STORED")
+	exchange(t, r, w, "get a\r\n", "END")
+
+	exchange(t, r, w, "set a 0 1 1\r\nx\r\n", "STORED")
+	// zero exptime of set removes the ttl
+	exchange(t, r, w, "set a 0 0 1\r\ny\r\n", "STORED")
+	exchange(t, r, w, "touch b 1\r\n", "NOT_FOUND")
+	exchange(t, r, w, "set b 0 1 1\r\nx\r\n", "STORED")
+	// zero exptime of touch removes the ttl as well
+	exchange(t, r, w, "touch b 0\r\n", "TOUCHED")
+
+	time.Sleep(1100 * time.Millisecond)
+	exchange(t, r, w, "get a b\r\n", "VALUE a 0 1", "y", "VALUE b 0 1", "x", "END")
+
+	// absolute unix time in the past
+	exchange(t, r, w, "set c 0 "+"2592001"+" 1\r\nx\r\n", "STORED")
+	exchange(t, r, w, "get c\r\n", "END")
+}
+
+func TestIncr(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "incr a 1\r\n", "NOT_FOUND")
+	exchange(t, r, w, "set a 3 0 2\r\n10\r\n", "STORED")
+	exchange(t, r, w, "incr a 5\r\n", "15")
+	exchange(t, r, w, "decr a 20\r\n", "0")
+	exchange(t, r, w, "incr a 18446744073709551615\r\n", "18446744073709551615")
+	exchange(t, r, w, "incr a 1\r\n", "0")
+	// flags are kept
+	exchange(t, r, w, "get a\r\n", "VALUE a 3 1", "0", "END")
+
+	exchange(t, r, w, "set b 0 0 1\r\nx\r\n", "STORED")
+	exchange(t, r, w, "incr b 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	exchange(t, r, w, "incr b x\r\n", "CLIENT_ERROR invalid numeric delta argument")
+}
+
+func TestDelete(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "delete a\r\n", "NOT_FOUND")
+	exchange(t, r, w, "set a 0 0 1\r\nx\r\n", "STORED")
+	exchange(t, r, w, "delete a\r\n", "DELETED")
+	exchange(t, r, w, "get a\r\n", "END")
+	exchange(t, r, w, "version\r\n", "VERSION key-value-storage")
+}
@@ -0,0 +1,116 @@
+package pubsub
+
+// reports whether the channel matches the glob pattern:
+// * matches any sequence of characters, ? - a single character,
+// [abc], [a-z] and [^a-z] - a character from (or not from) the set,
+// \ escapes the next character
+//
+// only the last star is backtracked to: once the pattern after it matches,
+// earlier stars never need to consume more, so matching takes O(len(pattern) * len(channel))
+func match(pattern, channel string) bool {
+	var (
+		p, c int
+		// position right after the last star and the channel position it is retried from
+		star      = -1
+		starMatch int
+	)
+
+	for c < len(channel) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				p++
+				star, starMatch = p, c
+				continue
+			case '?':
+				p, c = p+1, c+1
+				continue
+			case '[':
+				if matched, rest := matchClass(pattern[p+1:], channel[c]); matched {
+					p, c = len(pattern)-len(rest), c+1
+					continue
+				}
+			default:
+				lit := p
+				if pattern[p] == '\\' && p+1 < len(pattern) {
+					lit++
+				}
+				if pattern[lit] == channel[c] {
+					p, c = lit+1, c+1
+					continue
+				}
+			}
+		}
+
+		// mismatch - the last star consumes one more character
+		if star < 0 {
+			return false
+		}
+		starMatch++
+		p, c = star, starMatch
+	}
+
+	// trailing stars match the empty rest
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matches the character against the class, which pattern starts with (right after "[")
+// returns the rest of the pattern after the closing "]"
+func matchClass(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']' && i > 0:
+			return matched != negate, pattern[i+1:]
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			matched = matched || pattern[i] == c
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			matched = matched || pattern[i] <= c && c <= pattern[i+2]
+			i += 2
+		default:
+			matched = matched || pattern[i] == c
+		}
+	}
+
+	// unterminated class, rejected by validPattern
+	return false, ""
+}
+
+// reports whether every character class of the pattern is terminated
+func validPattern(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			i++
+			if i < len(pattern) && pattern[i] == '^' {
+				i++
+			}
+
+			// "]" right after "[" is a member of the class
+			start := i
+			for i < len(pattern) && (pattern[i] != ']' || i == start) {
+				if pattern[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(pattern) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
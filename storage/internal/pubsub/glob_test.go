@@ -0,0 +1,97 @@
+package pubsub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		channel string
+		want    bool
+	}{
+		{"news", "news", true},
+		{"news", "new", false},
+		{"news", "newsx", false},
+		{"", "", true},
+		{"", "a", false},
+
+		{"*", "", true},
+		{"*", "anything", true},
+		{"news.*", "news.sport", true},
+		{"news.*", "news.", true},
+		{"news.*", "news", false},
+		{"*.sport", "news.sport", true},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"a*b*c", "acbc", true},
+		{"**a", "a", true},
+
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"?", "", false},
+
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{"[]]", "]", true},
+		{"[a-]", "-", true},
+		{`[\]]`, "]", true},
+
+		{`news\*`, "news*", true},
+		{`news\*`, "newsx", false},
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`a\`, `a\`, true},
+	}
+
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.channel); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.channel, got, tt.want)
+		}
+	}
+}
+
+// only the last star is backtracked to, so many stars don't blow up matching
+func TestMatchStars(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	channel := strings.Repeat("a", 10000)
+
+	start := time.Now()
+	if match(pattern, channel) {
+		t.Fatal("match: unexpected match")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("match took %v", elapsed)
+	}
+}
+
+func TestValidPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"news.*", true},
+		{"[abc]", true},
+		{"[^a-z]x", true},
+		{"[]]", true},
+		{`[\]`, false},
+		{`[\]]`, true},
+		{"[abc", false},
+		{"[", false},
+		{"[^", false},
+		{`\[`, true},
+	}
+
+	for _, tt := range tests {
+		if got := validPattern(tt.pattern); got != tt.want {
+			t.Errorf("validPattern(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package pubsub
+
+// Option configuration pattern
+type Option func(*Broker)
+
+// sets the amount of messages, buffered for each subscriber
+func WithBuffer(buffer int) Option {
+	return func(b *Broker) {
+		if buffer > 0 {
+			b.buffer = buffer
+		}
+	}
+}
+
+// sets what happens to subscribers, whose buffer is full
+func WithSlowPolicy(policy SlowPolicy) Option {
+	return func(b *Broker) {
+		b.slowPolicy = policy
+	}
+}
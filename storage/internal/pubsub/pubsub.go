@@ -0,0 +1,239 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBuffer     = 256
+	defaultSlowPolicy = Disconnect
+)
+
+var (
+	ErrInvalidPattern = errors.New("invalid channel pattern")
+	ErrNoChannels     = errors.New("at least one channel or pattern should be provided")
+	ErrSlowSubscriber = errors.New("subscriber doesn't keep up with the messages")
+	ErrBrokerClosed   = errors.New("broker is closed")
+)
+
+// what happens to a subscriber, whose buffer is full
+type SlowPolicy string
+
+const (
+	// new messages are dropped, until the subscriber catches up
+	Drop SlowPolicy = "drop"
+	// subscription is closed with ErrSlowSubscriber
+	Disconnect SlowPolicy = "disconnect"
+)
+
+type Message struct {
+	Channel string `json:"channel"`
+	// pattern, which the channel was matched by, empty for plain subscriptions
+	Pattern string    `json:"pattern,omitempty"`
+	Payload string    `json:"payload"`
+	At      time.Time `json:"at"`
+}
+
+// in-process fan-out of messages to subscribers of channels
+// messages are not stored: only current subscribers receive them
+//
+// each subscriber has a buffer of its own, so publishers never wait for the slow ones,
+// which are handled according to the slow policy instead
+type Broker struct {
+	mu sync.Mutex
+	// subscribers by channel
+	channels map[string]map[*Subscription]struct{}
+	// subscribers with at least one pattern
+	patterned map[*Subscription]struct{}
+	closed    bool
+
+	buffer     int
+	slowPolicy SlowPolicy
+}
+
+func New(opts ...Option) *Broker {
+	b := &Broker{
+		channels:   make(map[string]map[*Subscription]struct{}),
+		patterned:  make(map[*Subscription]struct{}),
+		buffer:     defaultBuffer,
+		slowPolicy: defaultSlowPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// subscribes to the channels and to every channel, matching one of the patterns
+// patterns are globs: * matches any sequence, ? - any character, [a-z] - a character from the set
+func (b *Broker) Subscribe(channels, patterns []string) (*Subscription, error) {
+	if len(channels) == 0 && len(patterns) == 0 {
+		return nil, ErrNoChannels
+	}
+
+	for _, pattern := range patterns {
+		if !validPattern(pattern) {
+			return nil, ErrInvalidPattern
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	sub := &Subscription{
+		broker:   b,
+		channels: channels,
+		patterns: patterns,
+		messages: make(chan Message, b.buffer),
+	}
+
+	for _, channel := range channels {
+		if b.channels[channel] == nil {
+			b.channels[channel] = make(map[*Subscription]struct{})
+		}
+		b.channels[channel][sub] = struct{}{}
+	}
+
+	if len(patterns) != 0 {
+		b.patterned[sub] = struct{}{}
+	}
+
+	return sub, nil
+}
+
+// sends the message to subscribers of the channel
+// returns the amount of subscriptions, which have received it
+func (b *Broker) Publish(channel, payload string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	received := 0
+
+	for sub := range b.channels[channel] {
+		if b.deliver(sub, Message{Channel: channel, Payload: payload, At: now}) {
+			received++
+		}
+	}
+
+	for sub := range b.patterned {
+		for _, pattern := range sub.patterns {
+			if match(pattern, channel) && b.deliver(sub, Message{Channel: channel, Pattern: pattern, Payload: payload, At: now}) {
+				received++
+			}
+		}
+	}
+
+	return received
+}
+
+// closes every subscription with ErrBrokerClosed
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for sub := range b.patterned {
+		b.unsubscribe(sub, ErrBrokerClosed)
+	}
+	for _, subs := range b.channels {
+		for sub := range subs {
+			b.unsubscribe(sub, ErrBrokerClosed)
+		}
+	}
+}
+
+// lock should be held by the caller
+func (b *Broker) deliver(sub *Subscription, msg Message) bool {
+	// closed by an earlier match of the same message
+	if sub.closed {
+		return false
+	}
+
+	select {
+	case sub.messages <- msg:
+		return true
+	default:
+	}
+
+	if b.slowPolicy == Drop {
+		sub.dropped++
+	} else {
+		b.unsubscribe(sub, ErrSlowSubscriber)
+	}
+
+	return false
+}
+
+// lock should be held by the caller
+func (b *Broker) unsubscribe(sub *Subscription, err error) {
+	if sub.closed {
+		return
+	}
+
+	for _, channel := range sub.channels {
+		delete(b.channels[channel], sub)
+		if len(b.channels[channel]) == 0 {
+			delete(b.channels, channel)
+		}
+	}
+	delete(b.patterned, sub)
+
+	sub.closed = true
+	sub.err = err
+	close(sub.messages)
+}
+
+// subscription to a set of channels and patterns
+// fields below are guarded by the broker lock
+type Subscription struct {
+	broker   *Broker
+	channels []string
+	patterns []string
+
+	messages chan Message
+	// amount of messages, dropped since the buffer got full
+	dropped uint64
+	closed  bool
+	err     error
+}
+
+// returns received messages
+// channel is closed once the subscription is over, see Err
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// returns the amount of messages, dropped because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	return s.dropped
+}
+
+// returns the reason the subscription is over:
+// ErrSlowSubscriber, ErrBrokerClosed or nil if it was closed by the subscriber or is still going
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	return s.err
+}
+
+// unsubscribes from every channel
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.unsubscribe(s, nil)
+}
@@ -0,0 +1,311 @@
+package resp
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// PING [message]
+func (h *Handler) ping(c *conn, args []string) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+// switches the protocol version and replies with the server info
+func (h *Handler) hello(c *conn, args []string) {
+	proto := c.w.proto
+
+	if len(args) > 1 {
+		ver, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if ver != 2 && ver != 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = ver
+	}
+
+	name := c.name
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "auth":
+			// there are no users, so no credentials can be valid
+			c.w.error("ERR AUTH is not supported")
+			return
+		case "setname":
+			if i+1 >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			i++
+			name = args[i]
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	c.w.proto = proto
+	c.name = name
+
+	c.w.mapHeader(6)
+	c.w.bulk("server")
+	c.w.bulk("key-value-storage")
+	c.w.bulk("proto")
+	c.w.integer(int64(proto))
+	c.w.bulk("id")
+	c.w.integer(c.id)
+	c.w.bulk("mode")
+	c.w.bulk("standalone")
+	c.w.bulk("role")
+	c.w.bulk("master")
+	c.w.bulk("modules")
+	c.w.array(0)
+}
+
+// CLIENT ID | GETNAME | SETNAME name | SETINFO attr value
+// libraries call them on connect, so only the connection name is actually kept
+func (h *Handler) client(c *conn, args []string) {
+	switch sub := strings.ToLower(args[1]); {
+	case sub == "id" && len(args) == 2:
+		c.w.integer(c.id)
+	case sub == "getname" && len(args) == 2:
+		if c.name == "" {
+			c.w.null()
+			return
+		}
+		c.w.bulk(c.name)
+	case sub == "setname" && len(args) == 3:
+		c.name = args[2]
+		c.w.simple("OK")
+	case sub == "setinfo" && len(args) == 4:
+		c.w.simple("OK")
+	default:
+		c.w.error("ERR unknown subcommand or wrong number of arguments for 'client' command")
+	}
+}
+
+// QUIT
+func (h *Handler) quit(c *conn, args []string) {
+	c.quit = true
+	c.w.simple("OK")
+}
+
+// GET key
+func (h *Handler) get(c *conn, args []string) {
+	entry, err := h.service.Read(args[1])
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.w.null()
+		return
+	}
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	if entry.Value.Type != storage.TypeString {
+		h.fail(c, storage.ErrWrongType)
+		return
+	}
+
+	c.w.bulk(entry.Value.Data)
+}
+
+// SET key value [NX | XX] [EX seconds | PX milliseconds | KEEPTTL]
+//
+// as in redis, the key is stored without a ttl (the default ttl of the namespace doesn't apply),
+// unless either an expiration or KEEPTTL is passed
+func (h *Handler) set(c *conn, args []string) {
+	var (
+		opts storage.PutOptions
+		ttl  time.Duration
+	)
+
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); {
+		case opt == "nx" && !opts.OnlyExisting:
+			opts.OnlyNew = true
+		case opt == "xx" && !opts.OnlyNew:
+			opts.OnlyExisting = true
+		case opt == "keepttl" && ttl == 0:
+			opts.KeepTTL = true
+		case (opt == "ex" || opt == "px") && ttl == 0 && !opts.KeepTTL && i+1 < len(args):
+			i++
+
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+
+			var ok bool
+			if ttl, ok = parseTTL(args[i], unit); !ok {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	var expiresAt string
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).Format(time.RFC3339Nano)
+	}
+
+	err := h.service.Write(args[1], args[2], expiresAt, 0, opts)
+
+	// condition is not met
+	if errors.Is(err, storage.ErrKeyAlreadyExists) || errors.Is(err, storage.ErrKeyNotFound) {
+		c.w.null()
+		return
+	}
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.w.simple("OK")
+}
+
+// DEL key [key ...]
+// replies with the amount of removed keys
+func (h *Handler) del(c *conn, args []string) {
+	removed := int64(0)
+
+	for _, key := range args[1:] {
+		err := h.service.Delete(key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			h.fail(c, err)
+			return
+		}
+		removed++
+	}
+
+	c.w.integer(removed)
+}
+
+// EXISTS key [key ...]
+// replies with the amount of existing keys, repeated ones are counted as many times
+func (h *Handler) exists(c *conn, args []string) {
+	found := int64(0)
+
+	for _, key := range args[1:] {
+		_, err := h.service.Read(key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			h.fail(c, err)
+			return
+		}
+		found++
+	}
+
+	c.w.integer(found)
+}
+
+// TTL key
+// replies with the remaining seconds, -1 if the key doesn't expire or -2 if it doesn't exist
+func (h *Handler) ttl(c *conn, args []string) {
+	entry, err := h.service.Read(args[1])
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.w.integer(-2)
+		return
+	}
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	if entry.Value.ExpiresAt.IsZero() {
+		c.w.integer(-1)
+		return
+	}
+
+	remaining := time.Until(entry.Value.ExpiresAt)
+	c.w.integer(int64((remaining + 500*time.Millisecond) / time.Second))
+}
+
+// EXPIRE key seconds
+// replies with 1 if the ttl was set or 0 if the key doesn't exist
+// non-positive ttl removes the key at once
+func (h *Handler) expire(c *conn, args []string) {
+	seconds, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.w.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	if seconds <= 0 {
+		h.del(c, args[:2])
+		return
+	}
+
+	ttl, ok := parseTTL(args[2], time.Second)
+	if !ok {
+		c.w.error("ERR invalid expire time in 'expire' command")
+		return
+	}
+
+	err = h.service.Expire(args[1], time.Now().Add(ttl).Format(time.RFC3339Nano))
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.w.integer(0)
+		return
+	}
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.w.integer(1)
+}
+
+// PERSIST key
+// replies with 1 if the ttl was removed or 0 if the key doesn't exist or has no ttl
+func (h *Handler) persist(c *conn, args []string) {
+	removed, err := h.service.Persist(args[1])
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		c.w.integer(0)
+		return
+	}
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	if removed {
+		c.w.integer(1)
+		return
+	}
+
+	c.w.integer(0)
+}
+
+// parses a positive amount of units, which fits into time.Duration
+func parseTTL(raw string, unit time.Duration) (time.Duration, bool) {
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,181 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// max amount of arguments of a command
+	maxArgs = 1 << 20
+	// max size of a single argument
+	maxBulkSize = 64 << 20
+	// max length of an inline command
+	maxInlineSize = 64 << 10
+)
+
+// malformed input, the connection is closed after it's reported
+type protocolError struct {
+	msg string
+}
+
+func (e protocolError) Error() string { return "Protocol error: " + e.msg }
+
+// reads commands, sent either as arrays of bulk strings or inline
+type reader struct {
+	*bufio.Reader
+}
+
+func newReader(r io.Reader) reader {
+	return reader{Reader: bufio.NewReader(r)}
+}
+
+// returns the name of the command along with its arguments
+// empty inline commands are skipped
+func (r reader) readCommand() ([]string, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(line, "*") {
+			if args := strings.Fields(line); len(args) != 0 {
+				return args, nil
+			}
+			continue
+		}
+
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > maxArgs {
+			return nil, protocolError{msg: "invalid multibulk length"}
+		}
+		if n <= 0 {
+			continue
+		}
+
+		// the length is not trusted, so that a huge one doesn't allocate anything upfront:
+		// arguments are appended as they arrive
+		var args []string
+		for range n {
+			arg, err := r.readBulk()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+
+		return args, nil
+	}
+}
+
+func (r reader) readBulk() (string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(line, "$") {
+		return "", protocolError{msg: fmt.Sprintf("expected '$', got '%.1s'", line)}
+	}
+
+	size, err := strconv.Atoi(line[1:])
+	if err != nil || size < 0 || size > maxBulkSize {
+		return "", protocolError{msg: "invalid bulk length"}
+	}
+
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return "", protocolError{msg: "bulk string is not terminated by CRLF"}
+	}
+
+	return string(buf[:size]), nil
+}
+
+// reads a line without the trailing CRLF
+func (r reader) readLine() (string, error) {
+	var line []byte
+
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		line = append(line, chunk...)
+		if len(line) > maxInlineSize {
+			return "", protocolError{msg: "too big inline request"}
+		}
+
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// writes replies in RESP2 or, once negotiated by HELLO, in RESP3
+// RESP3 differs only in null and map replies for the supported commands
+type writer struct {
+	*bufio.Writer
+	proto int
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{Writer: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// msg should start with an error code, e.g. ERR or WRONGTYPE
+func (w *writer) error(msg string) {
+	// line breaks would end the reply too early
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+
+	w.WriteString("-" + msg + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *writer) null() {
+	if w.proto == 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+
+	w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// map of n pairs, which is a flat array of keys and values in RESP2
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+
+	w.array(2 * n)
+}
+
+func isProtocolError(err error) bool {
+	var protoErr protocolError
+	return errors.As(err, &protoErr)
+}
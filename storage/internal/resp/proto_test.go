@@ -0,0 +1,108 @@
+package resp
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string
+	}{
+		{
+			name:  "multibulk",
+			input: "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nvalue\r\n",
+			want:  [][]string{{"SET", "k", "value"}},
+		},
+		{
+			name:  "binary safe",
+			input: "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n",
+			want:  [][]string{{"ECHO", "a\r\nb"}},
+		},
+		{
+			name:  "empty argument",
+			input: "*2\r\n$3\r\nGET\r\n$0\r\n\r\n",
+			want:  [][]string{{"GET", ""}},
+		},
+		{
+			name:  "inline",
+			input: "set  k   v\r\nPING\n",
+			want:  [][]string{{"set", "k", "v"}, {"PING"}},
+		},
+		{
+			name:  "skipped",
+			input: "\r\n   \r\n*0\r\n*-1\r\nPING\r\n",
+			want:  [][]string{{"PING"}},
+		},
+		{
+			name:  "pipelined",
+			input: "*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n",
+			want:  [][]string{{"PING"}, {"GET", "k"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReader(strings.NewReader(tt.input))
+
+			for _, want := range tt.want {
+				got, err := r.readCommand()
+				if err != nil {
+					t.Fatalf("readCommand: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("readCommand: got %q, want %q", got, want)
+				}
+			}
+
+			if _, err := r.readCommand(); !errors.Is(err, io.EOF) {
+				t.Fatalf("readCommand at the end: got %v, want %v", err, io.EOF)
+			}
+		})
+	}
+}
+
+func TestReadCommandErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// empty one means, that the input is not malformed, but incomplete
+		msg string
+	}{
+		{"multibulk length", "*x\r\n", "invalid multibulk length"},
+		{"too many arguments", "*2000000\r\n", "invalid multibulk length"},
+		{"not a bulk", "*1\r\n:1\r\n", "expected '$', got ':'"},
+		{"bulk length", "*1\r\n$-1\r\n", "invalid bulk length"},
+		{"too big bulk", "*1\r\n$1000000000\r\n", "invalid bulk length"},
+		{"unterminated bulk", "*1\r\n$3\r\nabcd\r\n", "bulk string is not terminated by CRLF"},
+		{"too big inline", strings.Repeat("a", maxInlineSize+1) + "\r\n", "too big inline request"},
+		// the length is not trusted, so nothing is allocated upfront
+		{"truncated multibulk", "*1000000\r\n$1\r\na\r\n", ""},
+		{"truncated bulk", "*1\r\n$10\r\nabc", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newReader(strings.NewReader(tt.input)).readCommand()
+			if err == nil {
+				t.Fatal("readCommand: no error")
+			}
+
+			if tt.msg == "" {
+				if isProtocolError(err) {
+					t.Fatalf("readCommand: got protocol error %v, want end of input", err)
+				}
+				return
+			}
+
+			if !isProtocolError(err) || err.Error() != "Protocol error: "+tt.msg {
+				t.Fatalf("readCommand: got %v, want protocol error %q", err, tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// errors, which are reported to the client as they are
+// the rest are logged and hidden behind a generic message
+var knownErrors = []error{
+	storage.ErrKeyNotFound,
+	storage.ErrKeyAlreadyExists,
+	storage.ErrUnsupported,
+	storage.ErrNamespaceNotFound,
+	storage.ErrFeedClosed,
+}
+
+// serves the Redis protocol (RESP2 and RESP3) on top of the service,
+// so that redis-cli and Redis client libraries can be used with the storage
+//
+// commands are applied to the default namespace
+type Handler struct {
+	service *service.Service
+	errLog  *logrus.Logger
+
+	// ids of the connections
+	lastID atomic.Int64
+}
+
+// state of a single connection
+type conn struct {
+	id   int64
+	name string
+
+	r reader
+	w *writer
+	// set by QUIT
+	quit bool
+}
+
+type command func(h *Handler, c *conn, args []string)
+
+// commands by their lower case names along with their arity:
+// positive one is the exact amount of arguments (including the name), negative one is the minimal
+var commands = map[string]struct {
+	fn    command
+	arity int
+}{
+	"ping":    {(*Handler).ping, -1},
+	"hello":   {(*Handler).hello, -1},
+	"client":  {(*Handler).client, -2},
+	"quit":    {(*Handler).quit, 1},
+	"get":     {(*Handler).get, 2},
+	"set":     {(*Handler).set, -3},
+	"del":     {(*Handler).del, -2},
+	"exists":  {(*Handler).exists, -2},
+	"ttl":     {(*Handler).ttl, 2},
+	"expire":  {(*Handler).expire, 3},
+	"persist": {(*Handler).persist, 2},
+}
+
+func New(service *service.Service, errLog *logrus.Logger) *Handler {
+	return &Handler{
+		service: service,
+		errLog:  errLog,
+	}
+}
+
+// runs commands of the connection, until it is closed
+// replies to pipelined commands are flushed at once
+func (h *Handler) ServeConn(netConn net.Conn) {
+	c := &conn{
+		id: h.lastID.Add(1),
+		r:  newReader(netConn),
+		w:  newWriter(netConn),
+	}
+
+	for !c.quit {
+		args, err := c.r.readCommand()
+		if err != nil {
+			// malformed input can't be skipped, so the connection is closed right after the reply
+			if isProtocolError(err) {
+				c.w.error("ERR " + err.Error())
+				c.w.Flush()
+			}
+			return
+		}
+
+		h.run(c, args)
+
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	c.w.Flush()
+}
+
+func (h *Handler) run(c *conn, args []string) {
+	name := strings.ToLower(args[0])
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.error(fmt.Sprintf("ERR unknown command '%v'", args[0]))
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%v' command", name))
+		return
+	}
+
+	cmd.fn(h, c, args)
+}
+
+// replies with the error
+func (h *Handler) fail(c *conn, err error) {
+	switch {
+	case errors.Is(err, storage.ErrWrongType):
+		// message already starts with the WRONGTYPE code
+		c.w.error(err.Error())
+		return
+	case errors.Is(err, storage.ErrOutOfMemory):
+		c.w.error("OOM " + err.Error())
+		return
+	}
+
+	for _, known := range knownErrors {
+		if errors.Is(err, known) {
+			c.w.error("ERR " + err.Error())
+			return
+		}
+	}
+
+	h.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+
+	c.w.error("ERR internal server error")
+}
@@ -0,0 +1,148 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// serves a fresh storage over an in-memory connection
+func serve(t *testing.T) (*bufio.Reader, io.Writer) {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	spaces, err := storage.OpenNamespaces("memory", storage.EngineConfig{
+		Path:    filepath.Join(t.TempDir(), "data"),
+		InfoLog: log,
+		ErrLog:  log,
+	}, storage.NamespaceConfig{DefaultTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := service.New(spaces)
+	client, server := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		New(srv, log).ServeConn(server)
+		server.Close()
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+		srv.Close()
+		spaces.Close()
+	})
+
+	return bufio.NewReader(client), client
+}
+
+// sends the inline commands and checks, that the next lines of the reply are the expected ones
+func exchange(t *testing.T, r *bufio.Reader, w io.Writer, req string, want ...string) {
+	t.Helper()
+
+	if _, err := io.WriteString(w, req+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range want {
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%q: %v", req, err)
+		}
+		if got != line+"\r\n" {
+			t.Fatalf("%q: got %q, want %q", req, strings.TrimSpace(got), line)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "GET k", "$-1")
+	exchange(t, r, w, "SET k v", "+OK")
+	exchange(t, r, w, "GET k", "$1", "v")
+	exchange(t, r, w, "SET k v2 NX", "$-1")
+	exchange(t, r, w, "SET other v XX", "$-1")
+	exchange(t, r, w, "SET k v2 XX", "+OK")
+	exchange(t, r, w, "EXISTS k other k", ":2")
+	exchange(t, r, w, "DEL k other", ":1")
+	exchange(t, r, w, "EXISTS k", ":0")
+
+	// replies to pipelined commands come in order
+	exchange(t, r, w, "SET a 1\r\nSET b 2\r\nGET a", "+OK", "+OK", "$1", "1")
+}
+
+func TestExpiration(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "TTL k", ":-2")
+	// the default ttl of the namespace doesn't apply
+	exchange(t, r, w, "SET k v", "+OK")
+	exchange(t, r, w, "TTL k", ":-1")
+
+	exchange(t, r, w, "SET k v EX 100", "+OK")
+	exchange(t, r, w, "TTL k", ":100")
+	exchange(t, r, w, "SET k v2 KEEPTTL", "+OK")
+	exchange(t, r, w, "TTL k", ":100")
+	// plain SET clears the ttl
+	exchange(t, r, w, "SET k v3", "+OK")
+	exchange(t, r, w, "TTL k", ":-1")
+
+	exchange(t, r, w, "EXPIRE k 50", ":1")
+	exchange(t, r, w, "TTL k", ":50")
+	exchange(t, r, w, "PERSIST k", ":1")
+	exchange(t, r, w, "PERSIST k", ":0")
+	exchange(t, r, w, "TTL k", ":-1")
+
+	exchange(t, r, w, "EXPIRE missing 50", ":0")
+	exchange(t, r, w, "EXPIRE k 0", ":1")
+	exchange(t, r, w, "GET k", "$-1")
+}
+
+func TestErrors(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "FOO", "-ERR unknown command 'FOO'")
+	exchange(t, r, w, "GET", "-ERR wrong number of arguments for 'get' command")
+	exchange(t, r, w, "SET k v NX XX", "-ERR syntax error")
+	exchange(t, r, w, "SET k v EX 0", "-ERR invalid expire time in 'set' command")
+	exchange(t, r, w, "SET k v EX 10 KEEPTTL", "-ERR syntax error")
+	exchange(t, r, w, "EXPIRE k x", "-ERR value is not an integer or out of range")
+
+	// malformed input closes the connection right after the reply
+	exchange(t, r, w, "*1\r\n:1", "-ERR Protocol error: expected '$', got ':'")
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Fatal("connection is not closed after a protocol error")
+	}
+}
+
+func TestHello(t *testing.T) {
+	r, w := serve(t)
+
+	exchange(t, r, w, "HELLO 4", "-NOPROTO unsupported protocol version")
+	exchange(t, r, w, "HELLO 3", "%6")
+
+	// rest of the server info: 6 pairs, which take 21 lines
+	for range 21 {
+		if _, err := r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// RESP3 null
+	exchange(t, r, w, "GET k", "_")
+}
@@ -0,0 +1,298 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// pushes values to the list
+// form: key, value (repeated), side (left or right, right by default), expires_at (used only if the list gets created)
+// responds with the length of the list
+func (c *Controller) handleListPush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	left, ok := parseSide(w, r.PostFormValue("side"))
+	if !ok {
+		return
+	}
+
+	values := r.PostForm["value"]
+	if len(values) == 0 {
+		http.Error(w, "at least one value should be provided", http.StatusBadRequest)
+		return
+	}
+
+	length, err := c.service.ListPush(r.PostFormValue("key"), values, left, r.PostFormValue("expires_at"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, length)
+}
+
+// pops values from the list
+// form: key, count (1 by default), side (left or right, right by default)
+func (c *Controller) handleListPop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	left, ok := parseSide(w, r.PostFormValue("side"))
+	if !ok {
+		return
+	}
+
+	count := 1
+	if rawCount := r.PostFormValue("count"); rawCount != "" {
+		parsed, err := strconv.Atoi(rawCount)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "count should be a positive integer", http.StatusBadRequest)
+			return
+		}
+		count = parsed
+	}
+
+	res, err := c.service.ListPop(r.PostFormValue("key"), count, left)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// returns values of the list between start and stop, both inclusive
+// query: key, start (0 by default), stop (-1, the last value, by default)
+func (c *Controller) handleListRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	start, stop := 0, -1
+	for name, dst := range map[string]*int{"start": &start, "stop": &stop} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, name+" should be an integer", http.StatusBadRequest)
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	res, err := c.service.ListRange(query.Get("key"), start, stop)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// sets fields of the hash
+// form: key, field and value (repeated in pairs), expires_at (used only if the hash gets created)
+// responds with the amount of created fields
+func (c *Controller) handleHashSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, expiresAt := r.PostFormValue("key"), r.PostFormValue("expires_at")
+
+	names, values := r.PostForm["field"], r.PostForm["value"]
+	if len(names) == 0 || len(names) != len(values) {
+		http.Error(w, "fields and values should be provided in pairs", http.StatusBadRequest)
+		return
+	}
+
+	fields := make(map[string]string, len(names))
+	for i, name := range names {
+		fields[name] = values[i]
+	}
+
+	added, err := c.service.HashSet(key, fields, expiresAt)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, added)
+}
+
+// query: key, field
+func (c *Controller) handleHashGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	res, err := c.service.HashGet(query.Get("key"), query.Get("field"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, res)
+}
+
+// returns every field of the hash as a JSON object
+// query: key
+func (c *Controller) handleHashGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	res, err := c.service.HashGetAll(r.URL.Query().Get("key"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// query: key, field (repeated)
+// responds with the amount of removed fields
+func (c *Controller) handleHashDel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	removed, err := c.service.HashDel(query.Get("key"), query["field"])
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, removed)
+}
+
+// form: key, member (repeated), expires_at (used only if the set gets created)
+// responds with the amount of added members
+func (c *Controller) handleSetAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, expiresAt := r.PostFormValue("key"), r.PostFormValue("expires_at")
+
+	members := r.PostForm["member"]
+	if len(members) == 0 {
+		http.Error(w, "at least one member should be provided", http.StatusBadRequest)
+		return
+	}
+
+	added, err := c.service.SetAdd(key, members, expiresAt)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, added)
+}
+
+// query: key, member (repeated)
+// responds with the amount of removed members
+func (c *Controller) handleSetRem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	removed, err := c.service.SetRem(query.Get("key"), query["member"])
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, removed)
+}
+
+// query: key
+func (c *Controller) handleSetMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	res, err := c.service.SetMembers(r.URL.Query().Get("key"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// returns members, present in every set
+// query: key (repeated)
+func (c *Controller) handleSetInter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	res, err := c.service.SetInter(r.URL.Query()["key"])
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// reports whether the side of the list is the left one
+// responds with 400, if the side is invalid
+func parseSide(w http.ResponseWriter, side string) (left, ok bool) {
+	switch side {
+	case "left":
+		return true, true
+	case "", "right":
+		return false, true
+	default:
+		http.Error(w, "side should be either left or right", http.StatusBadRequest)
+		return false, false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, res string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, res)
+}
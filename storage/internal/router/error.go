@@ -1,17 +1,44 @@
 package router
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/cutlery47/key-value-storage/storage/internal/pubsub"
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
 	"github.com/cutlery47/key-value-storage/storage/internal/storage"
 	"github.com/sirupsen/logrus"
 )
 
 // error -> http status code map
 var errStatus = map[error]int{
-	storage.ErrKeyNotFound:      http.StatusNotFound,
-	storage.ErrKeyAlreadyExists: http.StatusBadRequest,
+	storage.ErrKeyNotFound:         http.StatusNotFound,
+	storage.ErrKeyAlreadyExists:    http.StatusBadRequest,
+	storage.ErrCompactionRunning:   http.StatusConflict,
+	storage.ErrUnsupported:         http.StatusNotImplemented,
+	storage.ErrOutOfMemory:         http.StatusInsufficientStorage,
+	storage.ErrEntryTooLarge:       http.StatusRequestEntityTooLarge,
+	service.ErrInvalidCursor:       http.StatusBadRequest,
+	storage.ErrVersionMismatch:     http.StatusPreconditionFailed,
+	service.ErrInvalidTxn:          http.StatusBadRequest,
+	service.ErrInvalidBatch:        http.StatusBadRequest,
+	service.ErrUnknownOp:           http.StatusBadRequest,
+	storage.ErrNotInteger:          http.StatusUnprocessableEntity,
+	storage.ErrNotFloat:            http.StatusUnprocessableEntity,
+	storage.ErrOverflow:            http.StatusUnprocessableEntity,
+	storage.ErrWrongType:           http.StatusConflict,
+	storage.ErrFieldNotFound:       http.StatusNotFound,
+	storage.ErrMemberNotFound:      http.StatusNotFound,
+	storage.ErrNamespaceNotFound:   http.StatusNotFound,
+	storage.ErrNamespaceExists:     http.StatusConflict,
+	storage.ErrInvalidNamespace:    http.StatusBadRequest,
+	storage.ErrDefaultNamespace:    http.StatusBadRequest,
+	storage.ErrRevisionUnavailable: http.StatusGone,
+	pubsub.ErrInvalidPattern:       http.StatusBadRequest,
+	pubsub.ErrNoChannels:           http.StatusBadRequest,
+	pubsub.ErrBrokerClosed:         http.StatusServiceUnavailable,
+	storage.ErrFeedClosed:          http.StatusServiceUnavailable,
 }
 
 // handles any errors occuring during runtime of the storage
@@ -25,7 +52,13 @@ func (h errHandler) Handle(err error) (status int, msg string) {
 
 	// if error is not internal - map it to specific status
 	// else return 500 and log out the error
-	mapStatus, ok := errStatus[err]
+	// wrapped errors (e.g. failed transactions) are mapped by their cause,
+	// while the message is kept whole
+	mapStatus, ok := 0, false
+	for cause := err; cause != nil && !ok; cause = errors.Unwrap(cause) {
+		mapStatus, ok = errStatus[cause]
+	}
+
 	if ok {
 		status = mapStatus
 		msg = err.Error()
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errInvalidPrecondition = errors.New(`If-Match and If-None-Match should hold either "*" or a single entry version`)
+
+// precondition of a conditional write, taken from If-Match/If-None-Match headers
+type precondition struct {
+	// no conditional headers were provided
+	none bool
+	// "If-Match: *" - entry should exist, whatever its version is
+	exists bool
+	// expected version of the entry
+	// zero means it should not exist ("If-None-Match: *")
+	version uint64
+}
+
+func parsePrecondition(r *http.Request) (precondition, error) {
+	match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+
+	switch {
+	case match == "" && noneMatch == "":
+		return precondition{none: true}, nil
+	case match != "" && noneMatch != "":
+		return precondition{}, errInvalidPrecondition
+	case noneMatch != "":
+		// comparing against versions other than the current one is not supported
+		if noneMatch != "*" {
+			return precondition{}, errInvalidPrecondition
+		}
+		return precondition{}, nil
+	case match == "*":
+		return precondition{exists: true}, nil
+	}
+
+	version, err := parseETag(match)
+	if err != nil || version == 0 {
+		return precondition{}, errInvalidPrecondition
+	}
+
+	return precondition{version: version}, nil
+}
+
+// entry version as a strong entity tag
+func formatETag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// both quoted and bare versions are accepted
+// weak tags are treated as strong ones
+func parseETag(tag string) (uint64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	tag = strings.TrimSuffix(strings.TrimPrefix(tag, `"`), `"`)
+
+	return strconv.ParseUint(tag, 10, 64)
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sends the message to subscribers of the channel
+// form: channel, message
+// responds with the amount of subscriptions, which have received it
+func (c *Controller) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channel := r.PostFormValue("channel")
+	if channel == "" {
+		http.Error(w, "channel should be provided", http.StatusBadRequest)
+		return
+	}
+
+	received := c.service.Publish(channel, r.PostFormValue("message"))
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, received)
+}
+
+// streams messages of the channels as server-sent events
+// query: channel (repeated), pattern (repeated, e.g. news.*)
+//
+// a subscriber, which doesn't keep up, either gets a "dropped" event with the amount of lost messages
+// or an "error" event, after which the stream is closed, depending on the server settings
+func (c *Controller) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	sub, err := c.service.Subscribe(query["channel"], query["pattern"])
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	var dropped uint64
+
+	for {
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				if err := sub.Err(); err != nil {
+					fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+					rc.Flush()
+				}
+				return
+			}
+
+			// reporting messages, lost since the last report
+			if total := sub.Dropped(); total != dropped {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", total-dropped)
+				dropped = total
+			}
+
+			raw, err := json.Marshal(msg)
+			if err != nil {
+				c.errHandler.Handle(err)
+				return
+			}
+
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", raw)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		case <-c.done:
+			return
+		}
+
+		// client is gone
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -1,13 +1,25 @@
 package router
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// max size of a transaction body
+	maxTxnSize = 1 << 20
+	// max size of a batch body
+	maxBatchSize = 32 << 20
+)
+
 // responsible for routing http-request
 // to the specific handler
 type Router struct {
@@ -25,13 +37,44 @@ func New(service *service.Service, infoLog, errLog *logrus.Logger) *Router {
 	ctrl := &Controller{
 		service:    service,
 		errHandler: errHandler,
+		done:       make(chan struct{}),
 	}
 
+	// entry operations are applied to the namespace, named by the "ns" query param
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/add", ctrl.handleAdd)
-	mux.HandleFunc("/api/v1/set", ctrl.handleSet)
-	mux.HandleFunc("/api/v1/get", ctrl.handleGet)
-	mux.HandleFunc("/api/v1/del", ctrl.handleDel)
+	mux.HandleFunc("/api/v1/namespaces", ctrl.handleNamespaces)
+	mux.HandleFunc("/api/v1/watch", ctrl.handleWatch)
+	mux.HandleFunc("/api/v1/publish", ctrl.handlePublish)
+	mux.HandleFunc("/api/v1/subscribe", ctrl.handleSubscribe)
+	mux.HandleFunc("/api/v1/add", ctrl.scoped((*Controller).handleAdd))
+	mux.HandleFunc("/api/v1/set", ctrl.scoped((*Controller).handleSet))
+	mux.HandleFunc("/api/v1/get", ctrl.scoped((*Controller).handleGet))
+	mux.HandleFunc("/api/v1/del", ctrl.scoped((*Controller).handleDel))
+	mux.HandleFunc("/api/v1/compact", ctrl.scoped((*Controller).handleCompact))
+	mux.HandleFunc("/api/v1/scan", ctrl.scoped((*Controller).handleScan))
+	mux.HandleFunc("/api/v1/txn", ctrl.scoped((*Controller).handleTxn))
+	mux.HandleFunc("/api/v1/batch", ctrl.scoped((*Controller).handleBatch))
+	mux.HandleFunc("/api/v1/incr", ctrl.scoped((*Controller).handleIncr))
+	mux.HandleFunc("/api/v1/decr", ctrl.scoped((*Controller).handleDecr))
+	mux.HandleFunc("/api/v1/incrbyfloat", ctrl.scoped((*Controller).handleIncrByFloat))
+	mux.HandleFunc("/api/v1/list/push", ctrl.scoped((*Controller).handleListPush))
+	mux.HandleFunc("/api/v1/list/pop", ctrl.scoped((*Controller).handleListPop))
+	mux.HandleFunc("/api/v1/list/range", ctrl.scoped((*Controller).handleListRange))
+	mux.HandleFunc("/api/v1/hash/set", ctrl.scoped((*Controller).handleHashSet))
+	mux.HandleFunc("/api/v1/hash/get", ctrl.scoped((*Controller).handleHashGet))
+	mux.HandleFunc("/api/v1/hash/getall", ctrl.scoped((*Controller).handleHashGetAll))
+	mux.HandleFunc("/api/v1/hash/del", ctrl.scoped((*Controller).handleHashDel))
+	mux.HandleFunc("/api/v1/set/add", ctrl.scoped((*Controller).handleSetAdd))
+	mux.HandleFunc("/api/v1/set/rem", ctrl.scoped((*Controller).handleSetRem))
+	mux.HandleFunc("/api/v1/set/members", ctrl.scoped((*Controller).handleSetMembers))
+	mux.HandleFunc("/api/v1/set/inter", ctrl.scoped((*Controller).handleSetInter))
+	mux.HandleFunc("/api/v1/zset/add", ctrl.scoped((*Controller).handleZSetAdd))
+	mux.HandleFunc("/api/v1/zset/rem", ctrl.scoped((*Controller).handleZSetRem))
+	mux.HandleFunc("/api/v1/zset/score", ctrl.scoped((*Controller).handleZSetScore))
+	mux.HandleFunc("/api/v1/zset/rank", ctrl.scoped((*Controller).handleZSetRank))
+	mux.HandleFunc("/api/v1/zset/card", ctrl.scoped((*Controller).handleZSetCard))
+	mux.HandleFunc("/api/v1/zset/range", ctrl.scoped((*Controller).handleZSetRange))
+	mux.HandleFunc("/api/v1/zset/rangebyscore", ctrl.scoped((*Controller).handleZSetRangeByScore))
 
 	return &Router{
 		ctrl: ctrl,
@@ -44,11 +87,19 @@ func (r *Router) Handler() http.Handler {
 	return WithLogging(r.mux, r.log)
 }
 
+// ends open streams, so that they don't hold up the server shutdown
+func (r *Router) Close() {
+	close(r.ctrl.done)
+}
+
 // responsible for parsing and packing http-requests/responses
 // passes received data down to the service layer
 type Controller struct {
 	service    *service.Service
 	errHandler errHandler
+
+	// closed once the router is closed
+	done chan struct{}
 }
 
 func (c *Controller) handleAdd(w http.ResponseWriter, r *http.Request) {
@@ -59,7 +110,23 @@ func (c *Controller) handleAdd(w http.ResponseWriter, r *http.Request) {
 
 	key, value, expiresAt := c.parsePostForm(r)
 
-	if err := c.service.Add(key, value, expiresAt); err != nil {
+	cond, err := parsePrecondition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case cond.none:
+		err = c.service.Add(key, value, expiresAt)
+	case cond.exists:
+		// existing entries can't be added
+		err = storage.ErrVersionMismatch
+	default:
+		err = c.service.CompareAndSwap(key, value, expiresAt, cond.version)
+	}
+
+	if err != nil {
 		status, msg := c.errHandler.Handle(err)
 		http.Error(w, msg, status)
 		return
@@ -76,7 +143,20 @@ func (c *Controller) handleSet(w http.ResponseWriter, r *http.Request) {
 
 	key, value, expiresAt := c.parsePostForm(r)
 
-	if err := c.service.Set(key, value, expiresAt); err != nil {
+	cond, err := parsePrecondition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// set only ever updates existing entries, so "If-Match: *" changes nothing
+	if cond.none || cond.exists {
+		err = c.service.Set(key, value, expiresAt)
+	} else {
+		err = c.service.CompareAndSwap(key, value, expiresAt, cond.version)
+	}
+
+	if err != nil {
 		status, msg := c.errHandler.Handle(err)
 		http.Error(w, msg, status)
 		return
@@ -93,13 +173,15 @@ func (c *Controller) handleGet(w http.ResponseWriter, r *http.Request) {
 
 	key := r.URL.Query().Get("key")
 
-	res, err := c.service.Get(key)
+	res, version, err := c.service.Get(key)
 	if err != nil {
 		status, msg := c.errHandler.Handle(err)
 		http.Error(w, msg, status)
 		return
 	}
 
+	// version is passed back in If-Match for conditional writes
+	w.Header().Set("ETag", formatETag(version))
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, res)
 }
@@ -121,6 +203,263 @@ func (c *Controller) handleDel(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// lists entries in key order, page by page
+// query: prefix, start, end, limit, cursor
+func (c *Controller) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var limit int
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil {
+			http.Error(w, "limit should be an integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	res, err := c.service.Scan(query.Get("prefix"), query.Get("start"), query.Get("end"), query.Get("cursor"), limit)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, res)
+}
+
+// applies a JSON-encoded transaction atomically
+// body: {"conditions": [{"key", "version"}], "ops": [{"op", "key", "value", "expires_at"}]}
+func (c *Controller) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTxnSize))
+	if err != nil {
+		http.Error(w, "transaction is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := c.service.Txn(body); err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// result of a single batch operation
+type batchResult struct {
+	Key    string         `json:"key"`
+	Status int            `json:"status"`
+	Entry  *storage.Entry `json:"entry,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// applies a JSON array of independent operations
+// body: [{"op", "key", "value", "expires_at"}]
+// responds with a result for each operation, in the same order
+func (c *Controller) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchSize))
+	if err != nil {
+		http.Error(w, "batch is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results, err := c.service.Batch(body)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	res := make([]batchResult, len(results))
+	for i, result := range results {
+		res[i] = batchResult{Key: result.Key, Status: http.StatusOK, Entry: result.Entry}
+		if result.Err != nil {
+			res[i].Status, res[i].Error = c.errHandler.Handle(result.Err)
+		}
+	}
+
+	jsonRes, err := json.Marshal(res)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonRes)
+}
+
+// adds "by" (1 by default) to the integer value of the entry
+// form: key, by, expires_at (used only if the entry gets created)
+func (c *Controller) handleIncr(w http.ResponseWriter, r *http.Request) {
+	c.incr(w, r, 1)
+}
+
+// subtracts "by" (1 by default) from the integer value of the entry
+// form: key, by, expires_at (used only if the entry gets created)
+func (c *Controller) handleDecr(w http.ResponseWriter, r *http.Request) {
+	c.incr(w, r, -1)
+}
+
+func (c *Controller) incr(w http.ResponseWriter, r *http.Request, sign int64) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	by := int64(1)
+	if rawBy := r.PostFormValue("by"); rawBy != "" {
+		parsed, err := strconv.ParseInt(rawBy, 10, 64)
+		// min int64 can't be negated
+		if err != nil || parsed == math.MinInt64 {
+			http.Error(w, "by should be a 64-bit integer", http.StatusBadRequest)
+			return
+		}
+		by = parsed
+	}
+
+	res, err := c.service.Incr(r.PostFormValue("key"), sign*by, r.PostFormValue("expires_at"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, res)
+}
+
+// adds floating point "by" to the value of the entry
+// form: key, by, expires_at (used only if the entry gets created)
+func (c *Controller) handleIncrByFloat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	by, err := strconv.ParseFloat(r.PostFormValue("by"), 64)
+	if err != nil || math.IsNaN(by) || math.IsInf(by, 0) {
+		http.Error(w, "by should be a finite number", http.StatusBadRequest)
+		return
+	}
+
+	res, err := c.service.IncrFloat(r.PostFormValue("key"), by, r.PostFormValue("expires_at"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, res)
+}
+
+// GET - lists namespaces
+// POST - creates a namespace, form: name, default_ttl (e.g. 1h30m), max_memory (bytes), eviction_policy
+// DELETE - drops a namespace along with its keys, query: name
+func (c *Controller) handleNamespaces(w http.ResponseWriter, r *http.Request) {
+	var (
+		res string
+		err error
+	)
+
+	switch r.Method {
+	case "GET":
+		res, err = c.service.ListNamespaces()
+	case "POST":
+		err = c.service.CreateNamespace(
+			r.PostFormValue("name"),
+			r.PostFormValue("default_ttl"),
+			r.PostFormValue("max_memory"),
+			r.PostFormValue("eviction_policy"),
+		)
+	case "DELETE":
+		err = c.service.DropNamespace(r.URL.Query().Get("name"))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	if res != "" {
+		writeJSON(w, res)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// runs the handler with the service of the namespace, named by the "ns" query param
+// the namespace is held until the handler returns
+func (c *Controller) scoped(handler func(*Controller, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		svc, release, err := c.service.Namespace(r.URL.Query().Get("ns"))
+		if err != nil {
+			status, msg := c.errHandler.Handle(err)
+			http.Error(w, msg, status)
+			return
+		}
+		defer release()
+
+		scoped := *c
+		scoped.service = svc
+
+		handler(&scoped, w, r)
+	}
+}
+
+// GET - returns progress of the log compaction
+// POST - starts log compaction in the background
+func (c *Controller) handleCompact(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		res, err := c.service.CompactionStatus()
+		if err != nil {
+			status, msg := c.errHandler.Handle(err)
+			http.Error(w, msg, status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, res)
+	case "POST":
+		if err := c.service.Compact(); err != nil {
+			status, msg := c.errHandler.Handle(err)
+			http.Error(w, msg, status)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func (c Controller) parsePostForm(r *http.Request) (key, value, expiresAt string) {
 	key = r.PostFormValue("key")
 	value = r.PostFormValue("value")
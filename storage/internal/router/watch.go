@@ -0,0 +1,125 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// comments are sent to idle streams, so that proxies don't drop them
+const watchHeartbeat = 15 * time.Second
+
+// streams changes of the key as server-sent events,
+// id of each event is its revision, so that a reconnecting client can resume with Last-Event-ID
+// query: ns, key, prefix (watches every key with the prefix, including an empty one),
+// rev (first revision to be delivered, only new changes by default)
+// responds with 410, if the requested revision is out of the kept history
+func (c *Controller) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	key := query.Get("key")
+
+	var prefix bool
+	if rawPrefix := query.Get("prefix"); rawPrefix != "" {
+		parsed, err := strconv.ParseBool(rawPrefix)
+		if err != nil {
+			http.Error(w, "prefix should be a boolean", http.StatusBadRequest)
+			return
+		}
+		prefix = parsed
+	}
+
+	if key == "" && !prefix {
+		http.Error(w, "key should be provided, unless prefix is set", http.StatusBadRequest)
+		return
+	}
+
+	var fromRevision uint64
+	if rawRev := query.Get("rev"); rawRev != "" {
+		parsed, err := strconv.ParseUint(rawRev, 10, 64)
+		if err != nil {
+			http.Error(w, "rev should be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		fromRevision = parsed
+	} else if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		parsed, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID should be a revision", http.StatusBadRequest)
+			return
+		}
+		fromRevision = parsed + 1
+	}
+
+	// namespace is held only while subscribing, so that open streams don't block its drop
+	svc, release, err := c.service.Namespace(query.Get("ns"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	watcher, err := svc.Watch(key, prefix, fromRevision)
+	release()
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+	defer watcher.Stop()
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// event without data only sets the id, so that a client,
+	// which reconnects before any event, doesn't miss the changes in between
+	fmt.Fprintf(w, "id: %d\n\n", watcher.Start())
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case ev, ok := <-watcher.Events():
+			// lagging watchers and watchers of dropped namespaces are stopped by the storage
+			if !ok {
+				if err := watcher.Err(); err != nil {
+					fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+					rc.Flush()
+				}
+				return
+			}
+
+			raw, err := json.Marshal(ev)
+			if err != nil {
+				c.errHandler.Handle(err)
+				return
+			}
+
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Revision, ev.Type, raw)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		case <-c.done:
+			return
+		}
+
+		// client is gone
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// adds members to the sorted set or updates their scores
+// form: key, member and score (repeated in pairs), expires_at (used only if the set gets created)
+// responds with the amount of added members
+func (c *Controller) handleZSetAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, expiresAt := r.PostFormValue("key"), r.PostFormValue("expires_at")
+
+	names, scores := r.PostForm["member"], r.PostForm["score"]
+	if len(names) == 0 || len(names) != len(scores) {
+		http.Error(w, "members and scores should be provided in pairs", http.StatusBadRequest)
+		return
+	}
+
+	members := make([]storage.ZMember, len(names))
+	for i, name := range names {
+		score, err := strconv.ParseFloat(scores[i], 64)
+		if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+			http.Error(w, "score should be a finite number", http.StatusBadRequest)
+			return
+		}
+		members[i] = storage.ZMember{Member: name, Score: score}
+	}
+
+	added, err := c.service.ZSetAdd(key, members, expiresAt)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, added)
+}
+
+// query: key, member (repeated)
+// responds with the amount of removed members
+func (c *Controller) handleZSetRem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	removed, err := c.service.ZSetRem(query.Get("key"), query["member"])
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, removed)
+}
+
+// query: key, member
+func (c *Controller) handleZSetScore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	res, err := c.service.ZSetScore(query.Get("key"), query.Get("member"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, res)
+}
+
+// returns position of the member, starting with 0
+// query: key, member, rev (ranks by descending scores)
+func (c *Controller) handleZSetRank(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	reverse, ok := parseReverse(w, query)
+	if !ok {
+		return
+	}
+
+	rank, err := c.service.ZSetRank(query.Get("key"), query.Get("member"), reverse)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, rank)
+}
+
+// responds with the amount of members in the sorted set
+// query: key
+func (c *Controller) handleZSetCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	card, err := c.service.ZSetCard(r.URL.Query().Get("key"))
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, card)
+}
+
+// returns members with ranks between start and stop, both inclusive
+// query: key, start (0 by default), stop (-1, the last member, by default), rev
+func (c *Controller) handleZSetRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	reverse, ok := parseReverse(w, query)
+	if !ok {
+		return
+	}
+
+	start, stop := 0, -1
+	for name, dst := range map[string]*int{"start": &start, "stop": &stop} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, name+" should be an integer", http.StatusBadRequest)
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	res, err := c.service.ZSetRange(query.Get("key"), start, stop, reverse)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// returns members with scores between min and max, both inclusive
+// query: key, min (-inf by default), max (+inf by default), rev, limit
+func (c *Controller) handleZSetRangeByScore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	reverse, ok := parseReverse(w, query)
+	if !ok {
+		return
+	}
+
+	min, max := math.Inf(-1), math.Inf(1)
+	for name, dst := range map[string]*float64{"min": &min, "max": &max} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(parsed) {
+				http.Error(w, name+" should be a number", http.StatusBadRequest)
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	var limit int
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 0 {
+			http.Error(w, "limit should be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	res, err := c.service.ZSetRangeByScore(query.Get("key"), min, max, reverse, limit)
+	if err != nil {
+		status, msg := c.errHandler.Handle(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// responds with 400, if rev is not a boolean
+func parseReverse(w http.ResponseWriter, query url.Values) (reverse, ok bool) {
+	raw := query.Get("rev")
+	if raw == "" {
+		return false, true
+	}
+
+	reverse, err := strconv.ParseBool(raw)
+	if err != nil {
+		http.Error(w, "rev should be a boolean", http.StatusBadRequest)
+		return false, false
+	}
+
+	return reverse, true
+}
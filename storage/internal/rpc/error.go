@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/pubsub"
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// error -> grpc status code map
+var errCode = map[error]codes.Code{
+	storage.ErrKeyNotFound:         codes.NotFound,
+	storage.ErrKeyAlreadyExists:    codes.AlreadyExists,
+	storage.ErrCompactionRunning:   codes.Aborted,
+	storage.ErrUnsupported:         codes.Unimplemented,
+	storage.ErrOutOfMemory:         codes.ResourceExhausted,
+	storage.ErrEntryTooLarge:       codes.InvalidArgument,
+	service.ErrInvalidCursor:       codes.InvalidArgument,
+	storage.ErrVersionMismatch:     codes.FailedPrecondition,
+	service.ErrInvalidTxn:          codes.InvalidArgument,
+	service.ErrInvalidBatch:        codes.InvalidArgument,
+	service.ErrUnknownOp:           codes.InvalidArgument,
+	storage.ErrNotInteger:          codes.FailedPrecondition,
+	storage.ErrNotFloat:            codes.FailedPrecondition,
+	storage.ErrOverflow:            codes.FailedPrecondition,
+	storage.ErrWrongType:           codes.FailedPrecondition,
+	storage.ErrFieldNotFound:       codes.NotFound,
+	storage.ErrMemberNotFound:      codes.NotFound,
+	storage.ErrNamespaceNotFound:   codes.NotFound,
+	storage.ErrNamespaceExists:     codes.AlreadyExists,
+	storage.ErrInvalidNamespace:    codes.InvalidArgument,
+	storage.ErrDefaultNamespace:    codes.InvalidArgument,
+	storage.ErrRevisionUnavailable: codes.OutOfRange,
+	storage.ErrWatcherLagging:      codes.ResourceExhausted,
+	pubsub.ErrInvalidPattern:       codes.InvalidArgument,
+	pubsub.ErrNoChannels:           codes.InvalidArgument,
+	pubsub.ErrBrokerClosed:         codes.Unavailable,
+	storage.ErrFeedClosed:          codes.Unavailable,
+}
+
+// handles any errors occuring during runtime of the storage
+type errHandler struct {
+	errLog *logrus.Logger
+}
+
+// converts the error into a status, which can be returned by a handler
+func (h errHandler) Handle(err error) error {
+	return status.Error(h.Code(err))
+}
+
+func (h errHandler) Code(err error) (code codes.Code, msg string) {
+	// wrapped errors are mapped by their cause, while the message is kept whole
+	for cause := err; cause != nil; cause = errors.Unwrap(cause) {
+		if code, ok := errCode[cause]; ok {
+			return code, err.Error()
+		}
+	}
+
+	// internal errors are logged, instead of being shown to the client
+	h.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+
+	return codes.Internal, "internal server error"
+}
@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/api/kvspb"
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// serves the gRPC API (see api/kvspb) on top of the service,
+// which is shared with the http router
+type Server struct {
+	kvspb.UnimplementedKVServer
+
+	service    *service.Service
+	errHandler errHandler
+
+	// closed on shutdown to end the streams
+	done chan struct{}
+}
+
+func New(service *service.Service, errLog *logrus.Logger) *Server {
+	return &Server{
+		service:    service,
+		errHandler: errHandler{errLog: errLog},
+		done:       make(chan struct{}),
+	}
+}
+
+// registers the KV service
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	kvspb.RegisterKVServer(registrar, s)
+}
+
+// ends running watches, so that the shutdown doesn't wait for them
+func (s *Server) Close() {
+	close(s.done)
+}
+
+func (s *Server) Get(ctx context.Context, req *kvspb.GetRequest) (*kvspb.GetResponse, error) {
+	svc, release, err := s.service.Namespace(req.Namespace)
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+	defer release()
+
+	entry, err := svc.Read(req.Key)
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+
+	return &kvspb.GetResponse{Entry: toEntry(entry.Key, entry.Value)}, nil
+}
+
+func (s *Server) Put(ctx context.Context, req *kvspb.PutRequest) (*kvspb.PutResponse, error) {
+	svc, release, err := s.service.Namespace(req.Namespace)
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+	defer release()
+
+	expiresAt := fromTimestamp(req.ExpiresAt)
+
+	switch req.Mode {
+	case kvspb.PutMode_PUT_MODE_UPSERT:
+		err = svc.Put(req.Key, req.Value, expiresAt)
+	case kvspb.PutMode_PUT_MODE_CREATE:
+		err = svc.Add(req.Key, req.Value, expiresAt)
+	case kvspb.PutMode_PUT_MODE_UPDATE:
+		err = svc.Set(req.Key, req.Value, expiresAt)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown put mode %v", req.Mode)
+	}
+
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+
+	return &kvspb.PutResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *kvspb.DeleteRequest) (*kvspb.DeleteResponse, error) {
+	svc, release, err := s.service.Namespace(req.Namespace)
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+	defer release()
+
+	if err := svc.Delete(req.Key); err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+
+	return &kvspb.DeleteResponse{}, nil
+}
+
+// operations of a batch by their types
+var batchOps = map[kvspb.BatchOpType]string{
+	kvspb.BatchOpType_BATCH_OP_GET:    "get",
+	kvspb.BatchOpType_BATCH_OP_ADD:    "add",
+	kvspb.BatchOpType_BATCH_OP_SET:    "set",
+	kvspb.BatchOpType_BATCH_OP_PUT:    "put",
+	kvspb.BatchOpType_BATCH_OP_DELETE: "del",
+}
+
+func (s *Server) Batch(ctx context.Context, req *kvspb.BatchRequest) (*kvspb.BatchResponse, error) {
+	svc, release, err := s.service.Namespace(req.Namespace)
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+	defer release()
+
+	ops := make([]service.BatchOp, len(req.Ops))
+	for i, op := range req.Ops {
+		// unknown operations are reported by the service, as it's done for http
+		ops[i] = service.BatchOp{
+			Op:        batchOps[op.Op],
+			Key:       op.Key,
+			Value:     op.Value,
+			ExpiresAt: fromTimestamp(op.ExpiresAt),
+		}
+	}
+
+	results, err := svc.BatchOps(ops)
+	if err != nil {
+		return nil, s.errHandler.Handle(err)
+	}
+
+	res := &kvspb.BatchResponse{Results: make([]*kvspb.BatchResult, len(results))}
+	for i, result := range results {
+		res.Results[i] = &kvspb.BatchResult{Key: result.Key}
+
+		if result.Entry != nil {
+			res.Results[i].Entry = toEntry(result.Entry.Key, result.Entry.Value)
+		}
+
+		if result.Err != nil {
+			code, msg := s.errHandler.Code(result.Err)
+			res.Results[i].Code, res.Results[i].Error = uint32(code), msg
+		}
+	}
+
+	return res, nil
+}
+
+func toEntry(key storage.Key, val storage.Value) *kvspb.Entry {
+	entry := &kvspb.Entry{
+		Key:       string(key),
+		Data:      val.Data,
+		Type:      string(val.Type),
+		UpdatedAt: timestamppb.New(val.UpdatedAt),
+		Version:   val.Version,
+	}
+
+	if !val.ExpiresAt.IsZero() {
+		entry.ExpiresAt = timestamppb.New(val.ExpiresAt)
+	}
+
+	return entry
+}
+
+// converts the timestamp into the format of the service
+// unset timestamp stands for no expiration time
+func fromTimestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+
+	return ts.AsTime().Format(time.RFC3339Nano)
+}
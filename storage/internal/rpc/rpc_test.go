@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/api/kvspb"
+	"github.com/cutlery47/key-value-storage/storage/internal/service"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// serves a fresh storage over an in-memory listener
+func serve(t *testing.T) kvspb.KVClient {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	spaces, err := storage.OpenNamespaces("memory", storage.EngineConfig{
+		Path:    filepath.Join(t.TempDir(), "data"),
+		InfoLog: log,
+		ErrLog:  log,
+	}, storage.NamespaceConfig{DefaultTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := service.New(spaces)
+	rpcServ := New(srv, log)
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServ := grpc.NewServer()
+	rpcServ.Register(grpcServ)
+	go grpcServ.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		rpcServ.Close()
+		grpcServ.Stop()
+		srv.Close()
+		spaces.Close()
+	})
+
+	return kvspb.NewKVClient(conn)
+}
+
+func expectCode(t *testing.T, op string, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Fatalf("%v: got %v (%v), want %v", op, got, err, want)
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	client := serve(t)
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, &kvspb.GetRequest{Key: "k"})
+	expectCode(t, "Get", err, codes.NotFound)
+
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	_, err = client.Put(ctx, &kvspb.PutRequest{Key: "k", Value: "v", ExpiresAt: timestamppb.New(expiresAt), Mode: kvspb.PutMode_PUT_MODE_CREATE})
+	expectCode(t, "Put", err, codes.OK)
+
+	res, err := client.Get(ctx, &kvspb.GetRequest{Key: "k"})
+	expectCode(t, "Get", err, codes.OK)
+	if entry := res.Entry; entry.Key != "k" || entry.Data != "v" || entry.Type != string(storage.TypeString) ||
+		!entry.ExpiresAt.AsTime().Equal(expiresAt) || entry.Version == 0 {
+		t.Fatalf("Get: %v", entry)
+	}
+
+	_, err = client.Put(ctx, &kvspb.PutRequest{Key: "k", Value: "v", Mode: kvspb.PutMode_PUT_MODE_CREATE})
+	expectCode(t, "Put", err, codes.AlreadyExists)
+	_, err = client.Put(ctx, &kvspb.PutRequest{Key: "other", Value: "v", Mode: kvspb.PutMode_PUT_MODE_UPDATE})
+	expectCode(t, "Put", err, codes.NotFound)
+	_, err = client.Put(ctx, &kvspb.PutRequest{Key: "k", Value: "v", Mode: kvspb.PutMode(42)})
+	expectCode(t, "Put", err, codes.InvalidArgument)
+
+	// updated keys keep their ttl
+	_, err = client.Put(ctx, &kvspb.PutRequest{Key: "k", Value: "v2", Mode: kvspb.PutMode_PUT_MODE_UPDATE})
+	expectCode(t, "Put", err, codes.OK)
+
+	res, err = client.Get(ctx, &kvspb.GetRequest{Key: "k"})
+	expectCode(t, "Get", err, codes.OK)
+	if res.Entry.Data != "v2" || !res.Entry.ExpiresAt.AsTime().Equal(expiresAt) {
+		t.Fatalf("Get: %v", res.Entry)
+	}
+
+	_, err = client.Delete(ctx, &kvspb.DeleteRequest{Key: "k"})
+	expectCode(t, "Delete", err, codes.OK)
+	_, err = client.Delete(ctx, &kvspb.DeleteRequest{Key: "k"})
+	expectCode(t, "Delete", err, codes.NotFound)
+
+	_, err = client.Get(ctx, &kvspb.GetRequest{Namespace: "missing", Key: "k"})
+	expectCode(t, "Get", err, codes.NotFound)
+}
+
+func TestBatch(t *testing.T) {
+	client := serve(t)
+	ctx := context.Background()
+
+	res, err := client.Batch(ctx, &kvspb.BatchRequest{Ops: []*kvspb.BatchOp{
+		{Op: kvspb.BatchOpType_BATCH_OP_ADD, Key: "a", Value: "1"},
+		{Op: kvspb.BatchOpType_BATCH_OP_ADD, Key: "a", Value: "2"},
+		{Op: kvspb.BatchOpType_BATCH_OP_SET, Key: "b", Value: "3"},
+		{Op: kvspb.BatchOpType_BATCH_OP_PUT, Key: "b", Value: "4"},
+		{Op: kvspb.BatchOpType_BATCH_OP_GET, Key: "a"},
+		{Op: kvspb.BatchOpType_BATCH_OP_DELETE, Key: "b"},
+		{Op: kvspb.BatchOpType_BATCH_OP_GET, Key: "b"},
+	}})
+	expectCode(t, "Batch", err, codes.OK)
+
+	// failed operations don't fail the rest
+	want := []codes.Code{codes.OK, codes.AlreadyExists, codes.NotFound, codes.OK, codes.OK, codes.OK, codes.NotFound}
+	if len(res.Results) != len(want) {
+		t.Fatalf("Batch: %v results, want %v", len(res.Results), len(want))
+	}
+	for i, result := range res.Results {
+		if codes.Code(result.Code) != want[i] {
+			t.Fatalf("Batch op %v: got %v (%v), want %v", i, codes.Code(result.Code), result.Error, want[i])
+		}
+	}
+
+	if entry := res.Results[4].Entry; entry == nil || entry.Data != "1" {
+		t.Fatalf("Batch get: %v", entry)
+	}
+
+	// unknown operations are reported along with the rest
+	res, err = client.Batch(ctx, &kvspb.BatchRequest{Ops: []*kvspb.BatchOp{{Op: kvspb.BatchOpType(42), Key: "a"}}})
+	expectCode(t, "Batch", err, codes.OK)
+	if codes.Code(res.Results[0].Code) != codes.InvalidArgument {
+		t.Fatalf("Batch op: got %v, want %v", codes.Code(res.Results[0].Code), codes.InvalidArgument)
+	}
+}
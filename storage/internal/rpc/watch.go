@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"github.com/cutlery47/key-value-storage/storage/api/kvspb"
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var eventTypes = map[storage.EventType]kvspb.EventType{
+	storage.EventPut:    kvspb.EventType_EVENT_TYPE_PUT,
+	storage.EventDelete: kvspb.EventType_EVENT_TYPE_DELETE,
+	storage.EventExpire: kvspb.EventType_EVENT_TYPE_EXPIRE,
+	storage.EventEvict:  kvspb.EventType_EVENT_TYPE_EVICT,
+}
+
+// streams changes of the key
+// the first response carries the revision, after which events are delivered
+func (s *Server) Watch(req *kvspb.WatchRequest, stream grpc.ServerStreamingServer[kvspb.WatchResponse]) error {
+	if req.Key == "" && !req.Prefix {
+		return status.Error(codes.InvalidArgument, "key should be provided, unless prefix is set")
+	}
+
+	// namespace is held only while subscribing, so that open streams don't block its drop
+	svc, release, err := s.service.Namespace(req.Namespace)
+	if err != nil {
+		return s.errHandler.Handle(err)
+	}
+
+	watcher, err := svc.Watch(req.Key, req.Prefix, req.FromRevision)
+	release()
+	if err != nil {
+		return s.errHandler.Handle(err)
+	}
+	defer watcher.Stop()
+
+	if err := stream.Send(&kvspb.WatchResponse{Created: true, StartRevision: watcher.Start()}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ev, ok := <-watcher.Events():
+			// lagging watchers and watchers of dropped namespaces are stopped by the storage
+			if !ok {
+				if err := watcher.Err(); err != nil {
+					return s.errHandler.Handle(err)
+				}
+				return nil
+			}
+
+			res := &kvspb.Event{
+				Revision: ev.Revision,
+				Type:     eventTypes[ev.Type],
+				Key:      string(ev.Key),
+				At:       timestamppb.New(ev.At),
+			}
+			if ev.Value != nil {
+				res.Entry = toEntry(ev.Key, *ev.Value)
+			}
+
+			if err := stream.Send(&kvspb.WatchResponse{Event: res}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
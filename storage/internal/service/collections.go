@@ -0,0 +1,269 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+func (s *Service) collections() (*storage.Collections, error) {
+	coll, ok := storage.CollectionsOf(s.storage)
+	if !ok {
+		return nil, storage.ErrUnsupported
+	}
+
+	return coll, nil
+}
+
+// pushes values to the head (left) or the tail of the list
+// returns the length of the list
+func (s *Service) ListPush(key string, values []string, left bool, expiresAt string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	timeExpiresAt, err := s.expiration(expiresAt, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.Push(storage.Key(key), values, left, timeExpiresAt)
+}
+
+// pops up to count values from the head (left) or the tail of the list
+// returns them as a JSON array
+func (s *Service) ListPop(key string, count int, left bool) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	values, err := coll.Pop(storage.Key(key), count, left)
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(values)
+}
+
+func (s *Service) ListRange(key string, start, stop int) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	values, err := coll.Range(storage.Key(key), start, stop)
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(values)
+}
+
+// returns the amount of created fields
+func (s *Service) HashSet(key string, fields map[string]string, expiresAt string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	timeExpiresAt, err := s.expiration(expiresAt, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.HSet(storage.Key(key), fields, timeExpiresAt)
+}
+
+func (s *Service) HashGet(key, field string) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	return coll.HGet(storage.Key(key), field)
+}
+
+// returns every field of the hash as a JSON object
+func (s *Service) HashGetAll(key string) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := coll.HGetAll(storage.Key(key))
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(hash)
+}
+
+// returns the amount of removed fields
+func (s *Service) HashDel(key string, fields []string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.HDel(storage.Key(key), fields)
+}
+
+// returns the amount of added members
+func (s *Service) SetAdd(key string, members []string, expiresAt string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	timeExpiresAt, err := s.expiration(expiresAt, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.SAdd(storage.Key(key), members, timeExpiresAt)
+}
+
+// returns the amount of removed members
+func (s *Service) SetRem(key string, members []string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.SRem(storage.Key(key), members)
+}
+
+// returns members of the set as a JSON array
+func (s *Service) SetMembers(key string) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	members, err := coll.SMembers(storage.Key(key))
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(members)
+}
+
+// returns members, present in every set, as a JSON array
+func (s *Service) SetInter(keys []string) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	storageKeys := make([]storage.Key, len(keys))
+	for i, key := range keys {
+		storageKeys[i] = storage.Key(key)
+	}
+
+	members, err := coll.SInter(storageKeys)
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(members)
+}
+
+// adds members to the sorted set or updates their scores
+// returns the amount of added members
+func (s *Service) ZSetAdd(key string, members []storage.ZMember, expiresAt string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	timeExpiresAt, err := s.expiration(expiresAt, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.ZAdd(storage.Key(key), members, timeExpiresAt)
+}
+
+// returns the amount of removed members
+func (s *Service) ZSetRem(key string, members []string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.ZRem(storage.Key(key), members)
+}
+
+func (s *Service) ZSetScore(key, member string) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	score, err := coll.ZScore(storage.Key(key), member)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatFloat(score, 'f', -1, 64), nil
+}
+
+func (s *Service) ZSetRank(key, member string, reverse bool) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.ZRank(storage.Key(key), member, reverse)
+}
+
+func (s *Service) ZSetCard(key string) (int, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.ZCard(storage.Key(key))
+}
+
+// returns members with ranks between start and stop as a JSON array
+func (s *Service) ZSetRange(key string, start, stop int, reverse bool) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	members, err := coll.ZRange(storage.Key(key), start, stop, reverse)
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(members)
+}
+
+// returns members with scores between min and max as a JSON array
+func (s *Service) ZSetRangeByScore(key string, min, max float64, reverse bool, limit int) (string, error) {
+	coll, err := s.collections()
+	if err != nil {
+		return "", err
+	}
+
+	members, err := coll.ZRangeByScore(storage.Key(key), min, max, reverse, limit)
+	if err != nil {
+		return "", err
+	}
+
+	return marshal(members)
+}
+
+func marshal(v any) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", storage.ErrJSONMarshall
+	}
+
+	return string(raw), nil
+}
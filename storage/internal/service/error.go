@@ -0,0 +1,10 @@
+package service
+
+import "errors"
+
+var (
+	ErrInvalidCursor = errors.New("provided cursor is invalid")
+	ErrInvalidTxn    = errors.New("provided transaction is invalid")
+	ErrInvalidBatch  = errors.New("provided batch is invalid or has more than 10000 operations")
+	ErrUnknownOp     = errors.New("operation is not supported")
+)
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// prefix of channels, which removals of keys are published to:
+// __keyevent__:<namespace>:<reason>
+const keyspaceChannel = "__keyevent__"
+
+// reasons of removals
+const (
+	reasonDeleted = "deleted"
+	reasonExpired = "expired"
+	reasonEvicted = "evicted"
+)
+
+// amount of removals, waiting to be published
+const defaultKeyspaceQueue = 4096
+
+// notification about a removed key
+type keyspaceEvent struct {
+	Namespace string    `json:"namespace"`
+	Key       string    `json:"key"`
+	Reason    string    `json:"reason"`
+	At        time.Time `json:"at"`
+	// amount of notifications, dropped right before this one
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// removals are received under locks of the storage, so they are only queued there
+// and get published by a separate goroutine
+// once the queue is full, new removals are dropped and counted
+type keyspaceQueue struct {
+	events  chan keyspaceEvent
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+func newKeyspaceQueue(size int) *keyspaceQueue {
+	return &keyspaceQueue{
+		events: make(chan keyspaceEvent, size),
+		done:   make(chan struct{}),
+	}
+}
+
+// queues removals of keys to be published to the keyspace channels,
+// so that consumers can subscribe to them with a pattern, e.g. __keyevent__:*:expired
+// writes are not published, they are delivered by watches
+//
+// called under the feed lock, so it never blocks
+func (s *Service) notifyKeyspace(namespace string, ev storage.Event) {
+	var reason string
+
+	switch ev.Type {
+	case storage.EventDelete:
+		reason = reasonDeleted
+	case storage.EventExpire:
+		reason = reasonExpired
+	case storage.EventEvict:
+		reason = reasonEvicted
+	default:
+		return
+	}
+
+	select {
+	case s.keyspace.events <- keyspaceEvent{Namespace: namespace, Key: string(ev.Key), Reason: reason, At: ev.At}:
+	default:
+		s.keyspace.dropped.Add(1)
+	}
+}
+
+// publishes queued removals, until the service is closed
+func (s *Service) publishKeyspace() {
+	// total amount of drops, already reported
+	var reported uint64
+
+	for {
+		select {
+		case <-s.keyspace.done:
+			return
+		case ev := <-s.keyspace.events:
+			dropped := s.keyspace.dropped.Load()
+			ev.Dropped, reported = dropped-reported, dropped
+
+			raw, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+
+			s.broker.Publish(keyspaceChannel+":"+ev.Namespace+":"+ev.Reason, string(raw))
+		}
+	}
+}
+
+// returns the amount of removals, which were not published, since the queue was full
+func (s *Service) KeyspaceDropped() uint64 {
+	return s.keyspace.dropped.Load()
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// settings of a namespace, as they are returned to the client
+type namespaceInfo struct {
+	Name           string                 `json:"name"`
+	DefaultTTL     string                 `json:"default_ttl"`
+	MaxMemory      int64                  `json:"max_memory"`
+	EvictionPolicy storage.EvictionPolicy `json:"eviction_policy,omitempty"`
+}
+
+// creates an empty namespace
+// defaultTTL is a duration (e.g. 1h30m), empty one means that entries don't expire by default
+// maxMemory is a limit in bytes, empty one means no limit
+func (s *Service) CreateNamespace(name, defaultTTL, maxMemory, evictionPolicy string) error {
+	conf := storage.NamespaceConfig{
+		Name:           name,
+		EvictionPolicy: storage.EvictionPolicy(evictionPolicy),
+	}
+
+	if defaultTTL != "" {
+		parsed, err := time.ParseDuration(defaultTTL)
+		if err != nil {
+			return fmt.Errorf("%w: default ttl should be a duration", storage.ErrInvalidNamespace)
+		}
+		conf.DefaultTTL = parsed
+	}
+
+	if maxMemory != "" {
+		parsed, err := strconv.ParseInt(maxMemory, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: memory limit should be an amount of bytes", storage.ErrInvalidNamespace)
+		}
+		conf.MaxMemory = parsed
+	}
+
+	return s.spaces.Create(conf)
+}
+
+// returns settings of every namespace as a JSON array
+func (s *Service) ListNamespaces() (string, error) {
+	list := []namespaceInfo{}
+	for _, conf := range s.spaces.List() {
+		list = append(list, namespaceInfo{
+			Name:           conf.Name,
+			DefaultTTL:     conf.DefaultTTL.String(),
+			MaxMemory:      conf.MaxMemory,
+			EvictionPolicy: conf.EvictionPolicy,
+		})
+	}
+
+	return marshal(list)
+}
+
+// removes the namespace along with every key in it
+func (s *Service) DropNamespace(name string) error {
+	return s.spaces.Drop(name)
+}
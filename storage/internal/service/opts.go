@@ -0,0 +1,34 @@
+package service
+
+import (
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/pubsub"
+)
+
+// Option configuration pattern
+type Option func(*Service)
+
+// ttl of counters, created by an increment without explicit expiration time
+// zero ttl means that such counters never expire
+func WithCounterTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		s.counterTTL = ttl
+	}
+}
+
+// sets the broker of pub/sub channels
+// by default a broker with the default settings is used
+func WithBroker(broker *pubsub.Broker) Option {
+	return func(s *Service) {
+		s.broker = broker
+	}
+}
+
+// sets the amount of removals of keys, which may wait to be published to the keyspace channels
+// removals are dropped, while the queue is full
+func WithKeyspaceQueue(size int) Option {
+	return func(s *Service) {
+		s.keyspace = newKeyspaceQueue(max(size, 1))
+	}
+}
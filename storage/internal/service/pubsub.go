@@ -0,0 +1,16 @@
+package service
+
+import "github.com/cutlery47/key-value-storage/storage/internal/pubsub"
+
+// sends the message to subscribers of the channel
+// returns the amount of subscriptions, which have received it
+//
+// channels are not bound to namespaces, so every service shares them
+func (s *Service) Publish(channel, message string) int {
+	return s.broker.Publish(channel, message)
+}
+
+// subscribes to the channels and to every channel, matching one of the patterns
+func (s *Service) Subscribe(channels, patterns []string) (*pubsub.Subscription, error) {
+	return s.broker.Subscribe(channels, patterns)
+}
@@ -1,31 +1,104 @@
 package service
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
 	"time"
 
+	"github.com/cutlery47/key-value-storage/storage/internal/pubsub"
 	"github.com/cutlery47/key-value-storage/storage/internal/storage"
 )
 
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+	maxBatchOps      = 10000
+)
+
 // handles and transforms incoming request data
 // passes entries down to the storage layer
+//
+// operations are applied to a single namespace,
+// services of other namespaces are provided by Namespace
 type Service struct {
 	storage storage.Storage
+	feed    *storage.Feed
+	spaces  *storage.Namespaces
+	broker  *pubsub.Broker
+	// removals of keys, waiting to be published
+	keyspace *keyspaceQueue
+
+	// ttl of entries, created without one
+	defaultTTL time.Duration
+	// ttl of counters, created by increments
+	counterTTL time.Duration
+}
+
+// returns the service of the default namespace
+func New(spaces *storage.Namespaces, opts ...Option) *Service {
+	// default namespace is never dropped, so it doesn't need to be held
+	space, release, _ := spaces.Acquire(storage.DefaultNamespace)
+	release()
+
+	s := &Service{
+		storage:    space.Storage,
+		feed:       space.Feed,
+		spaces:     spaces,
+		broker:     pubsub.New(),
+		keyspace:   newKeyspaceQueue(defaultKeyspaceQueue),
+		defaultTTL: space.Config.DefaultTTL,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.publishKeyspace()
+	spaces.Notify(s.notifyKeyspace)
+
+	return s
 }
 
-func New(storage storage.Storage) *Service {
-	return &Service{
-		storage: storage,
+// stops publishing removals of keys
+// removals, which are still queued, are not published
+func (s *Service) Close() {
+	close(s.keyspace.done)
+}
+
+// returns the service of the namespace, empty name stands for the default one
+// the namespace can't be dropped, until the returned release function is called
+func (s *Service) Namespace(name string) (*Service, func(), error) {
+	space, release, err := s.spaces.Acquire(name)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	scoped := *s
+	scoped.storage = space.Storage
+	scoped.feed = space.Feed
+	scoped.defaultTTL = space.Config.DefaultTTL
+
+	return &scoped, release, nil
 }
 
 func (s *Service) Add(key, value, expiresAt string) error {
+	timeExpiresAt, err := s.expiration(expiresAt, true)
+	if err != nil {
+		return err
+	}
+
+	entry := storage.EntryFromData(key, value, time.Now(), timeExpiresAt)
+
+	return s.storage.Create(entry)
+}
+
+func (s *Service) Set(key, value, expiresAt string) error {
 	var timeExpiresAt time.Time
-	timeUpdatedAt := time.Now()
+	timeUpdateddAt := time.Now()
 
-	// if ttl was not provided - set default to 24 hours
-	if len(expiresAt) == 0 {
-		timeExpiresAt = time.Now().Add(time.Hour * 24)
-	} else {
+	if len(expiresAt) != 0 {
 		parsed, err := time.Parse(time.RFC3339, expiresAt)
 		if err != nil {
 			return err
@@ -33,15 +106,38 @@ func (s *Service) Add(key, value, expiresAt string) error {
 		timeExpiresAt = parsed
 	}
 
-	entry := storage.EntryFromData(key, value, timeUpdatedAt, timeExpiresAt)
+	entry := storage.EntryFromData(key, value, timeUpdateddAt, timeExpiresAt)
 
-	return s.storage.Create(entry)
+	return s.storage.Update(entry)
 }
 
-func (s *Service) Set(key, value, expiresAt string) error {
-	var timeExpiresAt time.Time
-	timeUpdateddAt := time.Now()
+// adds the entry or, if it already exists, sets it
+func (s *Service) Put(key, value, expiresAt string) error {
+	for {
+		err := s.Add(key, value, expiresAt)
+		if !errors.Is(err, storage.ErrKeyAlreadyExists) {
+			return err
+		}
+
+		// entry might be removed in between
+		err = s.Set(key, value, expiresAt)
+		if !errors.Is(err, storage.ErrKeyNotFound) {
+			return err
+		}
+	}
+}
+
+// writes the entry along with the exact ttl: empty expiresAt means that the entry never expires
+// unlike Add, Set and Put, neither the default ttl of the namespace, nor the current ttl of the entry is applied,
+// unless opts.KeepTTL is set
+// flags are opaque to the storage and are kept along with the value
+func (s *Service) Write(key, value, expiresAt string, flags uint32, opts storage.PutOptions) error {
+	writer, ok := s.storage.(storage.Writer)
+	if !ok {
+		return storage.ErrUnsupported
+	}
 
+	var timeExpiresAt time.Time
 	if len(expiresAt) != 0 {
 		parsed, err := time.Parse(time.RFC3339, expiresAt)
 		if err != nil {
@@ -50,25 +146,333 @@ func (s *Service) Set(key, value, expiresAt string) error {
 		timeExpiresAt = parsed
 	}
 
-	entry := storage.EntryFromData(key, value, timeUpdateddAt, timeExpiresAt)
+	entry := storage.EntryFromData(key, value, time.Now(), timeExpiresAt)
+	entry.Value.Flags = flags
 
-	return s.storage.Update(entry)
+	return writer.Put(entry, opts)
+}
+
+// sets a new expiration time of the entry, keeping its value
+func (s *Service) Expire(key, expiresAt string) error {
+	writer, ok := s.storage.(storage.Writer)
+	if !ok {
+		return storage.ErrUnsupported
+	}
+
+	timeExpiresAt, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.SetTTL(storage.Key(key), timeExpiresAt)
+
+	return err
+}
+
+// removes the ttl of the entry
+// returns false if the entry doesn't expire anyway
+func (s *Service) Persist(key string) (bool, error) {
+	writer, ok := s.storage.(storage.Writer)
+	if !ok {
+		return false, storage.ErrUnsupported
+	}
+
+	return writer.SetTTL(storage.Key(key), time.Time{})
+}
+
+// returns the entry as it is kept by the storage
+func (s *Service) Read(key string) (storage.Entry, error) {
+	return s.storage.Read(storage.Key(key))
 }
 
-func (s *Service) Get(key string) (string, error) {
+// returns the entry along with its version
+func (s *Service) Get(key string) (string, uint64, error) {
 	entry, err := s.storage.Read(storage.Key(key))
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	jsonEntry, err := entry.ToJSON()
+	if err != nil {
+		return "", 0, err
+	}
+
+	return string(jsonEntry), entry.Value.Version, nil
+}
+
+// writes the entry, only if its current version matches the expected one
+// zero expected version means the entry should not exist, so it gets created
+func (s *Service) CompareAndSwap(key, value, expiresAt string, expected uint64) error {
+	swapper, ok := s.storage.(storage.Swapper)
+	if !ok {
+		return storage.ErrUnsupported
+	}
+
+	timeExpiresAt, err := s.expiration(expiresAt, expected == 0)
+	if err != nil {
+		return err
+	}
+
+	entry := storage.EntryFromData(key, value, time.Now(), timeExpiresAt)
+
+	return swapper.CompareAndSwap(entry.Key, expected, entry.Value)
+}
+
+// transaction, as it is received from the client
+type txnRequest struct {
+	Conditions []storage.TxnCondition `json:"conditions"`
+	Ops        []struct {
+		Op        storage.TxnOpType `json:"op"`
+		Key       string            `json:"key"`
+		Value     string            `json:"value"`
+		ExpiresAt string            `json:"expires_at"`
+	} `json:"ops"`
+}
+
+// applies every operation of the JSON-encoded transaction, or none of them
+func (s *Service) Txn(rawTxn []byte) error {
+	transactor, ok := s.storage.(storage.Transactor)
+	if !ok {
+		return storage.ErrUnsupported
+	}
+
+	var req txnRequest
+	if err := json.Unmarshal(rawTxn, &req); err != nil {
+		return ErrInvalidTxn
+	}
+
+	txn := storage.Txn{Conditions: req.Conditions}
+	for _, op := range req.Ops {
+		if op.Op != storage.TxnAdd && op.Op != storage.TxnSet && op.Op != storage.TxnDel {
+			return ErrInvalidTxn
+		}
+
+		// added entries get the same default ttl as in Add
+		timeExpiresAt, err := s.expiration(op.ExpiresAt, op.Op == storage.TxnAdd)
+		if err != nil {
+			return ErrInvalidTxn
+		}
+
+		entry := storage.EntryFromData(op.Key, op.Value, time.Now(), timeExpiresAt)
+		txn.Ops = append(txn.Ops, storage.TxnOp{Op: op.Op, Key: entry.Key, Value: entry.Value})
+	}
+
+	return transactor.Txn(txn)
+}
+
+// single operation of a batch
+// op is one of: get, add, set, put (add or set), del
+type BatchOp struct {
+	Op        string `json:"op"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// outcome of a batch operation
+type BatchResult struct {
+	Key string
+	// set for successful get operations
+	Entry *storage.Entry
+	Err   error
+}
+
+// applies every operation of the JSON-encoded batch one by one
+// operations are independent: a failed one doesn't affect the rest
+func (s *Service) Batch(rawOps []byte) ([]BatchResult, error) {
+	var ops []BatchOp
+	if err := json.Unmarshal(rawOps, &ops); err != nil {
+		return nil, ErrInvalidBatch
+	}
+
+	return s.BatchOps(ops)
+}
+
+// same as Batch, but for already decoded operations
+func (s *Service) BatchOps(ops []BatchOp) ([]BatchResult, error) {
+	if len(ops) > maxBatchOps {
+		return nil, ErrInvalidBatch
+	}
+
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i].Key = op.Key
+
+		switch op.Op {
+		case "get":
+			entry, err := s.storage.Read(storage.Key(op.Key))
+			if err == nil {
+				results[i].Entry = &entry
+			}
+			results[i].Err = err
+		case "add":
+			results[i].Err = s.Add(op.Key, op.Value, op.ExpiresAt)
+		case "set":
+			results[i].Err = s.Set(op.Key, op.Value, op.ExpiresAt)
+		case "put":
+			results[i].Err = s.Put(op.Key, op.Value, op.ExpiresAt)
+		case "del":
+			results[i].Err = s.Delete(op.Key)
+		default:
+			results[i].Err = ErrUnknownOp
+		}
+	}
+
+	return results, nil
+}
+
+// parses expiration time of an entry
+// if it is not provided, created entries get the default ttl of the namespace, updated ones keep their ttl
+func (s *Service) expiration(expiresAt string, create bool) (time.Time, error) {
+	if len(expiresAt) != 0 {
+		return time.Parse(time.RFC3339, expiresAt)
+	}
+
+	if create && s.defaultTTL > 0 {
+		return time.Now().Add(s.defaultTTL), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// atomically adds delta to the integer value of the entry
+// returns the resulting value
+func (s *Service) Incr(key string, delta int64, expiresAt string) (string, error) {
+	counter, ok := s.storage.(storage.Counter)
+	if !ok {
+		return "", storage.ErrUnsupported
+	}
+
+	timeExpiresAt, err := s.counterExpiration(expiresAt)
 	if err != nil {
 		return "", err
 	}
 
-	return string(jsonEntry), nil
+	res, err := counter.IncrBy(storage.Key(key), delta, timeExpiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(res, 10), nil
+}
+
+// atomically adds delta to the floating point value of the entry
+// returns the resulting value
+func (s *Service) IncrFloat(key string, delta float64, expiresAt string) (string, error) {
+	counter, ok := s.storage.(storage.Counter)
+	if !ok {
+		return "", storage.ErrUnsupported
+	}
+
+	timeExpiresAt, err := s.counterExpiration(expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := counter.IncrByFloat(storage.Key(key), delta, timeExpiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatFloat(res, 'f', -1, 64), nil
+}
+
+// expiration time of a counter, in case the increment creates it
+func (s *Service) counterExpiration(expiresAt string) (time.Time, error) {
+	if len(expiresAt) != 0 {
+		return time.Parse(time.RFC3339, expiresAt)
+	}
+
+	if s.counterTTL > 0 {
+		return time.Now().Add(s.counterTTL), nil
+	}
+
+	return time.Time{}, nil
 }
 
 func (s *Service) Delete(key string) error {
 	return s.storage.Delete(storage.Key(key))
 }
+
+// starts log compaction, if storage supports it
+func (s *Service) Compact() error {
+	compactor, ok := s.storage.(storage.Compactor)
+	if !ok {
+		return storage.ErrUnsupported
+	}
+
+	return compactor.Compact()
+}
+
+func (s *Service) CompactionStatus() (string, error) {
+	compactor, ok := s.storage.(storage.Compactor)
+	if !ok {
+		return "", storage.ErrUnsupported
+	}
+
+	jsonStatus, err := json.Marshal(compactor.CompactionStatus())
+	if err != nil {
+		return "", storage.ErrJSONMarshall
+	}
+
+	return string(jsonStatus), nil
+}
+
+// single page of scan results
+type scanPage struct {
+	Entries []storage.Entry `json:"entries"`
+	// should be passed to get the next page
+	// empty, if there are no more entries
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// returns a page of entries in key order
+// range is narrowed down to keys with the prefix, if it is provided
+func (s *Service) Scan(prefix, start, end, cursor string, limit int) (string, error) {
+	scanner, ok := s.storage.(storage.Scanner)
+	if !ok {
+		return "", storage.ErrUnsupported
+	}
+
+	if limit <= 0 {
+		limit = defaultScanLimit
+	}
+	limit = min(limit, maxScanLimit)
+
+	from, to := storage.Key(start), storage.Key(end)
+
+	if prefix != "" {
+		from = max(from, storage.Key(prefix))
+		if prefixEnd := storage.PrefixEnd(storage.Key(prefix)); to == "" || (prefixEnd != "" && prefixEnd < to) {
+			to = prefixEnd
+		}
+	}
+
+	if cursor != "" {
+		last, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return "", ErrInvalidCursor
+		}
+		// next page starts right after the last returned key
+		from = max(from, storage.Key(last)+"\x00")
+	}
+
+	// fetching one extra entry to find out whether there's a next page
+	entries, err := scanner.Scan(from, to, limit+1)
+	if err != nil {
+		return "", err
+	}
+
+	page := scanPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.Cursor = base64.RawURLEncoding.EncodeToString([]byte(entries[limit-1].Key))
+	}
+
+	jsonPage, err := json.Marshal(page)
+	if err != nil {
+		return "", storage.ErrJSONMarshall
+	}
+
+	return string(jsonPage), nil
+}
@@ -0,0 +1,10 @@
+package service
+
+import "github.com/cutlery47/key-value-storage/storage/internal/storage"
+
+// subscribes to changes of the key or, if prefix is set, of every key with such prefix
+// zero fromRevision means only new changes, otherwise changes are replayed starting with it
+// the watch keeps going after the namespace is released, until it's stopped or the namespace is dropped
+func (s *Service) Watch(key string, prefix bool, fromRevision uint64) (*storage.Watcher, error) {
+	return s.feed.Watch(storage.Key(key), prefix, fromRevision)
+}
@@ -0,0 +1,1031 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// crc(4) + flags(1) + expires_at(8) + updated_at(8) + version(8) + key length(4) + data length(4)
+	bitcaskHeaderSize = 37
+	// key length(4) + offset(8) + record size(4) + expires_at(8) + version(8)
+	bitcaskHintHeaderSize = 32
+
+	bitcaskTombstone byte = 1
+	// data starts with 4 bytes of client flags of the value
+	// set only for values with non-zero flags, so that the rest of the records keep the same layout
+	bitcaskClientFlags byte = 2
+
+	// records are never larger, so that a corrupted header can't make a huge allocation
+	bitcaskMaxRecordSize = 1 << 30
+
+	defaultBitcaskFileSize      = 64 << 20
+	defaultBitcaskMergeInterval = 10 * time.Minute
+	// share of dead bytes in immutable segments, after which they are merged
+	defaultBitcaskMergeRatio = 0.5
+)
+
+// log-structured storage impl (bitcask-style):
+// values are appended to segment files <base>.seg.<id>,
+// while only the key directory with value locations is kept in memory,
+// so each read takes a single seek
+//
+// old segments get merged in the background, dropping overwritten,
+// deleted and expired values
+type BitcaskStorage struct {
+	// guards keydir and files
+	// reads hold it for the whole disk read, so that merge can't close a file beneath them
+	mu     sync.RWMutex
+	base   string
+	keydir map[Key]keydirEntry
+	// readers of every segment, active one included
+	files map[uint32]*os.File
+	stats map[uint32]*segmentStats
+
+	// segment, which records are appended to
+	active     *os.File
+	activeID   uint32
+	activeSize int64
+	dirty      bool
+	// set once a failed record couldn't be cut off, so further appends fail
+	broken bool
+
+	maxFileSize   int64
+	mergeInterval time.Duration
+	mergeRatio    float64
+	syncPolicy    SyncPolicy
+	syncInterval  time.Duration
+
+	compaction compaction
+
+	// receives changes, may be nil
+	feed *Feed
+	// versions of written entries
+	versions *versionClock
+
+	done   chan struct{}
+	errLog *logrus.Logger
+}
+
+// location of the latest value of the key
+type keydirEntry struct {
+	file   uint32
+	offset int64
+	size   uint32
+	// kept in memory to check expiration and version without a disk read
+	expiresAt int64
+	version   uint64
+}
+
+func (e keydirEntry) expired(now time.Time) bool {
+	return e.expiresAt != 0 && e.expiresAt <= now.UnixNano()
+}
+
+// amount of bytes in a segment and how many of them are not referenced anymore
+type segmentStats struct {
+	total int64
+	dead  int64
+}
+
+// Option configuration pattern
+type BitcaskOption func(*BitcaskStorage)
+
+// sets the size of a segment, after which a new one is started
+func WithBitcaskFileSize(size int64) BitcaskOption {
+	return func(bc *BitcaskStorage) {
+		bc.maxFileSize = size
+	}
+}
+
+// sets how often merge conditions are checked
+func WithBitcaskMergeInterval(interval time.Duration) BitcaskOption {
+	return func(bc *BitcaskStorage) {
+		bc.mergeInterval = interval
+	}
+}
+
+// sets the share of dead bytes in immutable segments, after which they are merged
+func WithBitcaskMergeRatio(ratio float64) BitcaskOption {
+	return func(bc *BitcaskStorage) {
+		bc.mergeRatio = ratio
+	}
+}
+
+// sets how often the active segment is fsynced
+func WithBitcaskSync(policy SyncPolicy, interval time.Duration) BitcaskOption {
+	return func(bc *BitcaskStorage) {
+		bc.syncPolicy = policy
+		bc.syncInterval = interval
+	}
+}
+
+// sets the feed, which receives changes of the storage
+func WithBitcaskFeed(feed *Feed) BitcaskOption {
+	return func(bc *BitcaskStorage) {
+		bc.feed = feed
+	}
+}
+
+func NewBitcaskStorage(base string, errLog *logrus.Logger, opts ...BitcaskOption) (*BitcaskStorage, error) {
+	bc := &BitcaskStorage{
+		base:   base,
+		keydir: make(map[Key]keydirEntry),
+		files:  make(map[uint32]*os.File),
+		stats:  make(map[uint32]*segmentStats),
+
+		maxFileSize:   defaultBitcaskFileSize,
+		mergeInterval: defaultBitcaskMergeInterval,
+		mergeRatio:    defaultBitcaskMergeRatio,
+		syncPolicy:    defaultSyncPolicy,
+		syncInterval:  defaultSyncInterval,
+
+		versions: newVersionClock(),
+
+		done:   make(chan struct{}),
+		errLog: errLog,
+	}
+
+	for _, opt := range opts {
+		opt(bc)
+	}
+
+	if err := bc.load(); err != nil {
+		bc.closeFiles()
+		return nil, err
+	}
+
+	for key, e := range bc.keydir {
+		if e.expiresAt != 0 {
+			bc.feed.track(key, time.Unix(0, e.expiresAt))
+		}
+		bc.versions.observe(e.version)
+	}
+
+	go bc.mergeLoop(bc.mergeInterval)
+	if bc.syncPolicy == SyncInterval {
+		go bc.syncLoop(bc.syncInterval)
+	}
+
+	return bc, nil
+}
+
+func (bc *BitcaskStorage) Create(entry Entry) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	// expired entries are overwritten
+	if e, ok := bc.keydir[entry.Key]; ok && !e.expired(time.Now()) {
+		return ErrKeyAlreadyExists
+	}
+	entry.Value.Version = bc.versions.next()
+
+	return bc.put(entry.Key, entry.Value)
+}
+
+func (bc *BitcaskStorage) Read(key Key) (Entry, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	e, ok := bc.keydir[key]
+	if !ok || e.expired(time.Now()) {
+		return Entry{}, ErrKeyNotFound
+	}
+
+	val, err := bc.readValue(e)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{Key: key, Value: val}, nil
+}
+
+func (bc *BitcaskStorage) Update(entry Entry) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	e, ok := bc.keydir[entry.Key]
+	if !ok || e.expired(time.Now()) {
+		return ErrKeyNotFound
+	}
+
+	// current ttl is kept, unless a new one is provided
+	if entry.Value.ExpiresAt.IsZero() && e.expiresAt != 0 {
+		entry.Value.ExpiresAt = time.Unix(0, e.expiresAt)
+	}
+	entry.Value.Version = bc.versions.next()
+
+	return bc.put(entry.Key, entry.Value)
+}
+
+func (bc *BitcaskStorage) Delete(key Key) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	e, ok := bc.keydir[key]
+	if !ok || e.expired(time.Now()) {
+		return ErrKeyNotFound
+	}
+
+	return bc.del(key, e)
+}
+
+// write lock should be held by the caller
+func (bc *BitcaskStorage) del(key Key, e keydirEntry) error {
+	// tombstone makes sure the value doesn't come back on restart
+	loc, err := bc.append(encodeRecord(key, Value{}, bitcaskTombstone))
+	if err != nil {
+		return err
+	}
+
+	bc.stats[e.file].dead += int64(e.size)
+	bc.stats[loc.file].dead += int64(loc.size)
+	delete(bc.keydir, key)
+	bc.feed.del(key)
+
+	return nil
+}
+
+// starts merge of the immutable segments in the background
+func (bc *BitcaskStorage) Compact() error {
+	if !bc.compaction.mu.TryLock() {
+		return ErrCompactionRunning
+	}
+
+	go func() {
+		defer bc.compaction.mu.Unlock()
+		bc.logErr(bc.merge())
+	}()
+
+	return nil
+}
+
+func (bc *BitcaskStorage) CompactionStatus() CompactionStatus {
+	return bc.compaction.current()
+}
+
+// flushes the active segment and releases the files
+func (bc *BitcaskStorage) Close() error {
+	close(bc.done)
+
+	// waiting for a running merge
+	bc.compaction.mu.Lock()
+	defer bc.compaction.mu.Unlock()
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if err := bc.active.Sync(); err != nil {
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	return bc.closeFiles()
+}
+
+// appends the value and points the key directory at it
+// write lock should be held by the caller
+func (bc *BitcaskStorage) put(key Key, val Value) error {
+	loc, err := bc.append(encodeRecord(key, val, 0))
+	if err != nil {
+		return err
+	}
+
+	if old, ok := bc.keydir[key]; ok {
+		bc.stats[old.file].dead += int64(old.size)
+	}
+
+	loc.expiresAt, loc.version = unixNano(val.ExpiresAt), val.Version
+	bc.keydir[key] = loc
+	bc.feed.put(key, val)
+
+	return nil
+}
+
+// appends a record to the active segment, starting a new one if it is full
+// returns the location of the record
+// write lock should be held by the caller
+func (bc *BitcaskStorage) append(record []byte) (keydirEntry, error) {
+	if len(record) > bitcaskMaxRecordSize {
+		return keydirEntry{}, ErrEntryTooLarge
+	}
+	if bc.broken {
+		return keydirEntry{}, ErrFileWrite
+	}
+
+	if bc.activeSize > 0 && bc.activeSize+int64(len(record)) > bc.maxFileSize {
+		if err := bc.rotate(bc.activeID + 1); err != nil {
+			bc.logErr(err)
+			return keydirEntry{}, ErrFileWrite
+		}
+	}
+
+	loc := keydirEntry{file: bc.activeID, offset: bc.activeSize, size: uint32(len(record))}
+
+	if _, err := bc.active.Write(record); err != nil {
+		bc.logErr(fmt.Errorf("fd.Write: %v", err))
+		bc.rollback(loc.offset)
+		return keydirEntry{}, ErrFileWrite
+	}
+
+	if bc.syncPolicy == SyncAlways {
+		if err := bc.active.Sync(); err != nil {
+			bc.logErr(fmt.Errorf("fd.Sync: %v", err))
+			bc.rollback(loc.offset)
+			return keydirEntry{}, ErrFileWrite
+		}
+	} else {
+		bc.dirty = true
+	}
+
+	bc.activeSize += int64(len(record))
+	bc.stats[bc.activeID].total += int64(len(record))
+
+	return loc, nil
+}
+
+// cuts a failed record off the active segment, so that the next one is not appended after its fragment,
+// which would make load drop every record from there on
+// write lock should be held by the caller
+func (bc *BitcaskStorage) rollback(size int64) {
+	if err := bc.active.Truncate(size); err != nil {
+		bc.logErr(fmt.Errorf("fd.Truncate: %v", err))
+		bc.broken = true
+	}
+}
+
+// seals the active segment and starts the one with the provided id
+// write lock should be held by the caller
+func (bc *BitcaskStorage) rotate(id uint32) error {
+	if bc.active != nil {
+		if err := bc.active.Sync(); err != nil {
+			return fmt.Errorf("fd.Sync: %v", err)
+		}
+		if err := bc.active.Close(); err != nil {
+			return fmt.Errorf("fd.Close: %v", err)
+		}
+	}
+
+	return bc.openActive(id)
+}
+
+// opens the segment for appending, as well as for reading
+// write lock should be held by the caller
+func (bc *BitcaskStorage) openActive(id uint32) error {
+	fd, err := os.OpenFile(bc.segmentPath(id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+
+	stat, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("fd.Stat: %v", err)
+	}
+
+	if _, ok := bc.files[id]; !ok {
+		reader, err := os.Open(bc.segmentPath(id))
+		if err != nil {
+			fd.Close()
+			return fmt.Errorf("os.Open: %v", err)
+		}
+		bc.files[id] = reader
+	}
+
+	if _, ok := bc.stats[id]; !ok {
+		bc.stats[id] = &segmentStats{total: stat.Size()}
+	}
+
+	bc.active = fd
+	bc.activeID = id
+	bc.activeSize = stat.Size()
+	bc.dirty = false
+
+	return nil
+}
+
+// reads the value, which the key directory entry points at
+// lock should be held by the caller
+func (bc *BitcaskStorage) readValue(e keydirEntry) (Value, error) {
+	fd, ok := bc.files[e.file]
+	if !ok {
+		bc.logErr(fmt.Errorf("segment %v is not open", e.file))
+		return Value{}, ErrFileRead
+	}
+
+	record := make([]byte, e.size)
+	if _, err := fd.ReadAt(record, e.offset); err != nil {
+		bc.logErr(fmt.Errorf("fd.ReadAt: %v", err))
+		return Value{}, ErrFileRead
+	}
+
+	_, val, _, err := decodeRecord(record)
+	if err != nil {
+		bc.logErr(fmt.Errorf("segment %v at offset %v: %v", e.file, e.offset, err))
+		return Value{}, ErrFileRead
+	}
+
+	return val, nil
+}
+
+// rebuilds the key directory from the segments on disk
+// segments are read in ascending order, so that later records override earlier ones
+func (bc *BitcaskStorage) load() error {
+	ids, err := bc.segments()
+	if err != nil {
+		return err
+	}
+
+	// leftovers of an interrupted merge
+	tmps, _ := filepath.Glob(bc.base + ".seg.*.tmp")
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+
+	now := time.Now()
+
+	for i, id := range ids {
+		reader, err := os.Open(bc.segmentPath(id))
+		if err != nil {
+			return fmt.Errorf("os.Open: %v", err)
+		}
+		bc.files[id] = reader
+		bc.stats[id] = &segmentStats{}
+
+		// merged segments come with a hint file, which is much faster to read
+		if err := bc.loadHint(id); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			bc.logErr(fmt.Errorf("hint of segment %v: %v", id, err))
+		}
+
+		if err := bc.loadSegment(id, i == len(ids)-1, now); err != nil {
+			return err
+		}
+	}
+
+	next := uint32(1)
+	if len(ids) > 0 {
+		next = ids[len(ids)-1]
+	}
+
+	return bc.openActive(next)
+}
+
+// reads every record of the segment into the key directory
+// a torn tail of the last segment (e.g. after a crash mid-write) is truncated
+func (bc *BitcaskStorage) loadSegment(id uint32, last bool, now time.Time) error {
+	fd, err := os.Open(bc.segmentPath(id))
+	if err != nil {
+		return fmt.Errorf("os.Open: %v", err)
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return fmt.Errorf("fd.Stat: %v", err)
+	}
+
+	var (
+		rd     = bufio.NewReader(fd)
+		offset int64
+	)
+
+	for {
+		record, err := readRecord(rd, info.Size()-offset)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				bc.logErr(fmt.Errorf("segment %v: torn record at offset %v", id, offset))
+			}
+			break
+		}
+
+		key, val, flags, err := decodeRecord(record)
+		if err != nil {
+			bc.logErr(fmt.Errorf("segment %v at offset %v: %v", id, offset, err))
+			break
+		}
+
+		size := int64(len(record))
+		bc.stats[id].total += size
+
+		if old, ok := bc.keydir[key]; ok {
+			bc.stats[old.file].dead += int64(old.size)
+			delete(bc.keydir, key)
+		}
+
+		if flags&bitcaskTombstone != 0 || val.expired(now) {
+			bc.stats[id].dead += size
+		} else {
+			bc.keydir[key] = keydirEntry{
+				file:      id,
+				offset:    offset,
+				size:      uint32(size),
+				expiresAt: unixNano(val.ExpiresAt),
+				version:   val.Version,
+			}
+		}
+
+		offset += size
+	}
+
+	if last {
+		if err := os.Truncate(bc.segmentPath(id), offset); err != nil {
+			return fmt.Errorf("os.Truncate: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// reads key directory entries of a merged segment from its hint file
+func (bc *BitcaskStorage) loadHint(id uint32) error {
+	raw, err := os.ReadFile(bc.hintPath(id))
+	if err != nil {
+		return err
+	}
+
+	var stat os.FileInfo
+	if stat, err = os.Stat(bc.segmentPath(id)); err != nil {
+		return err
+	}
+	bc.stats[id].total = stat.Size()
+
+	for len(raw) > 0 {
+		if len(raw) < bitcaskHintHeaderSize {
+			return ErrSnapshotCorrupted
+		}
+
+		keyLen := int(binary.LittleEndian.Uint32(raw))
+		if len(raw) < bitcaskHintHeaderSize+keyLen {
+			return ErrSnapshotCorrupted
+		}
+
+		key := Key(raw[bitcaskHintHeaderSize : bitcaskHintHeaderSize+keyLen])
+		e := keydirEntry{
+			file:      id,
+			offset:    int64(binary.LittleEndian.Uint64(raw[4:])),
+			size:      binary.LittleEndian.Uint32(raw[12:]),
+			expiresAt: int64(binary.LittleEndian.Uint64(raw[16:])),
+			version:   binary.LittleEndian.Uint64(raw[24:]),
+		}
+
+		if old, ok := bc.keydir[key]; ok {
+			bc.stats[old.file].dead += int64(old.size)
+		}
+		bc.keydir[key] = e
+
+		raw = raw[bitcaskHintHeaderSize+keyLen:]
+	}
+
+	return nil
+}
+
+// merges immutable segments, once enough of their bytes are dead
+func (bc *BitcaskStorage) mergeLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bc.done:
+			return
+		case <-ticker.C:
+		}
+
+		if !bc.needsMerge() || !bc.compaction.mu.TryLock() {
+			continue
+		}
+		bc.logErr(bc.merge())
+		bc.compaction.mu.Unlock()
+	}
+}
+
+func (bc *BitcaskStorage) needsMerge() bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var total, dead int64
+	for id, stats := range bc.stats {
+		if id == bc.activeID {
+			continue
+		}
+		total += stats.total
+		dead += stats.dead
+	}
+
+	return total > 0 && float64(dead)/float64(total) >= bc.mergeRatio
+}
+
+// rewrites live values of every immutable segment into a single new segment
+// compaction mutex should be held by the caller
+//
+// the new segment takes an id right below the active one,
+// so records, written during the merge, still override it on restart
+func (bc *BitcaskStorage) merge() (err error) {
+	// active segment is changed by writers under the lock
+	bc.mu.RLock()
+	activeID := bc.activeID
+	bc.mu.RUnlock()
+
+	bc.compaction.start(uint64(activeID))
+	defer func() { bc.compaction.finish(err, uint64(activeID)) }()
+
+	bc.compaction.setPhase(phaseRotating)
+
+	type location struct {
+		key Key
+		old keydirEntry
+	}
+
+	bc.mu.Lock()
+
+	mergeID := bc.activeID + 1
+	if err := bc.rotate(mergeID + 1); err != nil {
+		bc.mu.Unlock()
+		return fmt.Errorf("rotate: %v", err)
+	}
+
+	inputs := []uint32{}
+	var total int64
+	for id, stats := range bc.stats {
+		if id < mergeID {
+			inputs = append(inputs, id)
+			total += stats.total - stats.dead
+		}
+	}
+	// inputs are removed oldest first: if merge is interrupted, newer segments are still there,
+	// so that their tombstones keep shadowing the older values
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i] < inputs[j] })
+
+	live := []location{}
+	for key, e := range bc.keydir {
+		if e.file < mergeID {
+			live = append(live, location{key: key, old: e})
+		}
+	}
+
+	bc.mu.Unlock()
+
+	bc.compaction.setPhase(phaseWriting)
+	bc.compaction.setTotal(total)
+
+	// copying live records in file order to keep reads sequential
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].old.file != live[j].old.file {
+			return live[i].old.file < live[j].old.file
+		}
+		return live[i].old.offset < live[j].old.offset
+	})
+
+	tmp := bc.segmentPath(mergeID) + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+	defer out.Close()
+	// no-op after a successful rename
+	defer os.Remove(tmp)
+
+	var (
+		wr     = bufio.NewWriter(out)
+		hint   = []byte{}
+		merged = make(map[Key]keydirEntry, len(live))
+		offset int64
+		now    = time.Now()
+	)
+
+	for _, loc := range live {
+		if loc.old.expired(now) {
+			continue
+		}
+
+		// immutable segments are only closed by merge itself, so read lock is enough
+		bc.mu.RLock()
+		record := make([]byte, loc.old.size)
+		_, err := bc.files[loc.old.file].ReadAt(record, loc.old.offset)
+		bc.mu.RUnlock()
+
+		if err != nil {
+			return fmt.Errorf("fd.ReadAt: %v", err)
+		}
+
+		if _, err := wr.Write(record); err != nil {
+			return fmt.Errorf("wr.Write: %v", err)
+		}
+
+		e := loc.old
+		e.file, e.offset = mergeID, offset
+		merged[loc.key] = e
+		hint = appendHint(hint, loc.key, e)
+
+		offset += int64(loc.old.size)
+		bc.compaction.done.Add(int64(loc.old.size))
+	}
+
+	if err := wr.Flush(); err != nil {
+		return fmt.Errorf("wr.Flush: %v", err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	if err := writeFileSync(bc.hintPath(mergeID), hint); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, bc.segmentPath(mergeID)); err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+	if err := syncDir(filepath.Dir(bc.base)); err != nil {
+		return err
+	}
+
+	bc.compaction.setPhase(phaseCleanup)
+
+	reader, err := os.Open(bc.segmentPath(mergeID))
+	if err != nil {
+		return fmt.Errorf("os.Open: %v", err)
+	}
+
+	bc.mu.Lock()
+
+	bc.files[mergeID] = reader
+	bc.stats[mergeID] = &segmentStats{total: offset}
+
+	for _, loc := range live {
+		cur, ok := bc.keydir[loc.key]
+		// key was overwritten or deleted during the merge
+		if !ok || cur != loc.old {
+			if e, ok := merged[loc.key]; ok {
+				bc.stats[mergeID].dead += int64(e.size)
+			}
+			continue
+		}
+
+		if e, ok := merged[loc.key]; ok {
+			bc.keydir[loc.key] = e
+		} else {
+			// expired and not carried over
+			delete(bc.keydir, loc.key)
+		}
+	}
+
+	for _, id := range inputs {
+		bc.files[id].Close()
+		delete(bc.files, id)
+		delete(bc.stats, id)
+	}
+
+	bc.mu.Unlock()
+
+	for _, id := range inputs {
+		if err := os.Remove(bc.segmentPath(id)); err != nil {
+			return fmt.Errorf("os.Remove: %v", err)
+		}
+		os.Remove(bc.hintPath(id))
+	}
+
+	return syncDir(filepath.Dir(bc.base))
+}
+
+// periodically fsyncs the active segment if it has unsynced records
+func (bc *BitcaskStorage) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bc.done:
+			return
+		case <-ticker.C:
+			bc.mu.Lock()
+			if bc.dirty {
+				if err := bc.active.Sync(); err != nil {
+					bc.logErr(fmt.Errorf("fd.Sync: %v", err))
+				} else {
+					bc.dirty = false
+				}
+			}
+			bc.mu.Unlock()
+		}
+	}
+}
+
+// lists segments, present on disk, in ascending order
+func (bc *BitcaskStorage) segments() ([]uint32, error) {
+	paths, err := filepath.Glob(bc.base + ".seg.*")
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob: %v", err)
+	}
+
+	ids := []uint32{}
+	for _, path := range paths {
+		id, err := strconv.ParseUint(strings.TrimPrefix(path, bc.base+".seg."), 10, 32)
+		if err != nil {
+			// hint and temp files
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (bc *BitcaskStorage) closeFiles() error {
+	if bc.active != nil {
+		bc.active.Close()
+	}
+
+	for id, fd := range bc.files {
+		fd.Close()
+		delete(bc.files, id)
+	}
+
+	return nil
+}
+
+func (bc *BitcaskStorage) segmentPath(id uint32) string {
+	return fmt.Sprintf("%v.seg.%010d", bc.base, id)
+}
+
+func (bc *BitcaskStorage) hintPath(id uint32) string {
+	return bc.segmentPath(id) + ".hint"
+}
+
+func (bc *BitcaskStorage) logErr(err error) {
+	if err == nil {
+		return
+	}
+
+	bc.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+}
+
+// encodes a record as: header | key | [client flags] | data
+func encodeRecord(key Key, val Value, flags byte) []byte {
+	var prefix int
+	if val.Flags != 0 {
+		flags |= bitcaskClientFlags
+		prefix = 4
+	}
+
+	record := make([]byte, bitcaskHeaderSize+len(key)+prefix+len(val.Data))
+
+	// type code is kept in the upper half of the flags
+	record[4] = flags | typeCode(val.Type)<<4
+	binary.LittleEndian.PutUint64(record[5:], uint64(unixNano(val.ExpiresAt)))
+	binary.LittleEndian.PutUint64(record[13:], uint64(unixNano(val.UpdatedAt)))
+	binary.LittleEndian.PutUint64(record[21:], val.Version)
+	binary.LittleEndian.PutUint32(record[29:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[33:], uint32(prefix+len(val.Data)))
+	copy(record[bitcaskHeaderSize:], key)
+	if prefix > 0 {
+		binary.LittleEndian.PutUint32(record[bitcaskHeaderSize+len(key):], val.Flags)
+	}
+	copy(record[bitcaskHeaderSize+len(key)+prefix:], val.Data)
+
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+
+	return record
+}
+
+// reads a single encoded record out of remaining bytes of the reader
+// io.EOF is returned only if there's nothing left to read
+//
+// the header is checked by the crc only with the rest of the record,
+// so records, which don't fit into the remaining bytes or are too large, are taken for a torn tail
+func readRecord(rd io.Reader, remaining int64) ([]byte, error) {
+	header := make([]byte, bitcaskHeaderSize)
+	if _, err := io.ReadFull(rd, header); err != nil {
+		return nil, err
+	}
+
+	size := recordSize(header)
+	if size > remaining || size > bitcaskMaxRecordSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	record := make([]byte, size)
+	copy(record, header)
+
+	if _, err := io.ReadFull(rd, record[bitcaskHeaderSize:]); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return record, nil
+}
+
+// size of the whole record, which starts with the provided header
+func recordSize(header []byte) int64 {
+	return bitcaskHeaderSize + int64(binary.LittleEndian.Uint32(header[29:])) + int64(binary.LittleEndian.Uint32(header[33:]))
+}
+
+func decodeRecord(record []byte) (Key, Value, byte, error) {
+	if len(record) < bitcaskHeaderSize || binary.LittleEndian.Uint32(record) != crc32.ChecksumIEEE(record[4:]) {
+		return "", Value{}, 0, ErrSnapshotCorrupted
+	}
+
+	keyLen := int(binary.LittleEndian.Uint32(record[29:]))
+	if bitcaskHeaderSize+keyLen > len(record) {
+		return "", Value{}, 0, ErrSnapshotCorrupted
+	}
+
+	code := int(record[4] >> 4)
+	if code >= len(valueTypes) {
+		return "", Value{}, 0, ErrSnapshotCorrupted
+	}
+
+	key, data := Key(record[bitcaskHeaderSize:bitcaskHeaderSize+keyLen]), record[bitcaskHeaderSize+keyLen:]
+
+	var clientFlags uint32
+	if record[4]&bitcaskClientFlags != 0 {
+		if len(data) < 4 {
+			return "", Value{}, 0, ErrSnapshotCorrupted
+		}
+		clientFlags, data = binary.LittleEndian.Uint32(data), data[4:]
+	}
+
+	val := Value{
+		Type:      valueTypes[code],
+		Data:      string(data),
+		ExpiresAt: fromUnixNano(int64(binary.LittleEndian.Uint64(record[5:]))),
+		UpdatedAt: fromUnixNano(int64(binary.LittleEndian.Uint64(record[13:]))),
+		Version:   binary.LittleEndian.Uint64(record[21:]),
+		Flags:     clientFlags,
+	}
+
+	return key, val, record[4], nil
+}
+
+func typeCode(t ValueType) byte {
+	for i, vt := range valueTypes {
+		if vt == t {
+			return byte(i)
+		}
+	}
+
+	return 0
+}
+
+func appendHint(hint []byte, key Key, e keydirEntry) []byte {
+	hint = binary.LittleEndian.AppendUint32(hint, uint32(len(key)))
+	hint = binary.LittleEndian.AppendUint64(hint, uint64(e.offset))
+	hint = binary.LittleEndian.AppendUint32(hint, e.size)
+	hint = binary.LittleEndian.AppendUint64(hint, uint64(e.expiresAt))
+	hint = binary.LittleEndian.AppendUint64(hint, e.version)
+
+	return append(hint, key...)
+}
+
+// zero time is encoded as zero
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
+
+// writes a file and fsyncs it
+func writeFileSync(path string, data []byte) error {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+	defer fd.Close()
+
+	if _, err := fd.Write(data); err != nil {
+		return fmt.Errorf("fd.Write: %v", err)
+	}
+
+	if err := fd.Sync(); err != nil {
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package storage_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// small segments, so that a few writes span many of them
+const bitcaskFileSize = 512
+
+func openBitcask(t *testing.T, path string) *storage.BitcaskStorage {
+	t.Helper()
+
+	errLog := logrus.New()
+	errLog.SetOutput(io.Discard)
+
+	st, err := storage.NewBitcaskStorage(path, errLog, storage.WithBitcaskFileSize(bitcaskFileSize), storage.WithBitcaskSync(storage.SyncAlways, 0))
+	if err != nil {
+		t.Fatalf("NewBitcaskStorage: %v", err)
+	}
+
+	return st
+}
+
+func globCount(t *testing.T, pattern string) int {
+	t.Helper()
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(paths)
+}
+
+func TestBitcaskMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openBitcask(t, path)
+
+	for round := range 5 {
+		for i := range 20 {
+			put(t, st, fmt.Sprintf("key-%02d", i), strconv.Itoa(round))
+		}
+	}
+	for i := range 10 {
+		if err := st.Delete(storage.Key(fmt.Sprintf("key-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := globCount(t, path+".seg.*[0-9]")
+	compact(t, st)
+
+	// overwritten values and tombstones are dropped, live records are packed into a single segment
+	after := globCount(t, path+".seg.*[0-9]")
+	if after >= before || after > 2 {
+		t.Fatalf("segments: %v before merge, %v after", before, after)
+	}
+	if hints := globCount(t, path+".seg.*.hint"); hints != 1 {
+		t.Fatalf("hint files: %v, want 1", hints)
+	}
+
+	check := func(st storage.Storage) {
+		t.Helper()
+
+		for i := range 20 {
+			key := fmt.Sprintf("key-%02d", i)
+			if i < 10 {
+				expectMissing(t, st, key)
+			} else {
+				expect(t, st, key, "4")
+			}
+		}
+	}
+	check(st)
+
+	// the merged segment is loaded from its hint file, newer ones are replayed on top
+	put(t, st, "key-00", "back")
+	put(t, st, "key-19", "new")
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openBitcask(t, path)
+	defer st.Close()
+
+	expect(t, st, "key-00", "back")
+	expect(t, st, "key-19", "new")
+	for i := 1; i < 10; i++ {
+		expectMissing(t, st, fmt.Sprintf("key-%02d", i))
+	}
+	for i := 10; i < 19; i++ {
+		expect(t, st, fmt.Sprintf("key-%02d", i), "4")
+	}
+}
+
+func TestBitcaskTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openBitcask(t, path)
+
+	put(t, st, "a", "1")
+	put(t, st, "b", "2")
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs, err := filepath.Glob(path + ".seg.*[0-9]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := segs[len(segs)-1]
+
+	stat, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// crash in the middle of a write
+	fd, err := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Write([]byte{0, 1, 2, 3, 4, 5, 6})
+	fd.Close()
+
+	st = openBitcask(t, path)
+
+	expect(t, st, "a", "1")
+	expect(t, st, "b", "2")
+
+	if truncated, err := os.Stat(last); err != nil || truncated.Size() != stat.Size() {
+		t.Fatalf("torn tail is not truncated: size %v, want %v (%v)", truncated.Size(), stat.Size(), err)
+	}
+
+	// records, written after the truncation, are readable after a restart
+	put(t, st, "c", "3")
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openBitcask(t, path)
+	defer st.Close()
+
+	expect(t, st, "b", "2")
+	expect(t, st, "c", "3")
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// ~1% false positives
+	bloomBitsPerKey = 10
+)
+
+// probabilistic set of keys
+// answers either "definitely not present" or "maybe present"
+type bloomFilter struct {
+	// amount of hash functions
+	k    uint8
+	bits []byte
+}
+
+func newBloomFilter(hashes []uint64) *bloomFilter {
+	m := len(hashes) * bloomBitsPerKey
+	if m < 64 {
+		m = 64
+	}
+
+	// optimal amount of hash functions is ln2 * bits per key
+	k := uint8(math.Round(math.Ln2 * bloomBitsPerKey))
+
+	bf := &bloomFilter{k: k, bits: make([]byte, (m+7)/8)}
+	for _, h := range hashes {
+		bf.add(h)
+	}
+
+	return bf
+}
+
+func bloomHash(key Key) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// k hash functions are derived from a single one by double hashing
+func (bf *bloomFilter) add(h uint64) {
+	m := uint32(len(bf.bits) * 8)
+	h1, h2 := uint32(h), uint32(h>>32)
+
+	for i := uint32(0); i < uint32(bf.k); i++ {
+		bit := (h1 + i*h2) % m
+		bf.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (bf *bloomFilter) mayContain(key Key) bool {
+	m := uint32(len(bf.bits) * 8)
+	h := bloomHash(key)
+	h1, h2 := uint32(h), uint32(h>>32)
+
+	for i := uint32(0); i < uint32(bf.k); i++ {
+		bit := (h1 + i*h2) % m
+		if bf.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encoded as: k(1) | bits
+func (bf *bloomFilter) encode() []byte {
+	return append([]byte{bf.k}, bf.bits...)
+}
+
+func decodeBloomFilter(raw []byte) (*bloomFilter, error) {
+	if len(raw) < 2 {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	return &bloomFilter{k: raw[0], bits: raw[1:]}, nil
+}
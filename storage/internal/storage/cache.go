@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// in-mem storage
+type store map[Key]Value
+
+// removes every expired entry
+func (s store) expire(now time.Time) {
+	for k, v := range s {
+		if v.expired(now) {
+			delete(s, k)
+		}
+	}
+}
+
+// applies a replayed log record
+func (s store) apply(rec walRecord) {
+	switch rec.Op {
+	case walPut:
+		if rec.Value != nil {
+			s[rec.Key] = *rec.Value
+		}
+	case walDel:
+		delete(s, rec.Key)
+	case walTxn:
+		for _, op := range rec.Ops {
+			s.apply(op)
+		}
+	case walColl:
+		if rec.Coll != nil {
+			s.applyColl(rec.Key, rec.Coll)
+		}
+	}
+}
+
+// in-mem storage, partitioned into hash-based shards,
+// so that operations on different keys don't contend for a single lock
+type cache struct {
+	seed   maphash.Seed
+	shards []*shard
+	mem    *memory
+}
+
+// memory usage of the cache, shared by its shards,
+// so that the limit holds no matter how keys are distributed
+type memory struct {
+	// approximate usage in bytes, updated under the lock of the shard, which has changed
+	used atomic.Int64
+	// zero limit means no limit
+	max    int64
+	policy EvictionPolicy
+}
+
+// memory limit is shared by the shards
+func newCache(shards int, maxMemory int64, policy EvictionPolicy) *cache {
+	if shards < 1 {
+		shards = 1
+	}
+
+	cc := &cache{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*shard, shards),
+		mem:    &memory{max: maxMemory, policy: policy},
+	}
+
+	for i := range cc.shards {
+		cc.shards[i] = &shard{
+			index: i,
+			data:  make(store),
+			ttl:   newExpiryIndex(),
+			meta:  make(map[Key]*entryMeta),
+			keys:  newSkiplist(keyLess),
+			mem:   cc.mem,
+		}
+	}
+
+	return cc
+}
+
+// returns the shard, responsible for the key
+func (cc *cache) shard(key Key) *shard {
+	return cc.shards[maphash.String(cc.seed, string(key))%uint64(len(cc.shards))]
+}
+
+// distributes restored entries between the shards
+// should only be called before the cache is shared
+func (cc *cache) load(data store) {
+	for k, v := range data {
+		cc.shard(k).data[k] = v
+	}
+
+	for _, sh := range cc.shards {
+		sh.reindex()
+	}
+}
+
+// single partition of the cache with its own lock
+type shard struct {
+	sync.RWMutex
+	// position in the cache, defines locking order
+	index int
+	data  store
+	ttl   *expiryIndex
+	meta  map[Key]*entryMeta
+	// ordered index of the keys
+	keys *skiplist[Key]
+
+	// approximate memory usage of the shard in bytes,
+	// and the part of it, taken by entries with ttl
+	used     int64
+	volatile int64
+	mem      *memory
+}
+
+func (sh *shard) get(key Key) (Entry, bool) {
+	sh.RLock()
+	val, ok := sh.data[key]
+	if ok {
+		sh.meta[key].touch()
+		val = val.materialized()
+	}
+	sh.RUnlock()
+
+	return Entry{
+		Key:   key,
+		Value: val,
+	}, ok
+}
+
+// returns the value if it exists and hasn't expired yet
+// expired value gets removed, so write lock should be held by the caller
+//
+// expirations are not logged: expired records are
+// dropped on restore and during compaction instead
+func (sh *shard) live(key Key) (Value, bool) {
+	val, ok := sh.data[key]
+	if !ok {
+		return Value{}, false
+	}
+
+	if val.expired(time.Now()) {
+		sh.remove(key)
+		return Value{}, false
+	}
+
+	return val, true
+}
+
+// write lock should be held by the caller
+func (sh *shard) set(key Key, val Value) {
+	size := entrySize(key, val)
+
+	if meta, ok := sh.meta[key]; ok {
+		sh.account(key, -meta.size)
+		meta.size = size
+		meta.touch()
+	} else {
+		sh.meta[key] = newEntryMeta(size)
+		sh.keys.insert(key)
+	}
+
+	sh.data[key] = val
+	sh.account(key, size)
+	sh.ttl.set(key, val.ExpiresAt)
+}
+
+// write lock should be held by the caller
+func (sh *shard) remove(key Key) {
+	if meta, ok := sh.meta[key]; ok {
+		sh.account(key, -meta.size)
+		delete(sh.meta, key)
+	}
+
+	delete(sh.data, key)
+	sh.ttl.remove(key)
+	sh.keys.delete(key)
+}
+
+// adds delta to memory usage of the key, taking into account, whether its current value has ttl
+// write lock should be held by the caller
+func (sh *shard) account(key Key, delta int64) {
+	sh.used += delta
+	if !sh.data[key].ExpiresAt.IsZero() {
+		sh.volatile += delta
+	}
+
+	sh.mem.used.Add(delta)
+}
+
+// rebuilds indices and access statistics from scratch
+func (sh *shard) reindex() {
+	sh.mem.used.Add(-sh.used)
+
+	sh.ttl = newExpiryIndex()
+	sh.meta = make(map[Key]*entryMeta, len(sh.data))
+	sh.keys = newSkiplist(keyLess)
+	sh.used, sh.volatile = 0, 0
+
+	for k, v := range sh.data {
+		size := entrySize(k, v)
+		sh.ttl.set(k, v.ExpiresAt)
+		sh.meta[k] = newEntryMeta(size)
+		sh.keys.insert(k)
+		sh.account(k, size)
+	}
+}
@@ -0,0 +1,83 @@
+package storage_test
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const benchKeys = 100000
+
+// share of reads in a workload, in percents
+var workloads = []struct {
+	name  string
+	reads int
+}{
+	{"read-heavy", 90},
+	{"mixed", 50},
+	{"write-heavy", 10},
+}
+
+// compares the sharded cache with a single-lock one (which is what the storage used before sharding)
+// the storage is memory-only, so that the write-ahead log doesn't hide the difference
+//
+// usage: go test -run ^$ -bench Cache -cpu 8 ./internal/storage
+func BenchmarkCache(b *testing.B) {
+	benchmarkCache(b, "")
+}
+
+// the same as BenchmarkCache, but with the write-ahead log, which is never fsynced
+// every write still takes the single lock of the log, so it remains a bottleneck of persistent storages
+func BenchmarkCacheWAL(b *testing.B) {
+	benchmarkCache(b, b.TempDir()+"/data")
+}
+
+func benchmarkCache(b *testing.B, path string) {
+	for _, wl := range workloads {
+		for _, shards := range []int{1, 32} {
+			b.Run(fmt.Sprintf("%v/shards=%v", wl.name, shards), func(b *testing.B) {
+				st := newBenchStorage(b, path, shards)
+
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						key := strconv.Itoa(rand.IntN(benchKeys))
+						if rand.IntN(100) < wl.reads {
+							st.Read(storage.Key(key))
+						} else {
+							st.Update(storage.EntryFromData(key, "value", time.Now(), time.Time{}))
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+func newBenchStorage(b *testing.B, path string, shards int) *storage.ImprovedStorage {
+	errLog := logrus.New()
+	errLog.SetOutput(io.Discard)
+
+	if path != "" {
+		// each run gets its own files
+		path = b.TempDir() + "/data"
+	}
+
+	st, err := storage.NewImprovedStorage(path, errLog, storage.WithShards(shards), storage.WithSyncPolicy(storage.SyncNever))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { st.Close() })
+
+	for i := 0; i < benchKeys; i++ {
+		st.Create(storage.EntryFromData(strconv.Itoa(i), "value", time.Now(), time.Time{}))
+	}
+
+	return st
+}
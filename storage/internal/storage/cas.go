@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// storage, which supports conditional writes
+type Swapper interface {
+	// writes the value, only if the current version of the key matches the expected one
+	// zero expected version means the key should not exist
+	CompareAndSwap(key Key, expected uint64, val Value) error
+}
+
+// atomic read-modify-write of a single entry
+// fn receives the current value (if the entry is live) and returns the one to be written
+//
+// the new value is written along with its ExpiresAt, so fn should carry the current one over to keep the ttl,
+// version is assigned by the storage
+// fn may return errRemove to delete the entry instead
+// returns the written value
+type modifier interface {
+	modify(key Key, fn func(cur Value, exists bool) (Value, error)) (Value, error)
+}
+
+var (
+	// returned by modify callbacks, when the entry should be deleted
+	errRemove = errors.New("remove the entry")
+	// returned by modify callbacks, when the entry should be left as it is
+	errUnchanged = errors.New("leave the entry as it is")
+)
+
+// removing an absent entry is a no-op
+func ignoreRemove(err error) error {
+	if errors.Is(err, errRemove) {
+		return nil
+	}
+
+	return err
+}
+
+// checks the current version of the key against the expected one
+func checkVersion(current uint64, exists bool, expected uint64) error {
+	if expected == 0 && exists {
+		return ErrVersionMismatch
+	}
+
+	if expected != 0 && (!exists || current != expected) {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// source of versions, shared by every key of a storage
+// a version is never handed out twice, even once the key is deleted and created again,
+// so that a stale version of the previous entry doesn't match the new one
+//
+// as feed revisions, versions start from the current unix time in microseconds,
+// so they keep growing between restarts, unless writes outpace the clock
+type versionClock struct {
+	last atomic.Uint64
+}
+
+func newVersionClock() *versionClock {
+	c := &versionClock{}
+	c.last.Store(uint64(time.Now().UnixMicro()))
+
+	return c
+}
+
+// returns the version of the next write
+func (c *versionClock) next() uint64 {
+	return c.last.Add(1)
+}
+
+// returns the last handed out version
+func (c *versionClock) current() uint64 {
+	return c.last.Load()
+}
+
+// makes sure the restored version is never handed out again
+func (c *versionClock) observe(version uint64) {
+	for {
+		last := c.last.Load()
+		if version <= last || c.last.CompareAndSwap(last, version) {
+			return
+		}
+	}
+}
+
+func compareAndSwap(m modifier, key Key, expected uint64, val Value) error {
+	_, err := m.modify(key, func(cur Value, exists bool) (Value, error) {
+		if err := checkVersion(cur.Version, exists, expected); err != nil {
+			return Value{}, err
+		}
+
+		// current ttl is kept, unless a new one is provided
+		if val.ExpiresAt.IsZero() {
+			val.ExpiresAt = cur.ExpiresAt
+		}
+
+		return val, nil
+	})
+
+	return err
+}
+
+func (st *ImprovedStorage) CompareAndSwap(key Key, expected uint64, val Value) error {
+	return compareAndSwap(st, key, expected, val)
+}
+
+func (ls *LocalStorage) CompareAndSwap(key Key, expected uint64, val Value) error {
+	return compareAndSwap(ls, key, expected, val)
+}
+
+func (bc *BitcaskStorage) CompareAndSwap(key Key, expected uint64, val Value) error {
+	return compareAndSwap(bc, key, expected, val)
+}
+
+func (st *LSMStorage) CompareAndSwap(key Key, expected uint64, val Value) error {
+	return compareAndSwap(st, key, expected, val)
+}
+
+func (st *ImprovedStorage) modify(key Key, fn func(cur Value, exists bool) (Value, error)) (Value, error) {
+	sh := st.cc.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+
+	cur, ok := sh.live(key)
+
+	val, err := fn(cur.materialized(), ok)
+	if errors.Is(err, errRemove) && ok {
+		return Value{}, st.del(sh, key)
+	}
+	if err != nil {
+		return Value{}, ignoreRemove(err)
+	}
+
+	val.Version = st.versions.next()
+
+	if err := st.put(sh, Entry{Key: key, Value: val}); err != nil {
+		return Value{}, err
+	}
+
+	return val, nil
+}
+
+func (ls *LocalStorage) modify(key Key, fn func(cur Value, exists bool) (Value, error)) (Value, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	data, err := ls.file.read()
+	if err != nil {
+		return Value{}, err
+	}
+
+	cur, ok := (*data)[key]
+	ok = ok && !cur.expired(time.Now())
+
+	val, err := fn(cur, ok)
+	if errors.Is(err, errRemove) && ok {
+		return Value{}, ls.del(*data, key)
+	}
+	if err != nil {
+		return Value{}, ignoreRemove(err)
+	}
+
+	val.Version = ls.versions.next()
+
+	(*data)[key] = val
+
+	if err := ls.file.flush(*data); err != nil {
+		return Value{}, err
+	}
+
+	ls.ttl.set(key, val.ExpiresAt)
+	ls.feed.put(key, val)
+
+	return val, nil
+}
+
+func (bc *BitcaskStorage) modify(key Key, fn func(cur Value, exists bool) (Value, error)) (Value, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	var cur Value
+
+	e, ok := bc.keydir[key]
+	ok = ok && !e.expired(time.Now())
+
+	if ok {
+		var err error
+		if cur, err = bc.readValue(e); err != nil {
+			return Value{}, err
+		}
+	}
+
+	val, err := fn(cur, ok)
+	if errors.Is(err, errRemove) && ok {
+		return Value{}, bc.del(key, e)
+	}
+	if err != nil {
+		return Value{}, ignoreRemove(err)
+	}
+
+	val.Version = bc.versions.next()
+
+	if err := bc.put(key, val); err != nil {
+		return Value{}, err
+	}
+
+	return val, nil
+}
+
+func (st *LSMStorage) modify(key Key, fn func(cur Value, exists bool) (Value, error)) (Value, error) {
+	st.lockWrite()
+	defer st.mu.Unlock()
+
+	cur, ok, err := st.live(key, time.Now())
+	if err != nil {
+		return Value{}, err
+	}
+
+	val, err := fn(cur, ok)
+	if errors.Is(err, errRemove) && ok {
+		return Value{}, st.write(key, lsmRecord{tombstone: true})
+	}
+	if err != nil {
+		return Value{}, ignoreRemove(err)
+	}
+
+	val.Version = st.versions.next()
+
+	if err := st.write(key, lsmRecord{val: val}); err != nil {
+		return Value{}, err
+	}
+
+	return val, nil
+}
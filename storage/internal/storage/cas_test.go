@@ -0,0 +1,77 @@
+package storage_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+func value(data string) storage.Value {
+	return storage.EntryFromData("", data, time.Now(), time.Time{}).Value
+}
+
+func version(t *testing.T, st storage.Storage, key string) uint64 {
+	t.Helper()
+
+	entry, err := st.Read(storage.Key(key))
+	if err != nil {
+		t.Fatalf("Read(%v): %v", key, err)
+	}
+
+	return entry.Value.Version
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	const (
+		workers    = 8
+		increments = 100
+	)
+
+	st := openImproved(t, "")
+
+	if err := st.CompareAndSwap("counter", 0, value("0")); err != nil {
+		t.Fatalf("CompareAndSwap: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range increments {
+				// retrying, until nobody else writes in between
+				for {
+					entry, err := st.Read("counter")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+
+					n, _ := strconv.Atoi(entry.Value.Data)
+					err = st.CompareAndSwap("counter", entry.Value.Version, value(strconv.Itoa(n+1)))
+					if errors.Is(err, storage.ErrVersionMismatch) {
+						continue
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					break
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	expect(t, st, "counter", strconv.Itoa(workers*increments))
+
+	// creating the existing key fails
+	if err := st.CompareAndSwap("counter", 0, value("0")); !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("CompareAndSwap: got %v, want %v", err, storage.ErrVersionMismatch)
+	}
+}
@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// lists, hashes, sets and sorted sets, stored as typed values of the underlying storage
+// every write is an atomic read-modify-write of a single entry
+//
+// the in-mem engine keeps every collection as a native structure and logs every change on its own,
+// while other engines decode the whole value, change it and write it back
+//
+// collections are created by the first write and removed once they get empty
+// missing keys read as empty collections
+type Collections struct {
+	st Storage
+	m  modifier
+	// nil, unless the storage keeps collections natively
+	native nativeStorage
+}
+
+// storage, which keeps collections as native structures
+type nativeStorage interface {
+	modifyNative(key Key, typ ValueType, expiresAt time.Time, fn func(coll nativeColl, exists bool) (*collOp, error)) error
+	readNative(key Key, typ ValueType, fn func(coll nativeColl)) error
+}
+
+// returns false if the storage doesn't support atomic read-modify-write
+func CollectionsOf(st Storage) (*Collections, bool) {
+	m, ok := st.(modifier)
+	if !ok {
+		return nil, false
+	}
+
+	native, _ := st.(nativeStorage)
+
+	return &Collections{st: st, m: m, native: native}, true
+}
+
+// applies the change, returned by fn, to the collection, held by the key
+// fn receives current contents (empty ones, if the key doesn't exist), nil change leaves them as they are
+// created collection expires at expiresAt, while existing ones keep their ttl
+func (c *Collections) modify(key Key, typ ValueType, expiresAt time.Time, fn func(coll nativeColl, exists bool) (*collOp, error)) error {
+	if c.native != nil {
+		return c.native.modifyNative(key, typ, expiresAt, fn)
+	}
+
+	_, err := c.m.modify(key, func(cur Value, exists bool) (Value, error) {
+		if exists && cur.Type != typ {
+			return Value{}, ErrWrongType
+		}
+
+		coll := newNative(typ)
+		if exists {
+			var err error
+			if coll, err = nativeOf(cur); err != nil {
+				return Value{}, err
+			}
+		}
+
+		op, err := fn(coll, exists)
+		if err != nil {
+			return Value{}, err
+		}
+
+		if op != nil {
+			coll.apply(op)
+		}
+
+		if coll.len() == 0 {
+			return Value{}, errRemove
+		}
+
+		val := Value{Data: coll.encode(), Type: typ, UpdatedAt: time.Now(), ExpiresAt: cur.ExpiresAt}
+		if !exists {
+			val.ExpiresAt = expiresAt
+		}
+
+		return val, nil
+	})
+
+	return err
+}
+
+// passes contents of the collection, held by the key, to fn
+// fn should copy everything it needs, as the contents may be shared with the storage
+func (c *Collections) read(key Key, typ ValueType, fn func(coll nativeColl)) error {
+	if c.native != nil {
+		return c.native.readNative(key, typ, fn)
+	}
+
+	entry, err := c.st.Read(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		fn(newNative(typ))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Value.Type != typ {
+		return ErrWrongType
+	}
+
+	coll, err := nativeOf(entry.Value)
+	if err != nil {
+		return err
+	}
+
+	fn(coll)
+
+	return nil
+}
+
+// inserts values at the head (left) or the tail of the list
+// values are pushed one by one, so left push reverses their order
+// returns the length of the list
+func (c *Collections) Push(key Key, values []string, left bool, expiresAt time.Time) (int, error) {
+	var length int
+
+	err := c.modify(key, TypeList, expiresAt, func(coll nativeColl, _ bool) (*collOp, error) {
+		length = coll.len() + len(values)
+		if len(values) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collPush, Left: left, Values: values}, nil
+	})
+
+	return length, err
+}
+
+// removes and returns up to count values from the head (left) or the tail of the list
+func (c *Collections) Pop(key Key, count int, left bool) ([]string, error) {
+	var popped []string
+
+	err := c.modify(key, TypeList, time.Time{}, func(coll nativeColl, exists bool) (*collOp, error) {
+		if !exists {
+			return nil, ErrKeyNotFound
+		}
+
+		popped = coll.(*nativeList).peek(count, left)
+		if len(popped) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collPop, Left: left, Count: len(popped)}, nil
+	})
+
+	return popped, err
+}
+
+// returns values of the list between start and stop, both inclusive
+// negative indices count from the end of the list, -1 being the last value
+func (c *Collections) Range(key Key, start, stop int) ([]string, error) {
+	var values []string
+
+	err := c.read(key, TypeList, func(coll nativeColl) {
+		lo, hi := rangeBounds(coll.len(), start, stop)
+		values = coll.(*nativeList).slice(lo, hi)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// converts inclusive start and stop, which may be negative, to bounds of a slice of length n
+func rangeBounds(n, start, stop int) (lo, hi int) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+
+	if start > stop {
+		return 0, 0
+	}
+
+	return start, stop + 1
+}
+
+// sets fields of the hash
+// returns the amount of fields, which didn't exist before
+func (c *Collections) HSet(key Key, fields map[string]string, expiresAt time.Time) (int, error) {
+	var added int
+
+	err := c.modify(key, TypeHash, expiresAt, func(coll nativeColl, _ bool) (*collOp, error) {
+		hash := coll.(*nativeHash)
+		for field := range fields {
+			if _, ok := hash.fields[field]; !ok {
+				added++
+			}
+		}
+
+		if len(fields) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collHSet, Fields: fields}, nil
+	})
+
+	return added, err
+}
+
+func (c *Collections) HGet(key Key, field string) (string, error) {
+	var (
+		value string
+		ok    bool
+	)
+
+	err := c.read(key, TypeHash, func(coll nativeColl) {
+		value, ok = coll.(*nativeHash).fields[field]
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", ErrFieldNotFound
+	}
+
+	return value, nil
+}
+
+// returns every field of the hash
+func (c *Collections) HGetAll(key Key) (map[string]string, error) {
+	hash := map[string]string{}
+
+	err := c.read(key, TypeHash, func(coll nativeColl) {
+		for field, value := range coll.(*nativeHash).fields {
+			hash[field] = value
+		}
+	})
+
+	return hash, err
+}
+
+// removes fields of the hash
+// returns the amount of fields, which were actually removed
+func (c *Collections) HDel(key Key, fields []string) (int, error) {
+	var removed []string
+
+	err := c.modify(key, TypeHash, time.Time{}, func(coll nativeColl, _ bool) (*collOp, error) {
+		hash := coll.(*nativeHash)
+
+		seen := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			if _, ok := hash.fields[field]; ok && !seen[field] {
+				seen[field] = true
+				removed = append(removed, field)
+			}
+		}
+
+		if len(removed) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collHDel, Values: removed}, nil
+	})
+
+	return len(removed), err
+}
+
+// adds members to the set
+// returns the amount of members, which weren't in the set before
+func (c *Collections) SAdd(key Key, members []string, expiresAt time.Time) (int, error) {
+	var added []string
+
+	err := c.modify(key, TypeSet, expiresAt, func(coll nativeColl, _ bool) (*collOp, error) {
+		set := coll.(*nativeSet)
+
+		seen := make(map[string]bool, len(members))
+		for _, member := range members {
+			if !set.has(member) && !seen[member] {
+				seen[member] = true
+				added = append(added, member)
+			}
+		}
+
+		if len(added) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collSAdd, Values: added}, nil
+	})
+
+	return len(added), err
+}
+
+// removes members from the set
+// returns the amount of members, which were actually removed
+func (c *Collections) SRem(key Key, members []string) (int, error) {
+	var removed []string
+
+	err := c.modify(key, TypeSet, time.Time{}, func(coll nativeColl, _ bool) (*collOp, error) {
+		set := coll.(*nativeSet)
+
+		seen := make(map[string]bool, len(members))
+		for _, member := range members {
+			if set.has(member) && !seen[member] {
+				seen[member] = true
+				removed = append(removed, member)
+			}
+		}
+
+		if len(removed) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collSRem, Values: removed}, nil
+	})
+
+	return len(removed), err
+}
+
+// returns members of the set in ascending order
+func (c *Collections) SMembers(key Key) ([]string, error) {
+	set := []string{}
+
+	err := c.read(key, TypeSet, func(coll nativeColl) {
+		set = coll.(*nativeSet).sorted()
+	})
+
+	return set, err
+}
+
+// returns members, present in every provided set, in ascending order
+// sets are read one by one, so the result is not a point-in-time view
+func (c *Collections) SInter(keys []Key) ([]string, error) {
+	if len(keys) == 0 {
+		return []string{}, nil
+	}
+
+	inter, err := c.SMembers(keys[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys[1:] {
+		err := c.read(key, TypeSet, func(coll nativeColl) {
+			set := coll.(*nativeSet)
+
+			kept := inter[:0]
+			for _, member := range inter {
+				if set.has(member) {
+					kept = append(kept, member)
+				}
+			}
+			inter = kept
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return inter, nil
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// storage, which is able to compact its log on demand
+type Compactor interface {
+	// starts compaction in the background
+	Compact() error
+	CompactionStatus() CompactionStatus
+}
+
+// compaction phases
+const (
+	phaseRotating  = "rotating log"
+	phaseReplaying = "replaying log"
+	phaseWriting   = "writing snapshot"
+	phaseCleanup   = "removing compacted log"
+	phaseFlushing  = "flushing memtables"
+	phaseMerging   = "merging tables"
+	phaseDone      = "done"
+)
+
+// progress of the current (or the last finished) compaction
+type CompactionStatus struct {
+	Running    bool       `json:"running"`
+	Phase      string     `json:"phase,omitempty"`
+	Generation uint64     `json:"generation"`
+	BytesTotal int64      `json:"bytes_total"`
+	BytesDone  int64      `json:"bytes_done"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type compaction struct {
+	// held for the whole run
+	mu sync.Mutex
+
+	statusMu sync.Mutex
+	status   CompactionStatus
+	// bytes of the log replayed so far
+	done atomic.Int64
+}
+
+// starts compaction in the background
+func (st *ImprovedStorage) Compact() error {
+	// nothing to compact in memory-only mode
+	if st.log == nil {
+		return ErrUnsupported
+	}
+
+	if !st.compaction.mu.TryLock() {
+		return ErrCompactionRunning
+	}
+
+	go func() {
+		defer st.compaction.mu.Unlock()
+		st.logCompaction(st.compact())
+	}()
+
+	return nil
+}
+
+func (st *ImprovedStorage) CompactionStatus() CompactionStatus {
+	return st.compaction.current()
+}
+
+// compacts the log each interval or whenever it grows over the threshold
+func (st *ImprovedStorage) compactLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-st.done:
+			return
+		case <-ticker.C:
+		case <-st.log.full:
+		}
+
+		// nothing was written since the last run
+		if st.log.empty() {
+			continue
+		}
+
+		if !st.compaction.mu.TryLock() {
+			continue
+		}
+		st.logCompaction(st.compact())
+		st.compaction.mu.Unlock()
+	}
+}
+
+// folds the log into a new snapshot generation
+// compaction mutex should be held by the caller
+//
+// the live cache is not touched at all: the new snapshot is built
+// from the previous one and the sealed log segments, so readers and
+// writers are blocked only for the duration of the log rotation
+func (st *ImprovedStorage) compact() (err error) {
+	st.compaction.start(st.generation)
+	defer func() { st.compaction.finish(err, st.generation) }()
+
+	st.compaction.setPhase(phaseRotating)
+
+	// every further mutation goes into a new segment
+	sealed, err := st.log.rotate()
+	if err != nil {
+		return fmt.Errorf("wal.rotate: %v", err)
+	}
+
+	data := make(store)
+
+	base, err := st.snap.latest()
+	if err != nil && !errors.Is(err, ErrNothingToRestore) {
+		return fmt.Errorf("snapshotter.latest: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(base.Data, &data); err != nil {
+			return fmt.Errorf("json.Unmarshall: %v", err)
+		}
+	}
+
+	segs, err := st.log.segments()
+	if err != nil {
+		return fmt.Errorf("wal.segments: %v", err)
+	}
+
+	pending := []uint64{}
+	for _, seq := range segs {
+		if seq > base.WALSegment && seq <= sealed {
+			pending = append(pending, seq)
+		}
+	}
+
+	st.compaction.setPhase(phaseReplaying)
+	st.compaction.setTotal(st.log.sizeOf(pending))
+
+	for _, seq := range pending {
+		if err := st.log.replaySegment(seq, data.apply, &st.compaction.done); err != nil {
+			return fmt.Errorf("wal.replaySegment: %v", err)
+		}
+	}
+
+	st.compaction.setPhase(phaseWriting)
+
+	// no need to carry expired entries over
+	data.expire(time.Now())
+	data.materialize()
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return ErrJSONMarshall
+	}
+
+	gen := st.generation + 1
+	if err := st.snap.write(snapshot{Generation: gen, WALSegment: sealed, Data: raw}); err != nil {
+		return fmt.Errorf("snapshotter.write: %v", err)
+	}
+	st.generation = gen
+
+	st.compaction.setPhase(phaseCleanup)
+
+	// older generations may still need some segments to be restorable
+	oldest, err := st.snap.oldestSegment()
+	if err != nil {
+		return fmt.Errorf("snapshotter.oldestSegment: %v", err)
+	}
+
+	if err := st.log.remove(oldest); err != nil {
+		return fmt.Errorf("wal.remove: %v", err)
+	}
+
+	return nil
+}
+
+// resets status for a new run
+func (c *compaction) start(generation uint64) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	now := time.Now()
+	c.status = CompactionStatus{
+		Running:    true,
+		Generation: generation,
+		StartedAt:  &now,
+	}
+	c.done.Store(0)
+}
+
+func (c *compaction) setPhase(phase string) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.status.Phase = phase
+}
+
+// sets the amount of bytes to be processed
+func (c *compaction) setTotal(total int64) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.status.BytesTotal = total
+}
+
+// adds to the amount of bytes to be processed, for runs of several steps
+func (c *compaction) addTotal(total int64) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.status.BytesTotal += total
+}
+
+func (c *compaction) finish(err error, generation uint64) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	now := time.Now()
+	c.status.Running = false
+	c.status.FinishedAt = &now
+	c.status.Generation = generation
+
+	if err != nil {
+		c.status.Error = err.Error()
+	} else {
+		c.status.Phase = phaseDone
+	}
+}
+
+func (c *compaction) current() CompactionStatus {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	status := c.status
+	status.BytesDone = c.done.Load()
+
+	return status
+}
+
+func (st *ImprovedStorage) logCompaction(err error) {
+	if err == nil {
+		return
+	}
+
+	st.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+}
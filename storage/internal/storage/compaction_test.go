@@ -0,0 +1,146 @@
+package storage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// starts compaction and waits for it to finish
+func compact(t *testing.T, st storage.Compactor) storage.CompactionStatus {
+	t.Helper()
+
+	started := time.Now()
+	deadline := started.Add(5 * time.Second)
+
+	// the previous run may still be releasing its lock
+	err := st.Compact()
+	for errors.Is(err, storage.ErrCompactionRunning) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		err = st.Compact()
+	}
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	for time.Now().Before(deadline) {
+		status := st.CompactionStatus()
+		if !status.Running && status.FinishedAt != nil && !status.FinishedAt.Before(started) {
+			if status.Error != "" {
+				t.Fatalf("compaction failed: %v", status.Error)
+			}
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("compaction didn't finish in time")
+	return storage.CompactionStatus{}
+}
+
+func snapshots(t *testing.T, path string) []string {
+	t.Helper()
+
+	snaps, err := filepath.Glob(path + ".snap.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snaps
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	for i := range 100 {
+		put(t, st, strconv.Itoa(i%10), strconv.Itoa(i))
+	}
+	if err := st.Delete("0"); err != nil {
+		t.Fatal(err)
+	}
+
+	status := compact(t, st)
+	if status.Generation != 1 || status.Phase != "done" {
+		t.Fatalf("status: %+v", status)
+	}
+
+	if snaps := snapshots(t, path); len(snaps) != 1 {
+		t.Fatalf("snapshots: %v", snaps)
+	}
+	// compacted segments are removed, only the current one is left
+	if segs := segments(t, path); len(segs) != 1 {
+		t.Fatalf("segments after compaction: %v", segs)
+	}
+
+	// writes after compaction are replayed on top of the snapshot
+	put(t, st, "1", "new")
+	put(t, st, "0", "back")
+
+	st = reopen(t, st, path)
+
+	expect(t, st, "0", "back")
+	expect(t, st, "1", "new")
+	for i := 2; i < 10; i++ {
+		expect(t, st, strconv.Itoa(i), strconv.Itoa(90+i))
+	}
+}
+
+func TestCompactionKeepsGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path, storage.WithSnapshotKeep(2))
+
+	for i := range 4 {
+		put(t, st, "key", strconv.Itoa(i))
+		compact(t, st)
+	}
+
+	if snaps := snapshots(t, path); len(snaps) != 2 {
+		t.Fatalf("snapshots: %v, want 2 generations", snaps)
+	}
+
+	put(t, st, "key", "last")
+	st = reopen(t, st, path, storage.WithSnapshotKeep(2))
+
+	expect(t, st, "key", "last")
+}
+
+func TestCorruptedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	put(t, st, "a", "1")
+	compact(t, st)
+	put(t, st, "b", "2")
+	compact(t, st)
+	put(t, st, "c", "3")
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the previous generation and the log, which it still needs, are used instead
+	snaps := snapshots(t, path)
+	if err := os.WriteFile(snaps[len(snaps)-1], []byte(`{"generation":2,"checksum":1,"data":{}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openImproved(t, path)
+
+	expect(t, st, "a", "1")
+	expect(t, st, "b", "2")
+	expect(t, st, "c", "3")
+}
+
+func TestCompactionMemoryOnly(t *testing.T) {
+	st := openImproved(t, "")
+
+	if err := st.Compact(); !errors.Is(err, storage.ErrUnsupported) {
+		t.Fatalf("Compact: got %v, want %v", err, storage.ErrUnsupported)
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// storage, which supports atomic arithmetic on numeric values
+type Counter interface {
+	// adds delta to the integer value of the key and returns the result
+	// missing key is created with the value of delta, expiring at expiresAt
+	IncrBy(key Key, delta int64, expiresAt time.Time) (int64, error)
+	// same as IncrBy, but for floating point values
+	IncrByFloat(key Key, delta float64, expiresAt time.Time) (float64, error)
+}
+
+func incrBy(m modifier, key Key, delta int64, expiresAt time.Time) (int64, error) {
+	var res int64
+
+	_, err := m.modify(key, func(cur Value, exists bool) (Value, error) {
+		if exists && cur.Type != TypeString {
+			return Value{}, ErrWrongType
+		}
+
+		var n int64
+		if exists {
+			parsed, err := strconv.ParseInt(cur.Data, 10, 64)
+			if err != nil {
+				return Value{}, ErrNotInteger
+			}
+			n = parsed
+		}
+
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return Value{}, ErrOverflow
+		}
+		res = n + delta
+
+		// ttl is only set for created entries, existing ones keep theirs
+		val := Value{Data: strconv.FormatInt(res, 10), UpdatedAt: time.Now()}
+		if !exists {
+			val.ExpiresAt = expiresAt
+		} else {
+			val.ExpiresAt = cur.ExpiresAt
+		}
+
+		return val, nil
+	})
+
+	return res, err
+}
+
+func incrByFloat(m modifier, key Key, delta float64, expiresAt time.Time) (float64, error) {
+	var res float64
+
+	_, err := m.modify(key, func(cur Value, exists bool) (Value, error) {
+		if exists && cur.Type != TypeString {
+			return Value{}, ErrWrongType
+		}
+
+		var n float64
+		if exists {
+			parsed, err := strconv.ParseFloat(cur.Data, 64)
+			if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+				return Value{}, ErrNotFloat
+			}
+			n = parsed
+		}
+
+		res = n + delta
+		if math.IsNaN(res) || math.IsInf(res, 0) {
+			return Value{}, ErrOverflow
+		}
+
+		val := Value{Data: strconv.FormatFloat(res, 'f', -1, 64), UpdatedAt: time.Now()}
+		if !exists {
+			val.ExpiresAt = expiresAt
+		} else {
+			val.ExpiresAt = cur.ExpiresAt
+		}
+
+		return val, nil
+	})
+
+	return res, err
+}
+
+func (st *ImprovedStorage) IncrBy(key Key, delta int64, expiresAt time.Time) (int64, error) {
+	return incrBy(st, key, delta, expiresAt)
+}
+
+func (st *ImprovedStorage) IncrByFloat(key Key, delta float64, expiresAt time.Time) (float64, error) {
+	return incrByFloat(st, key, delta, expiresAt)
+}
+
+func (ls *LocalStorage) IncrBy(key Key, delta int64, expiresAt time.Time) (int64, error) {
+	return incrBy(ls, key, delta, expiresAt)
+}
+
+func (ls *LocalStorage) IncrByFloat(key Key, delta float64, expiresAt time.Time) (float64, error) {
+	return incrByFloat(ls, key, delta, expiresAt)
+}
+
+func (bc *BitcaskStorage) IncrBy(key Key, delta int64, expiresAt time.Time) (int64, error) {
+	return incrBy(bc, key, delta, expiresAt)
+}
+
+func (bc *BitcaskStorage) IncrByFloat(key Key, delta float64, expiresAt time.Time) (float64, error) {
+	return incrByFloat(bc, key, delta, expiresAt)
+}
+
+func (st *LSMStorage) IncrBy(key Key, delta int64, expiresAt time.Time) (int64, error) {
+	return incrBy(st, key, delta, expiresAt)
+}
+
+func (st *LSMStorage) IncrByFloat(key Key, delta float64, expiresAt time.Time) (float64, error) {
+	return incrByFloat(st, key, delta, expiresAt)
+}
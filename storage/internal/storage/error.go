@@ -3,12 +3,32 @@ package storage
 import "errors"
 
 var (
-	ErrKeyNotFound      = errors.New("no data was found by provided key")
-	ErrKeyAlreadyExists = errors.New("provided key already exists")
-	ErrFileWrite        = errors.New("error when writing data")
-	ErrFileRead         = errors.New("error when reading data")
-	ErrJSONMarshall     = errors.New("error when marshalling JSON")
-	ErrJSONUnmarshall   = errors.New("error when unmarshalling JSON")
-	ErrCacheMiss        = errors.New("cache miss")
-	ErrNothingToRestore = errors.New("nothing to restore")
+	ErrKeyNotFound         = errors.New("no data was found by provided key")
+	ErrKeyAlreadyExists    = errors.New("provided key already exists")
+	ErrFileWrite           = errors.New("error when writing data")
+	ErrFileRead            = errors.New("error when reading data")
+	ErrJSONMarshall        = errors.New("error when marshalling JSON")
+	ErrJSONUnmarshall      = errors.New("error when unmarshalling JSON")
+	ErrCacheMiss           = errors.New("cache miss")
+	ErrNothingToRestore    = errors.New("nothing to restore")
+	ErrSnapshotCorrupted   = errors.New("snapshot is corrupted")
+	ErrCompactionRunning   = errors.New("compaction is already running")
+	ErrUnsupported         = errors.New("operation is not supported by the storage engine")
+	ErrOutOfMemory         = errors.New("not enough memory to store the entry")
+	ErrEntryTooLarge       = errors.New("entry is too large to be stored")
+	ErrUnknownEngine       = errors.New("unknown storage engine")
+	ErrVersionMismatch     = errors.New("version of the entry doesn't match the expected one")
+	ErrNotInteger          = errors.New("value is not an integer")
+	ErrNotFloat            = errors.New("value is not a valid float")
+	ErrOverflow            = errors.New("increment or decrement would overflow")
+	ErrWrongType           = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+	ErrFieldNotFound       = errors.New("no field was found in the hash")
+	ErrMemberNotFound      = errors.New("no member was found in the sorted set")
+	ErrNamespaceNotFound   = errors.New("namespace doesn't exist")
+	ErrNamespaceExists     = errors.New("namespace already exists")
+	ErrInvalidNamespace    = errors.New("invalid namespace settings")
+	ErrDefaultNamespace    = errors.New("default namespace can't be dropped")
+	ErrRevisionUnavailable = errors.New("events since the requested revision are not available")
+	ErrWatcherLagging      = errors.New("watcher doesn't keep up with the changes")
+	ErrFeedClosed          = errors.New("storage is closed")
 )
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// defines which entries get evicted, once the memory limit is reached
+type EvictionPolicy string
+
+const (
+	// writes fail instead of evicting anything
+	NoEviction EvictionPolicy = "noeviction"
+	// least recently used among all keys
+	AllKeysLRU EvictionPolicy = "allkeys-lru"
+	// least frequently used among all keys
+	AllKeysLFU EvictionPolicy = "allkeys-lfu"
+	// least recently used among keys with ttl
+	VolatileLRU EvictionPolicy = "volatile-lru"
+	// closest to expiration among keys with ttl
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+)
+
+const (
+	// approximate per-entry cost of maps, indices and Value fields
+	entryOverhead = 128
+	// amount of keys sampled to pick an eviction victim
+	evictionSamples = 5
+	// how many times busy shards are retried, before a reservation fails
+	reserveAttempts = 3
+
+	// logarithmic LFU counter parameters (same as in redis)
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute
+)
+
+// approximate memory footprint of an entry in bytes
+func entrySize(key Key, val Value) int64 {
+	if val.coll != nil {
+		return int64(len(key)) + val.coll.size() + entryOverhead
+	}
+
+	return int64(len(key)+len(val.Data)) + entryOverhead
+}
+
+// access statistics of an entry
+// updated atomically, so that reads don't need the write lock
+type entryMeta struct {
+	size int64
+	// unix nanoseconds of the last access
+	access atomic.Int64
+	// logarithmic access frequency
+	freq atomic.Uint32
+}
+
+func newEntryMeta(size int64) *entryMeta {
+	meta := &entryMeta{size: size}
+	meta.access.Store(time.Now().UnixNano())
+	meta.freq.Store(lfuInitVal)
+
+	return meta
+}
+
+// records an access to the entry
+func (m *entryMeta) touch() {
+	now := time.Now()
+	freq := m.decayedFreq(now)
+
+	// the higher the counter, the less likely it gets incremented
+	if freq < 255 {
+		base := float64(0)
+		if freq > lfuInitVal {
+			base = float64(freq - lfuInitVal)
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			freq++
+		}
+	}
+
+	m.freq.Store(freq)
+	m.access.Store(now.UnixNano())
+}
+
+// decrements the counter by one for each decay period since the last access
+func (m *entryMeta) decayedFreq(now time.Time) uint32 {
+	freq := m.freq.Load()
+	periods := uint32(now.Sub(time.Unix(0, m.access.Load())) / lfuDecayTime)
+
+	if periods >= freq {
+		return 0
+	}
+
+	return freq - periods
+}
+
+// frees memory for an entry of the provided size, evicting other entries
+// evict is called for each victim before it is removed and may cancel the eviction
+// write lock of the shard should be held by the caller
+func (cc *cache) reserve(sh *shard, key Key, size int64, evict func(victim Key) error) error {
+	delta := size
+	if meta, ok := sh.meta[key]; ok {
+		delta -= meta.size
+	}
+
+	return cc.reserveDelta([]*shard{sh}, delta, []Key{key}, evict)
+}
+
+// frees memory for delta more bytes, evicting entries of any shard, except the excluded ones
+// entries are evicted only once it's known, that enough memory can be freed,
+// so a failed reservation doesn't evict anything
+//
+// locked shards are held by the caller, other shards are locked here, while victims are picked:
+// at first they are only tried, and then, with the tried ones released, the ones, which follow every shard of the caller,
+// are waited for in index order, so that writers never deadlock
+// shards, which precede one of the caller, can't be waited for at all, so they are only tried a few more times
+func (cc *cache) reserveDelta(locked []*shard, delta int64, exclude []Key, evict func(victim Key) error) error {
+	mem := cc.mem
+	if mem.max <= 0 {
+		return nil
+	}
+
+	need := mem.used.Load() + delta - mem.max
+	if need <= 0 {
+		return nil
+	}
+
+	excluded := make(map[Key]bool, len(exclude))
+	for _, key := range exclude {
+		excluded[key] = true
+	}
+
+	var (
+		held      = make(map[*shard]bool, len(cc.shards))
+		shards    = append([]*shard{}, locked...)
+		available int64
+		// last shard of the caller
+		last = -1
+	)
+
+	for _, sh := range locked {
+		held[sh] = true
+		available += sh.evictable(excluded)
+		last = max(last, sh.index)
+	}
+	callerAvailable := available
+
+	take := func(sh *shard) {
+		held[sh] = true
+		shards = append(shards, sh)
+		available += sh.evictable(excluded)
+	}
+
+	// unlocks every shard, locked here
+	release := func() {
+		for _, sh := range shards[len(locked):] {
+			delete(held, sh)
+			sh.Unlock()
+		}
+		shards, available = shards[:len(locked)], callerAvailable
+	}
+	defer release()
+
+	// starting with a random shard, so that evictions are spread evenly
+	start := rand.IntN(len(cc.shards))
+	try := func() {
+		for i := 0; i < len(cc.shards) && available < need; i++ {
+			sh := cc.shards[(start+i)%len(cc.shards)]
+			if !held[sh] && sh.TryLock() {
+				take(sh)
+			}
+		}
+	}
+
+	try()
+
+	for attempt := 0; attempt < reserveAttempts && available < need; attempt++ {
+		// shards, tried out of order, are released, so that the rest may be waited for in order
+		release()
+		if attempt > 0 {
+			runtime.Gosched()
+		}
+
+		for i := last + 1; i < len(cc.shards) && available < need; i++ {
+			if sh := cc.shards[i]; !held[sh] {
+				sh.Lock()
+				take(sh)
+			}
+		}
+
+		try()
+	}
+
+	if available < need {
+		return ErrOutOfMemory
+	}
+
+	for freed := int64(0); freed < need; {
+		var (
+			best  candidate
+			owner *shard
+		)
+
+		for _, sh := range shards {
+			if c, ok := sh.victim(excluded); ok && (owner == nil || c.better(best, mem.policy)) {
+				best, owner = c, sh
+			}
+		}
+
+		if owner == nil {
+			return ErrOutOfMemory
+		}
+
+		if err := evict(best.key); err != nil {
+			return err
+		}
+
+		freed += owner.meta[best.key].size
+		owner.remove(best.key)
+	}
+
+	return nil
+}
+
+// amount of memory, which may be freed in the shard according to the eviction policy
+// write lock should be held by the caller
+func (sh *shard) evictable(excluded map[Key]bool) int64 {
+	var (
+		volatile bool
+		n        int64
+	)
+
+	switch sh.mem.policy {
+	case AllKeysLRU, AllKeysLFU:
+		n = sh.used
+	case VolatileLRU, VolatileTTL:
+		volatile, n = true, sh.volatile
+	default:
+		return 0
+	}
+
+	for key := range excluded {
+		meta, ok := sh.meta[key]
+		if !ok || volatile && sh.data[key].ExpiresAt.IsZero() {
+			continue
+		}
+		n -= meta.size
+	}
+
+	return n
+}
+
+// entry, which may be evicted
+type candidate struct {
+	key Key
+	// unix nanoseconds of the last access and logarithmic access frequency
+	at int64
+	lf uint32
+	// expiration time of the value
+	expiresAt time.Time
+}
+
+// checks whether the candidate should be evicted before the other one
+func (c candidate) better(other candidate, policy EvictionPolicy) bool {
+	switch policy {
+	case AllKeysLFU:
+		return c.lf < other.lf || (c.lf == other.lf && c.at < other.at)
+	case VolatileTTL:
+		return c.expiresAt.Before(other.expiresAt)
+	default:
+		return c.at < other.at
+	}
+}
+
+// picks an entry to be evicted according to the eviction policy
+// excluded keys, e.g. the ones being written, are never picked
+// write lock should be held by the caller
+func (sh *shard) victim(excluded map[Key]bool) (candidate, bool) {
+	var (
+		now   = time.Now()
+		best  candidate
+		found bool
+		n     int
+	)
+
+	consider := func(key Key) {
+		meta := sh.meta[key]
+		c := candidate{
+			key:       key,
+			at:        meta.access.Load(),
+			lf:        meta.decayedFreq(now),
+			expiresAt: sh.data[key].ExpiresAt,
+		}
+
+		if !found || c.better(best, sh.mem.policy) {
+			best, found = c, true
+		}
+		n++
+	}
+
+	// go randomizes map iteration order,
+	// so the first few keys make for a random sample
+	switch sh.mem.policy {
+	case AllKeysLRU, AllKeysLFU:
+		for key := range sh.data {
+			if n >= evictionSamples {
+				break
+			}
+			if !excluded[key] {
+				consider(key)
+			}
+		}
+	case VolatileLRU:
+		for key := range sh.ttl.items {
+			if n >= evictionSamples {
+				break
+			}
+			if !excluded[key] {
+				consider(key)
+			}
+		}
+	case VolatileTTL:
+		// expiry index is a min-heap by expiration time already,
+		// so the keys, closest to expiration, are at its top
+		for _, item := range sh.ttl.heap {
+			if n >= evictionSamples {
+				break
+			}
+			if !excluded[item.key] {
+				consider(item.key)
+			}
+		}
+	}
+
+	return best, found
+}
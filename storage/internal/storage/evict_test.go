@@ -0,0 +1,134 @@
+package storage_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// every entry takes about 230 bytes, so only 4 of them fit
+const evictMemory = 1000
+
+var evictData = strings.Repeat("x", 100)
+
+// a single shard makes the sample cover every key, so that victims are exact
+func openEvicting(t *testing.T, path string, policy storage.EvictionPolicy) *testStorage {
+	return openImproved(t, path, storage.WithShards(1), storage.WithMaxMemory(evictMemory), storage.WithEvictionPolicy(policy))
+}
+
+func TestNoEviction(t *testing.T) {
+	st := openEvicting(t, "", storage.NoEviction)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		put(t, st, key, evictData)
+	}
+
+	err := st.Create(storage.EntryFromData("e", evictData, time.Now(), time.Time{}))
+	if !errors.Is(err, storage.ErrOutOfMemory) {
+		t.Fatalf("Create: got %v, want %v", err, storage.ErrOutOfMemory)
+	}
+
+	// failed write evicts nothing, while shrinking writes still succeed
+	for _, key := range []string{"a", "b", "c", "d"} {
+		expect(t, st, key, evictData)
+	}
+	put(t, st, "a", "small")
+	expectMissing(t, st, "e")
+}
+
+func TestEvictionLRU(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openEvicting(t, path, storage.AllKeysLRU)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		put(t, st, key, evictData)
+	}
+	// a becomes the most recently used one
+	expect(t, st, "a", evictData)
+
+	put(t, st, "e", evictData)
+
+	expectMissing(t, st, "b")
+	for _, key := range []string{"a", "c", "d", "e"} {
+		expect(t, st, key, evictData)
+	}
+
+	// evictions are logged, so evicted entries don't come back
+	st = reopen(t, st, path, storage.WithShards(1), storage.WithMaxMemory(evictMemory), storage.WithEvictionPolicy(storage.AllKeysLRU))
+
+	expectMissing(t, st, "b")
+	expect(t, st, "e", evictData)
+}
+
+func TestEvictionVolatileTTL(t *testing.T) {
+	st := openEvicting(t, "", storage.VolatileTTL)
+
+	now := time.Now()
+	entries := []storage.Entry{
+		storage.EntryFromData("a", evictData, now, time.Time{}),
+		storage.EntryFromData("b", evictData, now, now.Add(2*time.Hour)),
+		storage.EntryFromData("c", evictData, now, now.Add(time.Hour)),
+		storage.EntryFromData("d", evictData, now, time.Time{}),
+	}
+	for _, entry := range entries {
+		if err := st.Create(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the closest to expiration goes first
+	put(t, st, "e", evictData)
+	expectMissing(t, st, "c")
+	expect(t, st, "b", evictData)
+
+	put(t, st, "f", evictData)
+	expectMissing(t, st, "b")
+
+	// keys without ttl are never evicted
+	err := st.Create(storage.EntryFromData("g", evictData, now, time.Time{}))
+	if !errors.Is(err, storage.ErrOutOfMemory) {
+		t.Fatalf("Create: got %v, want %v", err, storage.ErrOutOfMemory)
+	}
+	for _, key := range []string{"a", "d", "e", "f"} {
+		expect(t, st, key, evictData)
+	}
+}
+
+// busy shards are waited for instead of failing the write, while there is enough memory to evict
+func TestEvictionContention(t *testing.T) {
+	const (
+		workers = 16
+		writes  = 500
+	)
+
+	st := openImproved(t, "", storage.WithMaxMemory(100*evictMemory), storage.WithEvictionPolicy(storage.AllKeysLRU))
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// large values need memory of many shards at once
+			data := evictData
+			if w%2 == 0 {
+				data = strings.Repeat("x", 30*evictMemory)
+			}
+
+			for i := range writes {
+				entry := storage.EntryFromData(fmt.Sprintf("%v-%v", w, i), data, time.Now(), time.Time{})
+				if err := st.Create(entry); err != nil {
+					t.Errorf("Create: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"container/heap"
+	"time"
+)
+
+// actively removes expired entries each interval,
+// so that keys, which are never read again, don't live forever
+//
+// each tick only keys, which are actually due, are touched:
+// they are taken from the shard expiry indices in batches of st.expiryBatch,
+// releasing the lock in between, until either nothing is due
+// or a quarter of the interval is spent
+// the next tick starts at the shard, where the previous one has stopped,
+// so that every shard gets swept even under heavy expiry
+func (st *ImprovedStorage) expireLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// shard to start the next tick at
+	next := 0
+
+	for {
+		select {
+		case <-st.done:
+			return
+		case <-ticker.C:
+			next = st.expireShards(next, time.Now().Add(interval/4))
+		}
+	}
+}
+
+// sweeps shards one by one, starting at the provided one, until every shard is swept or the deadline passes
+// returns the shard, which wasn't swept completely
+func (st *ImprovedStorage) expireShards(start int, deadline time.Time) int {
+	shards := st.cc.shards
+
+	for i := range shards {
+		idx := (start + i) % len(shards)
+		sh := shards[idx]
+
+		for {
+			if !time.Now().Before(deadline) {
+				return idx
+			}
+
+			sh.Lock()
+			n := sh.expireDue(time.Now(), st.expiryBatch)
+			sh.Unlock()
+
+			if n < st.expiryBatch {
+				break
+			}
+		}
+	}
+
+	return start
+}
+
+// removes up to limit due entries
+// returns the amount of removed entries
+// write lock should be held by the caller
+func (sh *shard) expireDue(now time.Time, limit int) int {
+	due := sh.ttl.due(now, limit)
+	for _, key := range due {
+		sh.remove(key)
+	}
+
+	return len(due)
+}
+
+// index of keys, ordered by their expiration time
+// only keys with a non-zero ExpiresAt are indexed
+type expiryIndex struct {
+	heap  expiryHeap
+	items map[Key]*expiryItem
+}
+
+func newExpiryIndex() *expiryIndex {
+	return &expiryIndex{
+		heap:  expiryHeap{},
+		items: make(map[Key]*expiryItem),
+	}
+}
+
+// sets (or updates) expiration time of the key
+// zero time removes the key from the index
+func (ix *expiryIndex) set(key Key, at time.Time) {
+	if at.IsZero() {
+		ix.remove(key)
+		return
+	}
+
+	if item, ok := ix.items[key]; ok {
+		item.at = at
+		heap.Fix(&ix.heap, item.index)
+		return
+	}
+
+	item := &expiryItem{key: key, at: at}
+	heap.Push(&ix.heap, item)
+	ix.items[key] = item
+}
+
+func (ix *expiryIndex) remove(key Key) {
+	item, ok := ix.items[key]
+	if !ok {
+		return
+	}
+
+	heap.Remove(&ix.heap, item.index)
+	delete(ix.items, key)
+}
+
+// pops up to limit keys, which expire by the provided moment
+func (ix *expiryIndex) due(now time.Time, limit int) []Key {
+	keys := []Key{}
+
+	for len(ix.heap) > 0 && len(keys) < limit {
+		item := ix.heap[0]
+		if item.at.After(now) {
+			break
+		}
+
+		heap.Pop(&ix.heap)
+		delete(ix.items, item.key)
+		keys = append(keys, item.key)
+	}
+
+	return keys
+}
+
+type expiryItem struct {
+	key Key
+	at  time.Time
+	// position in the heap
+	index int
+}
+
+// min-heap over expiration time, implements heap.Interface
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,1037 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	lsmMaxLevels = 7
+	// each level may hold lsmLevelMultiplier times more bytes than the previous one
+	lsmLevelMultiplier = 10
+	// how often compaction conditions are checked, besides memtable flushes
+	lsmCheckInterval = time.Second
+
+	defaultLSMMemtableSize = 4 << 20
+	defaultLSMTableSize    = 2 << 20
+	defaultLSMLevelSize    = 10 << 20
+	defaultLSML0Tables     = 4
+	defaultLSMImmutable    = 4
+)
+
+// log-structured merge tree storage impl
+//
+// writes go to the write-ahead log and the in-mem memtable,
+// full memtables are flushed into immutable sorted tables <base>.sst.<id> on level 0,
+// which are then merged into larger non-overlapping levels in the background
+// writes wait, while there are maxImmutable memtables waiting for a flush
+//
+// the set of live tables is recorded in the manifest <base>.manifest,
+// so that a crash in the middle of a flush or compaction leaves the previous set intact
+type LSMStorage struct {
+	// guards memtables and levels
+	// reads hold it for the whole lookup, so that compaction can't close a table beneath them
+	mu  sync.RWMutex
+	mem *memtable
+	// sealed memtables, waiting for a flush, newest first
+	imm []*memtable
+	// signaled, once a sealed memtable is flushed
+	flushed *sync.Cond
+	// level 0 tables may overlap and are ordered newest first,
+	// tables of the other levels are ordered by key and never overlap
+	levels [][]*sstable
+
+	base string
+	log  *wal
+
+	// fields below are only changed by the compaction worker
+	version uint64
+	nextID  uint64
+	// last log segment, which records are already in tables
+	walSegment uint64
+	// largest key of the last compacted table of each level
+	pointers []Key
+
+	memtableSize int64
+	tableSize    int64
+	levelSize    int64
+	l0Tables     int
+	maxImmutable int
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+
+	compaction compaction
+	flush      chan struct{}
+
+	// receives changes, may be nil
+	feed *Feed
+	// versions of written entries
+	// versions of the tables are covered by the one, recorded in the manifest,
+	// and versions of the log are observed on replay
+	versions *versionClock
+
+	done   chan struct{}
+	errLog *logrus.Logger
+}
+
+// set of live tables
+type manifest struct {
+	Version    uint64     `json:"version"`
+	NextID     uint64     `json:"next_id"`
+	WALSegment uint64     `json:"wal_segment"`
+	Levels     [][]uint64 `json:"levels"`
+	// version clock at the moment of writing, not less than any version in the tables
+	MaxVersion uint64 `json:"max_version"`
+}
+
+// latest state of a key
+type lsmRecord struct {
+	val       Value
+	tombstone bool
+}
+
+// Option configuration pattern
+type LSMOption func(*LSMStorage)
+
+// sets the size of a memtable, after which it is flushed to disk
+func WithLSMMemtableSize(size int64) LSMOption {
+	return func(st *LSMStorage) {
+		st.memtableSize = size
+	}
+}
+
+// sets the size of tables, produced by compaction
+func WithLSMTableSize(size int64) LSMOption {
+	return func(st *LSMStorage) {
+		st.tableSize = size
+	}
+}
+
+// sets the size of level 1, each next level is 10 times larger
+func WithLSMLevelSize(size int64) LSMOption {
+	return func(st *LSMStorage) {
+		st.levelSize = size
+	}
+}
+
+// sets the amount of level 0 tables, after which they are merged into level 1
+func WithLSML0Tables(n int) LSMOption {
+	return func(st *LSMStorage) {
+		st.l0Tables = n
+	}
+}
+
+// sets the amount of sealed memtables, after which writes wait for a flush
+func WithLSMMaxImmutable(n int) LSMOption {
+	return func(st *LSMStorage) {
+		if n > 0 {
+			st.maxImmutable = n
+		}
+	}
+}
+
+// sets how often the write-ahead log is fsynced
+func WithLSMSync(policy SyncPolicy, interval time.Duration) LSMOption {
+	return func(st *LSMStorage) {
+		st.syncPolicy = policy
+		st.syncInterval = interval
+	}
+}
+
+// sets the feed, which receives changes of the storage
+func WithLSMFeed(feed *Feed) LSMOption {
+	return func(st *LSMStorage) {
+		st.feed = feed
+	}
+}
+
+func NewLSMStorage(base string, errLog *logrus.Logger, opts ...LSMOption) (*LSMStorage, error) {
+	st := &LSMStorage{
+		mem:      newMemtable(),
+		levels:   make([][]*sstable, lsmMaxLevels),
+		base:     base,
+		nextID:   1,
+		pointers: make([]Key, lsmMaxLevels),
+
+		memtableSize: defaultLSMMemtableSize,
+		tableSize:    defaultLSMTableSize,
+		levelSize:    defaultLSMLevelSize,
+		l0Tables:     defaultLSML0Tables,
+		maxImmutable: defaultLSMImmutable,
+		syncPolicy:   defaultSyncPolicy,
+		syncInterval: defaultSyncInterval,
+
+		versions: newVersionClock(),
+
+		flush:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		errLog: errLog,
+	}
+
+	for _, opt := range opts {
+		opt(st)
+	}
+
+	st.flushed = sync.NewCond(&st.mu)
+
+	if err := st.restore(); err != nil {
+		st.closeTables()
+		return nil, err
+	}
+
+	go st.compactLoop()
+
+	return st, nil
+}
+
+func (st *LSMStorage) Create(entry Entry) error {
+	st.lockWrite()
+	defer st.mu.Unlock()
+
+	_, ok, err := st.live(entry.Key, time.Now())
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrKeyAlreadyExists
+	}
+	entry.Value.Version = st.versions.next()
+
+	return st.write(entry.Key, lsmRecord{val: entry.Value})
+}
+
+func (st *LSMStorage) Read(key Key) (Entry, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	val, ok, err := st.live(key, time.Now())
+	if err != nil {
+		return Entry{}, err
+	}
+	if !ok {
+		return Entry{}, ErrKeyNotFound
+	}
+
+	return Entry{Key: key, Value: val}, nil
+}
+
+func (st *LSMStorage) Update(entry Entry) error {
+	st.lockWrite()
+	defer st.mu.Unlock()
+
+	cur, ok, err := st.live(entry.Key, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	// current ttl is kept, unless a new one is provided
+	if entry.Value.ExpiresAt.IsZero() {
+		entry.Value.ExpiresAt = cur.ExpiresAt
+	}
+	entry.Value.Version = st.versions.next()
+
+	return st.write(entry.Key, lsmRecord{val: entry.Value})
+}
+
+func (st *LSMStorage) Delete(key Key) error {
+	st.lockWrite()
+	defer st.mu.Unlock()
+
+	_, ok, err := st.live(key, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	// tombstone shadows older values in the tables, until compaction drops both
+	return st.write(key, lsmRecord{tombstone: true})
+}
+
+// merges every source of records, so the result is a point-in-time view of the range
+func (st *LSMStorage) Scan(start, end Key, limit int) ([]Entry, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	var (
+		now     = time.Now()
+		entries = []Entry{}
+		it      = newMergeIter(st.iters(start))
+	)
+
+	for ; it.valid(); it.next() {
+		if end != "" && it.key() >= end {
+			break
+		}
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+
+		rec := it.record()
+		if rec.tombstone || rec.val.expired(now) {
+			continue
+		}
+
+		entries = append(entries, Entry{Key: it.key(), Value: rec.val})
+	}
+
+	if err := it.err(); err != nil {
+		st.logErr(err)
+		return nil, ErrFileRead
+	}
+
+	return entries, nil
+}
+
+func (st *LSMStorage) ScanPrefix(prefix Key) ([]Entry, error) {
+	return st.Scan(prefix, PrefixEnd(prefix), 0)
+}
+
+// flushes the memtable and merges level 0 in the background
+func (st *LSMStorage) Compact() error {
+	if !st.compaction.mu.TryLock() {
+		return ErrCompactionRunning
+	}
+
+	go func() {
+		defer st.compaction.mu.Unlock()
+		st.logErr(st.compact(true))
+	}()
+
+	return nil
+}
+
+func (st *LSMStorage) CompactionStatus() CompactionStatus {
+	return st.compaction.current()
+}
+
+// closes the log and the tables
+// unflushed memtables are restored from the log on the next start
+func (st *LSMStorage) Close() error {
+	close(st.done)
+
+	// waiting for a running flush or compaction
+	st.compaction.mu.Lock()
+	defer st.compaction.mu.Unlock()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// stalled writers are released, so that they fail on the closed log
+	st.flushed.Broadcast()
+
+	if err := st.log.close(); err != nil {
+		return err
+	}
+
+	return st.closeTables()
+}
+
+// takes the write lock, once there are less than maxImmutable sealed memtables,
+// so that writes are stalled, while flushes fall behind, instead of piling memtables up in memory
+func (st *LSMStorage) lockWrite() {
+	st.mu.Lock()
+
+	for len(st.imm) >= st.maxImmutable {
+		select {
+		case <-st.done:
+			return
+		default:
+		}
+
+		st.flushed.Wait()
+	}
+}
+
+// returns the value of the key, unless it is deleted or expired
+// lock should be held by the caller
+func (st *LSMStorage) live(key Key, now time.Time) (Value, bool, error) {
+	rec, ok, err := st.get(key)
+	if err != nil {
+		st.logErr(err)
+		return Value{}, false, ErrFileRead
+	}
+
+	if !ok || rec.tombstone || rec.val.expired(now) {
+		return Value{}, false, nil
+	}
+
+	return rec.val, true, nil
+}
+
+// looks the key up from the newest source to the oldest one
+// lock should be held by the caller
+func (st *LSMStorage) get(key Key) (lsmRecord, bool, error) {
+	if rec, ok := st.mem.data[key]; ok {
+		return rec, true, nil
+	}
+
+	for _, mem := range st.imm {
+		if rec, ok := mem.data[key]; ok {
+			return rec, true, nil
+		}
+	}
+
+	for _, t := range st.levels[0] {
+		if rec, ok, err := t.get(key); err != nil || ok {
+			return rec, ok, err
+		}
+	}
+
+	for _, level := range st.levels[1:] {
+		// first table with largest >= key
+		i := sort.Search(len(level), func(i int) bool { return level[i].largest >= key })
+		if i == len(level) {
+			continue
+		}
+
+		if rec, ok, err := level[i].get(key); err != nil || ok {
+			return rec, ok, err
+		}
+	}
+
+	return lsmRecord{}, false, nil
+}
+
+// logs the record and puts it into the memtable
+// write lock should be held by the caller
+func (st *LSMStorage) write(key Key, rec lsmRecord) error {
+	wr := walRecord{Op: walPut, Key: key, Value: &rec.val}
+	if rec.tombstone {
+		wr = walRecord{Op: walDel, Key: key}
+	}
+
+	if err := st.log.append(wr); err != nil {
+		return err
+	}
+
+	st.mem.set(key, rec)
+
+	if rec.tombstone {
+		st.feed.del(key)
+	} else {
+		st.feed.put(key, rec.val)
+	}
+
+	if st.mem.size >= st.memtableSize {
+		// the record is already logged, so the write itself succeeded
+		st.logErr(st.seal())
+	}
+
+	return nil
+}
+
+// hands the memtable over to the compaction worker
+// write lock should be held by the caller
+func (st *LSMStorage) seal() error {
+	sealed, err := st.log.rotate()
+	if err != nil {
+		return fmt.Errorf("wal.rotate: %v", err)
+	}
+
+	st.mem.walSegment = sealed
+	st.imm = append([]*memtable{st.mem}, st.imm...)
+	st.mem = newMemtable()
+
+	select {
+	case st.flush <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// iterators over every source, newest first
+// lock should be held by the caller
+func (st *LSMStorage) iters(start Key) []lsmIterator {
+	iters := []lsmIterator{st.mem.iter(start)}
+	for _, mem := range st.imm {
+		iters = append(iters, mem.iter(start))
+	}
+
+	for _, level := range st.levels {
+		for _, t := range level {
+			iters = append(iters, t.iter(start))
+		}
+	}
+
+	return iters
+}
+
+// flushes sealed memtables and compacts levels, which are over their limits
+func (st *LSMStorage) compactLoop() {
+	ticker := time.NewTicker(lsmCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-st.done:
+			return
+		case <-st.flush:
+		case <-ticker.C:
+		}
+
+		if !st.pending() || !st.compaction.mu.TryLock() {
+			continue
+		}
+		st.logErr(st.compact(false))
+		st.compaction.mu.Unlock()
+	}
+}
+
+// checks whether there's anything for the compaction worker to do
+func (st *LSMStorage) pending() bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return len(st.imm) > 0 || st.pickLevel() >= 0
+}
+
+// flushes every sealed memtable and compacts levels, until they fit into their limits
+// if forced, the memtable is flushed and level 0 is compacted regardless of the limits
+// compaction mutex should be held by the caller
+func (st *LSMStorage) compact(force bool) (err error) {
+	st.compaction.start(st.version)
+	defer func() { st.compaction.finish(err, st.version) }()
+
+	if force {
+		st.mu.Lock()
+		if len(st.mem.data) > 0 {
+			err = st.seal()
+		}
+		st.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	st.compaction.setPhase(phaseFlushing)
+	for {
+		st.mu.RLock()
+		var mem *memtable
+		if len(st.imm) > 0 {
+			mem = st.imm[len(st.imm)-1]
+		}
+		st.mu.RUnlock()
+
+		if mem == nil {
+			break
+		}
+
+		if err := st.flushMemtable(mem); err != nil {
+			return fmt.Errorf("flush: %v", err)
+		}
+	}
+
+	st.compaction.setPhase(phaseMerging)
+	for {
+		st.mu.RLock()
+		level := st.pickLevel()
+		if force && level < 0 && len(st.levels[0]) > 0 {
+			level = 0
+		}
+		st.mu.RUnlock()
+
+		if level < 0 {
+			break
+		}
+
+		if err := st.compactLevel(level); err != nil {
+			return fmt.Errorf("level %v: %v", level, err)
+		}
+	}
+
+	return nil
+}
+
+// writes the oldest sealed memtable into a level 0 table
+// compaction mutex should be held by the caller
+func (st *LSMStorage) flushMemtable(mem *memtable) error {
+	st.compaction.addTotal(mem.size)
+
+	// memtable is immutable once sealed, so it can be read without the lock
+	tables, err := st.writeTables(mem.iter(""), 0, false)
+	if err != nil {
+		return err
+	}
+
+	levels := st.copyLevels()
+	levels[0] = append(tables, levels[0]...)
+
+	if err := st.writeManifest(levels, mem.walSegment); err != nil {
+		st.removeTables(tables)
+		return err
+	}
+
+	st.mu.Lock()
+	st.levels = levels
+	st.imm = st.imm[:len(st.imm)-1]
+	st.flushed.Broadcast()
+	st.mu.Unlock()
+
+	if err := st.log.remove(mem.walSegment); err != nil {
+		return fmt.Errorf("wal.remove: %v", err)
+	}
+
+	return nil
+}
+
+// returns the level, which should be compacted next, or -1
+// lock should be held by the caller
+func (st *LSMStorage) pickLevel() int {
+	if len(st.levels[0]) >= st.l0Tables {
+		return 0
+	}
+
+	limit := st.levelSize
+	// last level has nowhere to go
+	for level := 1; level < lsmMaxLevels-1; level++ {
+		var size int64
+		for _, t := range st.levels[level] {
+			size += t.size
+		}
+
+		if size > limit {
+			return level
+		}
+		limit *= lsmLevelMultiplier
+	}
+
+	return -1
+}
+
+// merges tables of the level with overlapping tables of the next one
+// every level 0 table is taken at once, since they overlap,
+// other levels give up a single table, picked round-robin by key
+// compaction mutex should be held by the caller
+func (st *LSMStorage) compactLevel(level int) error {
+	st.mu.RLock()
+	levels := st.copyLevels()
+	st.mu.RUnlock()
+
+	upper := levels[level]
+	if level > 0 {
+		upper = []*sstable{st.pickTable(level, levels[level])}
+	}
+
+	lo, hi := upper[0].smallest, upper[0].largest
+	for _, t := range upper[1:] {
+		lo, hi = min(lo, t.smallest), max(hi, t.largest)
+	}
+
+	lower := []*sstable{}
+	for _, t := range levels[level+1] {
+		if t.overlaps(lo, hi) {
+			lower = append(lower, t)
+		}
+	}
+
+	// upper tables are newer, so their records come first
+	var total int64
+	iters := []lsmIterator{}
+	for _, t := range append(append([]*sstable{}, upper...), lower...) {
+		iters = append(iters, t.iter(""))
+		total += t.size
+	}
+	st.compaction.addTotal(total)
+
+	// tombstones and expired values may only be dropped,
+	// if there are no older values beneath them
+	drop := true
+	for _, deeper := range levels[level+2:] {
+		if len(deeper) > 0 {
+			drop = false
+		}
+	}
+
+	tables, err := st.writeTables(newMergeIter(iters), st.tableSize, drop)
+	if err != nil {
+		return err
+	}
+
+	levels[level] = without(levels[level], upper)
+	levels[level+1] = append(without(levels[level+1], lower), tables...)
+	sort.Slice(levels[level+1], func(i, j int) bool {
+		return levels[level+1][i].smallest < levels[level+1][j].smallest
+	})
+
+	if err := st.writeManifest(levels, st.walSegment); err != nil {
+		st.removeTables(tables)
+		return err
+	}
+
+	st.mu.Lock()
+	st.levels = levels
+	st.mu.Unlock()
+
+	// nobody is reading the inputs anymore, since readers hold the lock for the whole lookup
+	st.removeTables(append(upper, lower...))
+
+	return syncDir(filepath.Dir(st.base))
+}
+
+// picks the first table after the one, compacted last time on this level
+func (st *LSMStorage) pickTable(level int, tables []*sstable) *sstable {
+	picked := tables[0]
+	for _, t := range tables {
+		if t.smallest > st.pointers[level] {
+			picked = t
+			break
+		}
+	}
+
+	st.pointers[level] = picked.largest
+
+	return picked
+}
+
+// writes records of the iterator into new tables
+// if split is positive, a new table is started once the current one reaches it
+// compaction mutex should be held by the caller
+func (st *LSMStorage) writeTables(it lsmIterator, split int64, drop bool) ([]*sstable, error) {
+	var (
+		now    = time.Now()
+		tables = []*sstable{}
+		tw     *tableWriter
+		id     uint64
+	)
+
+	finish := func() error {
+		if err := tw.finish(); err != nil {
+			return err
+		}
+
+		t, err := openTable(id, st.tablePath(id))
+		if err != nil {
+			return err
+		}
+
+		tables = append(tables, t)
+		tw = nil
+
+		return nil
+	}
+
+	for ; it.valid(); it.next() {
+		rec := it.record()
+		if drop && (rec.tombstone || rec.val.expired(now)) {
+			continue
+		}
+
+		if tw == nil {
+			id = st.nextID
+			st.nextID++
+
+			var err error
+			if tw, err = createTable(st.tablePath(id)); err != nil {
+				st.removeTables(tables)
+				return nil, err
+			}
+		}
+
+		n, err := tw.add(it.key(), rec)
+		if err != nil {
+			tw.fd.Close()
+			st.removeTables(tables)
+			return nil, err
+		}
+		st.compaction.done.Add(n)
+
+		if split > 0 && tw.offset >= split {
+			if err := finish(); err != nil {
+				st.removeTables(tables)
+				return nil, err
+			}
+		}
+	}
+
+	if err := it.err(); err != nil {
+		if tw != nil {
+			tw.fd.Close()
+		}
+		st.removeTables(tables)
+		return nil, err
+	}
+
+	if tw != nil {
+		if err := finish(); err != nil {
+			st.removeTables(tables)
+			return nil, err
+		}
+	}
+
+	return tables, nil
+}
+
+// atomically replaces the manifest
+// compaction mutex should be held by the caller
+func (st *LSMStorage) writeManifest(levels [][]*sstable, walSegment uint64) error {
+	m := manifest{
+		Version:    st.version + 1,
+		NextID:     st.nextID,
+		WALSegment: walSegment,
+		Levels:     make([][]uint64, len(levels)),
+		MaxVersion: st.versions.current(),
+	}
+
+	for i, level := range levels {
+		m.Levels[i] = []uint64{}
+		for _, t := range level {
+			m.Levels[i] = append(m.Levels[i], t.id)
+		}
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return ErrJSONMarshall
+	}
+
+	path := st.base + ".manifest"
+	if err := writeFileSync(path+".tmp", raw); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+	if err := syncDir(filepath.Dir(st.base)); err != nil {
+		return err
+	}
+
+	st.version, st.walSegment = m.Version, m.WALSegment
+
+	return nil
+}
+
+// opens tables of the manifest and replays the log on top of them
+// tables, which are not in the manifest, are leftovers of an interrupted flush or compaction
+func (st *LSMStorage) restore() error {
+	var m manifest
+
+	raw, err := os.ReadFile(st.base + ".manifest")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("os.ReadFile: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return ErrSnapshotCorrupted
+		}
+	}
+
+	live := make(map[uint64]bool)
+	for i, ids := range m.Levels {
+		if i >= lsmMaxLevels {
+			return ErrSnapshotCorrupted
+		}
+
+		for _, id := range ids {
+			t, err := openTable(id, st.tablePath(id))
+			if err != nil {
+				return err
+			}
+
+			st.levels[i] = append(st.levels[i], t)
+			live[id] = true
+		}
+	}
+
+	ids, err := st.tables()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !live[id] {
+			os.Remove(st.tablePath(id))
+		}
+	}
+
+	st.version, st.walSegment = m.Version, m.WALSegment
+	st.versions.observe(m.MaxVersion)
+	if m.NextID > st.nextID {
+		st.nextID = m.NextID
+	}
+
+	wl, err := openWAL(st.base, m.WALSegment, st.mem.apply, st.syncPolicy, st.syncInterval, st.errLog)
+	if err != nil {
+		return fmt.Errorf("openWAL: %v", err)
+	}
+	st.log = wl
+
+	for _, rec := range st.mem.data {
+		st.versions.observe(rec.val.Version)
+	}
+
+	return st.trackExpirations()
+}
+
+// hands keys with ttl over to the feed, since lsm has no in-mem ttl index
+// only the newest record of a key counts, so overwritten and deleted ttls are skipped
+func (st *LSMStorage) trackExpirations() error {
+	if st.feed == nil {
+		return nil
+	}
+
+	it := newMergeIter(st.iters(""))
+	for ; it.valid(); it.next() {
+		if rec := it.record(); !rec.tombstone && !rec.val.ExpiresAt.IsZero() {
+			st.feed.track(it.key(), rec.val.ExpiresAt)
+		}
+	}
+
+	if err := it.err(); err != nil {
+		return fmt.Errorf("it.err: %v", err)
+	}
+
+	return nil
+}
+
+// lists tables, present on disk
+func (st *LSMStorage) tables() ([]uint64, error) {
+	paths, err := filepath.Glob(st.base + ".sst.*")
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob: %v", err)
+	}
+
+	ids := []uint64{}
+	for _, path := range paths {
+		id, err := strconv.ParseUint(strings.TrimPrefix(path, st.base+".sst."), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// lock should be held by the caller
+func (st *LSMStorage) copyLevels() [][]*sstable {
+	levels := make([][]*sstable, len(st.levels))
+	for i, level := range st.levels {
+		levels[i] = append([]*sstable{}, level...)
+	}
+
+	return levels
+}
+
+func (st *LSMStorage) removeTables(tables []*sstable) {
+	for _, t := range tables {
+		t.close()
+		if err := os.Remove(st.tablePath(t.id)); err != nil {
+			st.logErr(fmt.Errorf("os.Remove: %v", err))
+		}
+	}
+}
+
+func (st *LSMStorage) closeTables() error {
+	for _, level := range st.levels {
+		for _, t := range level {
+			t.close()
+		}
+	}
+
+	return nil
+}
+
+func (st *LSMStorage) tablePath(id uint64) string {
+	return fmt.Sprintf("%v.sst.%020d", st.base, id)
+}
+
+func (st *LSMStorage) logErr(err error) {
+	if err == nil {
+		return
+	}
+
+	st.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+}
+
+// returns tables, which are not in the excluded set
+func without(tables, excluded []*sstable) []*sstable {
+	res := []*sstable{}
+	for _, t := range tables {
+		found := false
+		for _, e := range excluded {
+			found = found || t == e
+		}
+
+		if !found {
+			res = append(res, t)
+		}
+	}
+
+	return res
+}
+
+// in-mem sorted buffer of the latest writes
+type memtable struct {
+	data map[Key]lsmRecord
+	keys *skiplist[Key]
+	// approximate size in bytes
+	size int64
+	// last log segment with records of the memtable, set once it is sealed
+	walSegment uint64
+}
+
+func newMemtable() *memtable {
+	return &memtable{
+		data: make(map[Key]lsmRecord),
+		keys: newSkiplist(keyLess),
+	}
+}
+
+func (mt *memtable) set(key Key, rec lsmRecord) {
+	if old, ok := mt.data[key]; ok {
+		mt.size -= entrySize(key, old.val)
+	}
+
+	mt.data[key] = rec
+	mt.keys.insert(key)
+	mt.size += entrySize(key, rec.val)
+}
+
+// applies a replayed log record
+func (mt *memtable) apply(rec walRecord) {
+	switch rec.Op {
+	case walPut:
+		if rec.Value != nil {
+			mt.set(rec.Key, lsmRecord{val: *rec.Value})
+		}
+	case walDel:
+		mt.set(rec.Key, lsmRecord{tombstone: true})
+	}
+}
+
+// iterates over records of the memtable, starting with the first key >= start
+type memIter struct {
+	mt   *memtable
+	node *skipnode[Key]
+}
+
+func (mt *memtable) iter(start Key) *memIter {
+	return &memIter{mt: mt, node: mt.keys.seek(start)}
+}
+
+func (it *memIter) valid() bool       { return it.node != nil }
+func (it *memIter) key() Key          { return it.node.key }
+func (it *memIter) record() lsmRecord { return it.mt.data[it.node.key] }
+func (it *memIter) next()             { it.node = it.node.next[0] }
+func (it *memIter) err() error        { return nil }
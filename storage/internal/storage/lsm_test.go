@@ -0,0 +1,301 @@
+package storage_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// small memtables and tables, so that a few hundred writes are flushed and merged many times
+// small level size makes them spread over several levels
+func openLSM(t *testing.T, path string, levelSize int64, opts ...storage.LSMOption) *storage.LSMStorage {
+	t.Helper()
+
+	errLog := logrus.New()
+	errLog.SetOutput(io.Discard)
+
+	opts = append([]storage.LSMOption{
+		storage.WithLSMMemtableSize(1 << 10),
+		storage.WithLSMTableSize(2 << 10),
+		storage.WithLSMLevelSize(levelSize),
+		storage.WithLSML0Tables(2),
+		storage.WithLSMSync(storage.SyncAlways, 0),
+	}, opts...)
+
+	st, err := storage.NewLSMStorage(path, errLog, opts...)
+	if err != nil {
+		t.Fatalf("NewLSMStorage: %v", err)
+	}
+
+	return st
+}
+
+// waits for background flushes and compactions, started by writes, to finish
+func settle(t *testing.T, st storage.Compactor) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for st.CompactionStatus().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("compaction didn't finish in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// reports whether any table on disk contains the data
+func tablesContain(t *testing.T, path string, data string) bool {
+	t.Helper()
+
+	tables, err := filepath.Glob(path + ".sst.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		raw, err := os.ReadFile(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(raw, []byte(data)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestLSMFlushAndCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	// every table fits into level 1, so it's the last one
+	st := openLSM(t, path, 1<<20)
+
+	value := strings.Repeat("v", 50)
+	for round := range 3 {
+		for i := range 100 {
+			put(t, st, fmt.Sprintf("key-%03d", i), fmt.Sprintf("%v-%v", value, round))
+		}
+	}
+
+	settle(t, st)
+	if !tablesContain(t, path, "key-000") {
+		t.Fatal("memtables are not flushed")
+	}
+
+	for i := range 50 {
+		if err := st.Delete(storage.Key(fmt.Sprintf("key-%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// everything is merged into the last level, where tombstones have nothing to shadow
+	compact(t, st)
+
+	if tablesContain(t, path, "key-000") {
+		t.Fatal("deleted key is kept by the tables after compaction")
+	}
+
+	check := func(st storage.Storage) {
+		t.Helper()
+
+		for i := range 100 {
+			key := fmt.Sprintf("key-%03d", i)
+			if i < 50 {
+				expectMissing(t, st, key)
+			} else {
+				expect(t, st, key, value+"-2")
+			}
+		}
+	}
+	check(st)
+
+	entries, err := st.ScanPrefix("key-")
+	if err != nil || len(entries) != 50 || entries[0].Key != "key-050" {
+		t.Fatalf("ScanPrefix: %v entries (%v)", len(entries), err)
+	}
+
+	// tables are restored from the manifest, the unflushed memtable - from the log
+	put(t, st, "key-000", "back")
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openLSM(t, path, 1<<20)
+	defer st.Close()
+
+	expect(t, st, "key-000", "back")
+	for i := 1; i < 100; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		if i < 50 {
+			expectMissing(t, st, key)
+		} else {
+			expect(t, st, key, value+"-2")
+		}
+	}
+}
+
+func TestLSMLeftoverTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openLSM(t, path, 1<<20)
+
+	put(t, st, "a", "1")
+	compact(t, st)
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// table of an interrupted flush, which never made it to the manifest
+	leftover := path + ".sst.00000000000000009999"
+	if err := os.WriteFile(leftover, []byte("garbage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openLSM(t, path, 1<<20)
+	defer st.Close()
+
+	expect(t, st, "a", "1")
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Fatalf("leftover table is not removed: %v", err)
+	}
+}
+
+func TestLSMLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openLSM(t, path, 4<<10)
+
+	// newer values and tombstones on the upper levels shadow the older ones below
+	for round := range 5 {
+		for i := range 100 {
+			key := fmt.Sprintf("key-%03d", i)
+			if round == 4 && i%3 == 0 {
+				if err := st.Delete(storage.Key(key)); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			put(t, st, key, fmt.Sprintf("value-%v", round))
+		}
+		compact(t, st)
+	}
+
+	check := func(st storage.Storage) {
+		t.Helper()
+
+		for i := range 100 {
+			key := fmt.Sprintf("key-%03d", i)
+			if i%3 == 0 {
+				expectMissing(t, st, key)
+			} else {
+				expect(t, st, key, "value-4")
+			}
+		}
+	}
+	check(st)
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openLSM(t, path, 4<<10)
+	defer st.Close()
+
+	check(st)
+}
+
+// versions of flushed entries are not in the log anymore, so they are covered by the manifest
+func TestLSMVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openLSM(t, path, 1<<20)
+
+	put(t, st, "a", "1")
+	flushed := version(t, st, "a")
+	compact(t, st)
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path + ".manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+	if max, _ := m["max_version"].(float64); uint64(max) < flushed {
+		t.Fatalf("manifest version %v is less than the flushed one %v", uint64(max), flushed)
+	}
+
+	// as if the clock went back after the restart
+	ahead := flushed + 1<<40
+	m["max_version"] = ahead
+	if raw, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".manifest", raw, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	st = openLSM(t, path, 1<<20)
+	defer st.Close()
+
+	put(t, st, "b", "2")
+	if v := version(t, st, "b"); v <= ahead {
+		t.Fatalf("version %v is handed out after %v", v, ahead)
+	}
+}
+
+// keys with ttl, restored from tables and the log, are tracked by the feed,
+// while ttls, prolonged or deleted later, are not
+func TestLSMRestoredExpirations(t *testing.T) {
+	const keys = 200
+
+	path := filepath.Join(t.TempDir(), "data")
+	st := openLSM(t, path, 1<<20)
+
+	expiresAt := time.Now().Add(time.Second)
+	for i := range keys + 20 {
+		if err := st.Create(storage.EntryFromData(fmt.Sprintf("key-%03d", i), "value", time.Now(), expiresAt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := keys; i < keys+10; i++ {
+		if err := st.Update(storage.EntryFromData(fmt.Sprintf("key-%03d", i), "value", time.Now(), time.Now().Add(time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := keys + 10; i < keys+20; i++ {
+		if err := st.Delete(storage.Key(fmt.Sprintf("key-%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settle(t, st)
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := storage.NewFeed()
+	defer feed.Close()
+
+	st = openLSM(t, path, 1<<20, storage.WithLSMFeed(feed))
+	defer st.Close()
+
+	start := feed.Revision()
+	time.Sleep(time.Until(expiresAt) + time.Second)
+
+	if got := feed.Revision() - start; got != keys {
+		t.Fatalf("%v expirations reported, want %v", got, keys)
+	}
+}
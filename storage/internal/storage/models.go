@@ -14,12 +14,37 @@ type Entry struct {
 
 type Key string
 
+// kind of the value
+// values of collection types hold their JSON encoding in Data,
+// once they are read or stored on disk
+type ValueType string
+
+const (
+	TypeString ValueType = ""
+	TypeList   ValueType = "list"
+	TypeHash   ValueType = "hash"
+	TypeSet    ValueType = "set"
+	TypeZSet   ValueType = "zset"
+)
+
+// binary codes of the value types, used by on-disk records
+var valueTypes = []ValueType{TypeString, TypeList, TypeHash, TypeSet, TypeZSet}
+
 type Value struct {
 	// essentially a value of the key
-	Data string `json:"data"`
+	Data string    `json:"data"`
+	Type ValueType `json:"type,omitempty"`
 	// time info
 	UpdatedAt time.Time `json:"updated_at"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// incremented on every write, used for conditional writes
+	Version uint64 `json:"version"`
+	// opaque flags of the client (e.g. of memcached), kept along with the value
+	Flags uint32 `json:"flags,omitempty"`
+
+	// contents of a collection, kept natively by the in-mem engine
+	// Data is left empty while it is set
+	coll nativeColl
 }
 
 // basiaclly a default InEntry constructor
@@ -34,6 +59,12 @@ func EntryFromData(key, value string, updatedAt, expiresAt time.Time) Entry {
 	}
 }
 
+// checks whether the value has expired by the provided moment
+// values with zero ExpiresAt never expire
+func (v Value) expired(now time.Time) bool {
+	return !v.ExpiresAt.IsZero() && !v.ExpiresAt.After(now)
+}
+
 // converting entry to json
 func (entry Entry) ToJSON() ([]byte, error) {
 	jsonEntry, err := json.Marshal(entry)
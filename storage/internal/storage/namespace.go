@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// namespace, which always exists and can't be dropped
+// its data is kept at the path of the engine config, as if there were no namespaces
+const DefaultNamespace = "default"
+
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// settings of a namespace
+type NamespaceConfig struct {
+	Name string `json:"name"`
+	// ttl of entries, created without one
+	// zero means that such entries don't expire
+	DefaultTTL time.Duration `json:"default_ttl"`
+	// approximate memory limit in bytes, zero means no limit
+	MaxMemory int64 `json:"max_memory,omitempty"`
+	// applied once the memory limit is reached
+	EvictionPolicy EvictionPolicy `json:"eviction_policy,omitempty"`
+}
+
+// isolated keyspaces, each backed by its own storage of the same engine,
+// so that keys of different namespaces never collide
+//
+// settings of the namespaces are kept in the catalog <path>.namespaces,
+// data of a namespace is kept under <path>.ns/<name>/
+type Namespaces struct {
+	// guards the set of namespaces and the catalog
+	mu     sync.RWMutex
+	engine Engine
+	conf   EngineConfig
+	spaces map[string]*namespace
+	// receives events of every namespace, see Notify
+	notify func(namespace string, ev Event)
+}
+
+type namespace struct {
+	// held by operations on the namespace, so that drop waits for them
+	mu      sync.RWMutex
+	dropped bool
+
+	Space
+}
+
+// storage of a namespace along with its settings
+type Space struct {
+	Storage Storage
+	Config  NamespaceConfig
+	// changes of the storage
+	Feed *Feed
+}
+
+// opens the default namespace and every namespace from the catalog
+func OpenNamespaces(engineName string, conf EngineConfig, defaults NamespaceConfig) (*Namespaces, error) {
+	enginesMu.RLock()
+	engine, ok := engines[engineName]
+	enginesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownEngine, engineName)
+	}
+
+	ns := &Namespaces{
+		engine: engine,
+		conf:   conf,
+		spaces: make(map[string]*namespace),
+	}
+
+	defaults.Name = DefaultNamespace
+	if err := ns.validate(defaults); err != nil {
+		return nil, err
+	}
+	if err := ns.open(defaults, conf.Path); err != nil {
+		return nil, err
+	}
+
+	catalog, err := ns.readCatalog()
+	if err != nil {
+		ns.Close()
+		return nil, err
+	}
+
+	for _, spaceConf := range catalog {
+		if err := ns.open(spaceConf, ns.dataPath(spaceConf.Name)); err != nil {
+			ns.Close()
+			return nil, fmt.Errorf("namespace %v: %w", spaceConf.Name, err)
+		}
+	}
+
+	return ns, nil
+}
+
+// opens the storage of the namespace
+func (ns *Namespaces) open(spaceConf NamespaceConfig, path string) error {
+	conf := ns.conf
+	conf.Path = path
+	conf.Options = append([]Option{}, ns.conf.Options...)
+	conf.Feed = NewFeed()
+	ns.hook(spaceConf.Name, conf.Feed)
+
+	if spaceConf.MaxMemory > 0 {
+		conf.Options = append(conf.Options, WithMaxMemory(spaceConf.MaxMemory))
+	}
+	if spaceConf.EvictionPolicy != "" {
+		conf.Options = append(conf.Options, WithEvictionPolicy(spaceConf.EvictionPolicy))
+	}
+
+	st, err := ns.engine.New(conf)
+	if err != nil {
+		conf.Feed.Close()
+		return err
+	}
+
+	ns.spaces[spaceConf.Name] = &namespace{Space: Space{Storage: st, Config: spaceConf, Feed: conf.Feed}}
+
+	return nil
+}
+
+// creates an empty namespace
+func (ns *Namespaces) Create(spaceConf NamespaceConfig) error {
+	if err := ns.validate(spaceConf); err != nil {
+		return err
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if _, ok := ns.spaces[spaceConf.Name]; ok {
+		return ErrNamespaceExists
+	}
+
+	// leftovers of a namespace, which failed to be dropped, are not picked up
+	dir := ns.dir(spaceConf.Name)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("os.RemoveAll: %v", err)
+	}
+	if ns.engine.Capabilities.Durable {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("os.MkdirAll: %v", err)
+		}
+	}
+
+	if err := ns.open(spaceConf, ns.dataPath(spaceConf.Name)); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	if err := ns.writeCatalog(); err != nil {
+		ns.spaces[spaceConf.Name].close()
+		delete(ns.spaces, spaceConf.Name)
+		os.RemoveAll(dir)
+		return err
+	}
+
+	return nil
+}
+
+func (ns *Namespaces) validate(spaceConf NamespaceConfig) error {
+	if !namespaceName.MatchString(spaceConf.Name) {
+		return fmt.Errorf("%w: name should consist of 1 to 64 letters, digits, '-' or '_'", ErrInvalidNamespace)
+	}
+
+	if spaceConf.DefaultTTL < 0 || spaceConf.MaxMemory < 0 {
+		return fmt.Errorf("%w: ttl and memory limit can't be negative", ErrInvalidNamespace)
+	}
+
+	switch spaceConf.EvictionPolicy {
+	case "", NoEviction, AllKeysLRU, AllKeysLFU, VolatileLRU, VolatileTTL:
+	default:
+		return fmt.Errorf("%w: unknown eviction policy %q", ErrInvalidNamespace, spaceConf.EvictionPolicy)
+	}
+
+	if (spaceConf.MaxMemory > 0 || spaceConf.EvictionPolicy != "") && !ns.engine.Capabilities.Eviction {
+		return fmt.Errorf("%w: engine %v doesn't support memory limits", ErrUnsupported, ns.engine.Name)
+	}
+
+	return nil
+}
+
+// returns settings of every namespace, sorted by name
+func (ns *Namespaces) List() []NamespaceConfig {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	list := make([]NamespaceConfig, 0, len(ns.spaces))
+	for _, space := range ns.spaces {
+		list = append(list, space.Config)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// removes the namespace along with every key in it
+// waits for running operations on the namespace to finish
+func (ns *Namespaces) Drop(name string) error {
+	if name == DefaultNamespace {
+		return ErrDefaultNamespace
+	}
+
+	ns.mu.Lock()
+
+	space, ok := ns.spaces[name]
+	if !ok {
+		ns.mu.Unlock()
+		return ErrNamespaceNotFound
+	}
+
+	delete(ns.spaces, name)
+	if err := ns.writeCatalog(); err != nil {
+		ns.spaces[name] = space
+		ns.mu.Unlock()
+		return err
+	}
+
+	ns.mu.Unlock()
+
+	// namespace is already out of the catalog,
+	// so nothing can acquire it from now on
+	space.mu.Lock()
+	defer space.mu.Unlock()
+
+	space.dropped = true
+
+	if err := space.close(); err != nil {
+		return err
+	}
+
+	// files are removed at once, instead of deleting the keys one by one
+	if err := os.RemoveAll(ns.dir(name)); err != nil {
+		return fmt.Errorf("os.RemoveAll: %v", err)
+	}
+
+	return nil
+}
+
+// returns the storage and settings of the namespace
+// empty name stands for the default namespace
+//
+// the namespace can't be dropped, until the returned release function is called
+func (ns *Namespaces) Acquire(name string) (Space, func(), error) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+
+	ns.mu.RLock()
+	space, ok := ns.spaces[name]
+	ns.mu.RUnlock()
+
+	if !ok {
+		return Space{}, nil, ErrNamespaceNotFound
+	}
+
+	space.mu.RLock()
+
+	// dropped in between
+	if space.dropped {
+		space.mu.RUnlock()
+		return Space{}, nil, ErrNamespaceNotFound
+	}
+
+	return space.Space, space.mu.RUnlock, nil
+}
+
+// sets the function, which receives events of every namespace,
+// including the ones, created later on
+// it is called under the feed lock, so it should never block
+func (ns *Namespaces) Notify(fn func(namespace string, ev Event)) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	ns.notify = fn
+
+	for name, space := range ns.spaces {
+		ns.hook(name, space.Feed)
+	}
+}
+
+// lock should be held by the caller
+func (ns *Namespaces) hook(name string, feed *Feed) {
+	if ns.notify == nil {
+		return
+	}
+
+	notify := ns.notify
+	feed.Notify(func(ev Event) { notify(name, ev) })
+}
+
+// closes storages of every namespace
+func (ns *Namespaces) Close() error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	var errs []error
+	for _, space := range ns.spaces {
+		space.mu.Lock()
+		errs = append(errs, space.close())
+		space.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (ns *Namespaces) dir(name string) string {
+	return filepath.Join(ns.conf.Path+".ns", name)
+}
+
+func (ns *Namespaces) dataPath(name string) string {
+	return filepath.Join(ns.dir(name), "data")
+}
+
+func (ns *Namespaces) catalogPath() string {
+	return ns.conf.Path + ".namespaces"
+}
+
+// reads settings of every namespace, except for the default one
+// namespaces of engines, which are not durable, are not kept between restarts
+func (ns *Namespaces) readCatalog() ([]NamespaceConfig, error) {
+	if !ns.engine.Capabilities.Durable {
+		return nil, nil
+	}
+
+	raw, err := os.ReadFile(ns.catalogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %v", err)
+	}
+
+	var catalog []NamespaceConfig
+	if err := json.Unmarshal(raw, &catalog); err != nil {
+		return nil, ErrJSONUnmarshall
+	}
+
+	return catalog, nil
+}
+
+// atomically replaces the catalog
+// lock should be held by the caller
+func (ns *Namespaces) writeCatalog() error {
+	if !ns.engine.Capabilities.Durable {
+		return nil
+	}
+
+	catalog := []NamespaceConfig{}
+	for name, space := range ns.spaces {
+		if name != DefaultNamespace {
+			catalog = append(catalog, space.Config)
+		}
+	}
+
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+
+	raw, err := json.Marshal(catalog)
+	if err != nil {
+		return ErrJSONMarshall
+	}
+
+	path := ns.catalogPath()
+	if err := writeFileSync(path+".tmp", raw); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// ends watches and closes the storage
+func (space Space) close() error {
+	space.Feed.Close()
+
+	// not every engine holds resources
+	if closer, ok := space.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,676 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+// approximate per-element cost of a native collection
+const elementOverhead = 16
+
+// contents of a collection, kept as a native structure,
+// so that a write changes a single element instead of re-encoding the whole value
+//
+// the in-mem engine keeps collections this way for their whole life,
+// and encodes them into Data only once they leave the cache
+// other engines decode a collection, apply the change and encode it back
+type nativeColl interface {
+	// applies the change, an operation should be valid for the current contents
+	apply(op *collOp)
+	// amount of bytes the change adds, zero for removals
+	growth(op *collOp) int64
+	// JSON encoding, kept in Data
+	encode() string
+	len() int
+	// approximate memory footprint of the elements in bytes
+	size() int64
+}
+
+type collOpKind string
+
+const (
+	collPush collOpKind = "push"
+	collPop  collOpKind = "pop"
+	collHSet collOpKind = "hset"
+	collHDel collOpKind = "hdel"
+	collSAdd collOpKind = "sadd"
+	collSRem collOpKind = "srem"
+	collZAdd collOpKind = "zadd"
+	collZRem collOpKind = "zrem"
+	// changes only the ttl, contents are left as they are
+	collExpire collOpKind = "expire"
+)
+
+// change of a single collection, written to the log instead of the whole value
+// carries the resulting metadata, so that replay reproduces the value exactly
+type collOp struct {
+	Kind collOpKind `json:"kind"`
+	Type ValueType  `json:"type"`
+	// the collection didn't exist and is created by the change
+	Created bool `json:"created,omitempty"`
+
+	// side of the list
+	Left bool `json:"left,omitempty"`
+	// pushed values, removed fields or members, added members of the set
+	Values []string `json:"values,omitempty"`
+	// set fields of the hash
+	Fields map[string]string `json:"fields,omitempty"`
+	// added or updated members of the sorted set
+	Members []ZMember `json:"members,omitempty"`
+	// amount of popped values
+	Count int `json:"count,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Version   uint64    `json:"version"`
+}
+
+// returns true if the change removes every element of the collection
+func (op *collOp) empties(coll nativeColl) bool {
+	switch op.Kind {
+	case collPop:
+		return op.Count >= coll.len()
+	case collHDel, collSRem, collZRem:
+		return len(op.Values) >= coll.len()
+	}
+
+	return false
+}
+
+// resulting value of the collection
+func (op *collOp) value(coll nativeColl) Value {
+	return Value{
+		Type:      op.Type,
+		UpdatedAt: op.UpdatedAt,
+		ExpiresAt: op.ExpiresAt,
+		Version:   op.Version,
+		coll:      coll,
+	}
+}
+
+// returns empty contents of the type, nil for non-collection types
+func newNative(typ ValueType) nativeColl {
+	switch typ {
+	case TypeList:
+		return &nativeList{}
+	case TypeHash:
+		return &nativeHash{fields: make(map[string]string)}
+	case TypeSet:
+		return &nativeSet{members: make(map[string]struct{})}
+	case TypeZSet:
+		return newNativeZSet()
+	}
+
+	return nil
+}
+
+// returns contents of the collection value, decoding them if needed
+// type of the value should be checked by the caller
+func nativeOf(val Value) (nativeColl, error) {
+	if val.coll != nil {
+		return val.coll, nil
+	}
+
+	coll := newNative(val.Type)
+	if coll == nil {
+		return nil, ErrWrongType
+	}
+
+	var err error
+	switch coll := coll.(type) {
+	case *nativeList:
+		var values []string
+		if err = json.Unmarshal([]byte(val.Data), &values); err == nil {
+			coll.push(values, false)
+		}
+	case *nativeHash:
+		var fields map[string]string
+		if err = json.Unmarshal([]byte(val.Data), &fields); err == nil {
+			coll.set(fields)
+		}
+	case *nativeSet:
+		var members []string
+		if err = json.Unmarshal([]byte(val.Data), &members); err == nil {
+			coll.add(members)
+		}
+	case *nativeZSet:
+		var members []ZMember
+		if err = json.Unmarshal([]byte(val.Data), &members); err == nil {
+			coll.add(members)
+		}
+	}
+
+	if err != nil {
+		return nil, ErrJSONUnmarshall
+	}
+
+	return coll, nil
+}
+
+// returns a copy of the value, with contents of a native collection encoded into Data
+// the collection is shared by every copy of the value, so the shard lock should be held by the caller
+func (v Value) materialized() Value {
+	if v.coll != nil {
+		v.Data = v.coll.encode()
+		v.coll = nil
+	}
+
+	return v
+}
+
+// encodes every native collection of the store
+func (s store) materialize() {
+	for k, v := range s {
+		if v.coll != nil {
+			s[k] = v.materialized()
+		}
+	}
+}
+
+// applies a replayed change of a collection
+func (s store) applyColl(key Key, op *collOp) {
+	var coll nativeColl
+	if cur, ok := s[key]; ok && !op.Created && cur.Type == op.Type {
+		coll, _ = nativeOf(cur)
+	}
+	if coll == nil {
+		coll = newNative(op.Type)
+	}
+	if coll == nil {
+		return
+	}
+
+	coll.apply(op)
+
+	if coll.len() == 0 {
+		delete(s, key)
+		return
+	}
+
+	s[key] = op.value(coll)
+}
+
+// list as a double-ended queue:
+// values of the head are kept in reverse order, so that both ends grow by appending
+type nativeList struct {
+	front []string
+	back  []string
+	bytes int64
+}
+
+func (l *nativeList) len() int {
+	return len(l.front) + len(l.back)
+}
+
+func (l *nativeList) size() int64 {
+	return l.bytes
+}
+
+func (l *nativeList) at(i int) string {
+	if i < len(l.front) {
+		return l.front[len(l.front)-1-i]
+	}
+
+	return l.back[i-len(l.front)]
+}
+
+// returns values between lo and hi, hi excluded
+func (l *nativeList) slice(lo, hi int) []string {
+	values := make([]string, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		values = append(values, l.at(i))
+	}
+
+	return values
+}
+
+// values are pushed one by one, so left push reverses their order
+func (l *nativeList) push(values []string, left bool) {
+	for _, value := range values {
+		if left {
+			l.front = append(l.front, value)
+		} else {
+			l.back = append(l.back, value)
+		}
+		l.bytes += int64(len(value)) + elementOverhead
+	}
+}
+
+// returns up to count values from the head or the tail in the order they would be popped
+func (l *nativeList) peek(count int, left bool) []string {
+	count = min(count, l.len())
+
+	values := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if left {
+			values = append(values, l.at(i))
+		} else {
+			values = append(values, l.at(l.len()-1-i))
+		}
+	}
+
+	return values
+}
+
+func (l *nativeList) pop(count int, left bool) {
+	for _, value := range l.peek(count, left) {
+		l.bytes -= int64(len(value)) + elementOverhead
+	}
+
+	count = min(count, l.len())
+
+	// the inner end of the other half is reached, once this end runs out
+	near, far := &l.back, &l.front
+	if left {
+		near, far = &l.front, &l.back
+	}
+
+	n := min(count, len(*near))
+	*near = (*near)[:len(*near)-n]
+	*far = (*far)[count-n:]
+
+	if len(l.front) == 0 {
+		l.front = nil
+	}
+	if len(l.back) == 0 {
+		l.back = nil
+	}
+}
+
+func (l *nativeList) apply(op *collOp) {
+	switch op.Kind {
+	case collPush:
+		l.push(op.Values, op.Left)
+	case collPop:
+		l.pop(op.Count, op.Left)
+	}
+}
+
+func (l *nativeList) growth(op *collOp) int64 {
+	var grow int64
+	if op.Kind == collPush {
+		for _, value := range op.Values {
+			grow += int64(len(value)) + elementOverhead
+		}
+	}
+
+	return grow
+}
+
+func (l *nativeList) encode() string {
+	raw, _ := json.Marshal(l.slice(0, l.len()))
+	return string(raw)
+}
+
+type nativeHash struct {
+	fields map[string]string
+	bytes  int64
+}
+
+func (h *nativeHash) len() int {
+	return len(h.fields)
+}
+
+func (h *nativeHash) size() int64 {
+	return h.bytes
+}
+
+func (h *nativeHash) set(fields map[string]string) {
+	h.bytes += h.growth(&collOp{Kind: collHSet, Fields: fields})
+
+	for field, value := range fields {
+		h.fields[field] = value
+	}
+}
+
+func (h *nativeHash) del(fields []string) {
+	for _, field := range fields {
+		if value, ok := h.fields[field]; ok {
+			h.bytes -= int64(len(field)+len(value)) + elementOverhead
+			delete(h.fields, field)
+		}
+	}
+}
+
+func (h *nativeHash) apply(op *collOp) {
+	switch op.Kind {
+	case collHSet:
+		h.set(op.Fields)
+	case collHDel:
+		h.del(op.Values)
+	}
+}
+
+func (h *nativeHash) growth(op *collOp) int64 {
+	var grow int64
+	if op.Kind == collHSet {
+		for field, value := range op.Fields {
+			if cur, ok := h.fields[field]; ok {
+				grow += int64(len(value) - len(cur))
+			} else {
+				grow += int64(len(field)+len(value)) + elementOverhead
+			}
+		}
+	}
+
+	return grow
+}
+
+func (h *nativeHash) encode() string {
+	raw, _ := json.Marshal(h.fields)
+	return string(raw)
+}
+
+type nativeSet struct {
+	members map[string]struct{}
+	bytes   int64
+}
+
+func (s *nativeSet) len() int {
+	return len(s.members)
+}
+
+func (s *nativeSet) size() int64 {
+	return s.bytes
+}
+
+func (s *nativeSet) has(member string) bool {
+	_, ok := s.members[member]
+	return ok
+}
+
+func (s *nativeSet) add(members []string) {
+	for _, member := range members {
+		if !s.has(member) {
+			s.members[member] = struct{}{}
+			s.bytes += int64(len(member)) + elementOverhead
+		}
+	}
+}
+
+func (s *nativeSet) rem(members []string) {
+	for _, member := range members {
+		if s.has(member) {
+			delete(s.members, member)
+			s.bytes -= int64(len(member)) + elementOverhead
+		}
+	}
+}
+
+// returns members in ascending order
+func (s *nativeSet) sorted() []string {
+	members := make([]string, 0, len(s.members))
+	for member := range s.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	return members
+}
+
+func (s *nativeSet) apply(op *collOp) {
+	switch op.Kind {
+	case collSAdd:
+		s.add(op.Values)
+	case collSRem:
+		s.rem(op.Values)
+	}
+}
+
+func (s *nativeSet) growth(op *collOp) int64 {
+	var grow int64
+	if op.Kind == collSAdd {
+		for _, member := range op.Values {
+			if !s.has(member) {
+				grow += int64(len(member)) + elementOverhead
+			}
+		}
+	}
+
+	return grow
+}
+
+func (s *nativeSet) encode() string {
+	raw, _ := json.Marshal(s.sorted())
+	return string(raw)
+}
+
+// members, ordered by score, members with equal scores are ordered lexicographically
+// scores are looked up by member, while the ordered index serves ranks and ranges
+type nativeZSet struct {
+	scores map[string]float64
+	index  *skiplist[ZMember]
+	bytes  int64
+}
+
+func newNativeZSet() *nativeZSet {
+	return &nativeZSet{
+		scores: make(map[string]float64),
+		index:  newSkiplist(ZMember.less),
+	}
+}
+
+func (zs *nativeZSet) len() int {
+	return len(zs.scores)
+}
+
+func (zs *nativeZSet) size() int64 {
+	return zs.bytes
+}
+
+func (zs *nativeZSet) score(member string) (float64, bool) {
+	score, ok := zs.scores[member]
+	return score, ok
+}
+
+// inserts the members or updates their scores
+func (zs *nativeZSet) add(members []ZMember) {
+	for _, m := range members {
+		cur, ok := zs.scores[m.Member]
+		if ok {
+			if cur == m.Score {
+				continue
+			}
+			zs.index.delete(ZMember{Member: m.Member, Score: cur})
+		} else {
+			zs.bytes += int64(len(m.Member)) + elementOverhead
+		}
+
+		zs.scores[m.Member] = m.Score
+		zs.index.insert(m)
+	}
+}
+
+func (zs *nativeZSet) rem(members []string) {
+	for _, member := range members {
+		if score, ok := zs.scores[member]; ok {
+			zs.index.delete(ZMember{Member: member, Score: score})
+			delete(zs.scores, member)
+			zs.bytes -= int64(len(member)) + elementOverhead
+		}
+	}
+}
+
+// returns position of the member in ascending order
+func (zs *nativeZSet) rank(member string) (int, bool) {
+	score, ok := zs.scores[member]
+	if !ok {
+		return 0, false
+	}
+
+	_, rank := zs.index.seekRank(ZMember{Member: member, Score: score})
+
+	return rank, true
+}
+
+// returns members with ranks between lo and hi, hi excluded,
+// in descending order if reverse is set
+func (zs *nativeZSet) slice(lo, hi int, reverse bool) []ZMember {
+	members := make([]ZMember, 0, max(hi-lo, 0))
+	for node := zs.index.byRank(lo); node != nil && len(members) < hi-lo; node = node.next[0] {
+		members = append(members, node.key)
+	}
+
+	if reverse {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+
+	return members
+}
+
+// returns ranks of the first member with score >= min and of the first one with score > max
+func (zs *nativeZSet) scoreBounds(min, max float64) (lo, hi int) {
+	_, lo = zs.index.seekRank(ZMember{Score: min})
+	_, hi = zs.index.seekRank(ZMember{Score: math.Nextafter(max, math.Inf(1))})
+
+	return lo, hi
+}
+
+func (zs *nativeZSet) apply(op *collOp) {
+	switch op.Kind {
+	case collZAdd:
+		zs.add(op.Members)
+	case collZRem:
+		zs.rem(op.Values)
+	}
+}
+
+func (zs *nativeZSet) growth(op *collOp) int64 {
+	var grow int64
+	if op.Kind == collZAdd {
+		for _, m := range op.Members {
+			if _, ok := zs.scores[m.Member]; !ok {
+				grow += int64(len(m.Member)) + elementOverhead
+			}
+		}
+	}
+
+	return grow
+}
+
+func (zs *nativeZSet) encode() string {
+	raw, _ := json.Marshal(zs.slice(0, zs.len(), false))
+	return string(raw)
+}
+
+// changes the collection, held by the key, in place and logs only the change
+// fn receives current contents (empty ones, if the key doesn't exist) and returns the change,
+// nil change leaves the collection as it is
+// created collection expires at expiresAt, while existing ones keep their ttl
+func (st *ImprovedStorage) modifyNative(key Key, typ ValueType, expiresAt time.Time, fn func(coll nativeColl, exists bool) (*collOp, error)) error {
+	sh := st.cc.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+
+	cur, ok := sh.live(key)
+	if ok && cur.Type != typ {
+		return ErrWrongType
+	}
+
+	coll := newNative(typ)
+	if ok {
+		var err error
+		if coll, err = nativeOf(cur); err != nil {
+			return err
+		}
+	}
+
+	op, err := fn(coll, ok)
+	if err != nil || op == nil {
+		return err
+	}
+
+	// removing every element removes the collection
+	if ok && op.empties(coll) {
+		return st.del(sh, key)
+	}
+
+	op.Type = typ
+	op.Created = !ok
+	op.UpdatedAt = time.Now()
+	op.ExpiresAt = expiresAt
+	if ok {
+		op.ExpiresAt = cur.ExpiresAt
+	}
+	op.Version = st.versions.next()
+
+	grow := coll.growth(op)
+	if !ok {
+		grow += int64(len(key)) + entryOverhead
+	}
+	if grow > 0 {
+		if err := st.cc.reserveDelta([]*shard{sh}, grow, []Key{key}, st.evict); err != nil {
+			return err
+		}
+	}
+
+	if err := st.append(walRecord{Op: walColl, Key: key, Coll: op}); err != nil {
+		return err
+	}
+
+	coll.apply(op)
+	val := op.value(coll)
+	sh.set(key, val)
+
+	// contents are not encoded for the event, as that would defeat the purpose
+	val.coll = nil
+	st.feed.put(key, val)
+
+	return nil
+}
+
+// changes ttl of the collection in place and logs only the change, so that contents are not encoded
+// shard lock should be held by the caller
+func (st *ImprovedStorage) expireNative(sh *shard, key Key, cur Value, expiresAt time.Time) error {
+	op := &collOp{
+		Kind:      collExpire,
+		Type:      cur.Type,
+		UpdatedAt: cur.UpdatedAt,
+		ExpiresAt: expiresAt,
+		Version:   st.versions.next(),
+	}
+
+	if err := st.append(walRecord{Op: walColl, Key: key, Coll: op}); err != nil {
+		return err
+	}
+
+	val := op.value(cur.coll)
+	sh.set(key, val)
+
+	val.coll = nil
+	st.feed.put(key, val)
+
+	return nil
+}
+
+// passes contents of the collection, held by the key, to fn under the read lock
+// missing keys read as empty collections
+func (st *ImprovedStorage) readNative(key Key, typ ValueType, fn func(coll nativeColl)) error {
+	sh := st.cc.shard(key)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	val, ok := sh.data[key]
+	if !ok || val.expired(time.Now()) {
+		fn(newNative(typ))
+		return nil
+	}
+
+	if val.Type != typ {
+		return ErrWrongType
+	}
+
+	coll, err := nativeOf(val)
+	if err != nil {
+		return err
+	}
+
+	sh.meta[key].touch()
+	fn(coll)
+
+	return nil
+}
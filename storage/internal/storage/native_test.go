@@ -0,0 +1,138 @@
+package storage_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+func collections(t *testing.T, st storage.Storage) *storage.Collections {
+	t.Helper()
+
+	coll, ok := storage.CollectionsOf(st)
+	if !ok {
+		t.Fatal("storage doesn't support collections")
+	}
+
+	return coll
+}
+
+// element changes of native collections are logged on their own,
+// so the state should be the same after the log is replayed and after it's compacted
+func TestNativeCollections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+	coll := collections(t, st)
+
+	steps := []func() error{
+		func() error { _, err := coll.Push("list", []string{"b", "c"}, false, time.Time{}); return err },
+		func() error { _, err := coll.Push("list", []string{"a"}, true, time.Time{}); return err },
+		func() error { _, err := coll.Pop("list", 1, false); return err },
+		func() error {
+			_, err := coll.HSet("hash", map[string]string{"f": "1", "g": "2"}, time.Time{})
+			return err
+		},
+		func() error { _, err := coll.HDel("hash", []string{"g"}); return err },
+		func() error { _, err := coll.SAdd("set", []string{"x", "y", "z"}, time.Time{}); return err },
+		func() error { _, err := coll.SRem("set", []string{"y"}); return err },
+		func() error {
+			_, err := coll.ZAdd("zset", []storage.ZMember{{Member: "m", Score: 2}, {Member: "n", Score: 1}, {Member: "m", Score: 3}}, time.Time{})
+			return err
+		},
+		func() error { _, err := coll.ZRem("zset", []string{"n"}); return err },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %v: %v", i, err)
+		}
+	}
+
+	check := func(st storage.Storage) {
+		t.Helper()
+		coll := collections(t, st)
+
+		if list, err := coll.Range("list", 0, -1); err != nil || !reflect.DeepEqual(list, []string{"a", "b"}) {
+			t.Fatalf("Range: %v (%v)", list, err)
+		}
+		if hash, err := coll.HGetAll("hash"); err != nil || !reflect.DeepEqual(hash, map[string]string{"f": "1"}) {
+			t.Fatalf("HGetAll: %v (%v)", hash, err)
+		}
+		members, err := coll.SMembers("set")
+		sort.Strings(members)
+		if err != nil || !reflect.DeepEqual(members, []string{"x", "z"}) {
+			t.Fatalf("SMembers: %v (%v)", members, err)
+		}
+		if zset, err := coll.ZRange("zset", 0, -1, false); err != nil || !reflect.DeepEqual(zset, []storage.ZMember{{Member: "m", Score: 3}}) {
+			t.Fatalf("ZRange: %v (%v)", zset, err)
+		}
+	}
+
+	check(st)
+
+	st = reopen(t, st, path)
+	check(st)
+
+	compact(t, st)
+	st = reopen(t, st, path)
+	check(st)
+}
+
+// ttl changes of native collections are logged on their own as well, without the contents
+func TestNativeCollectionsTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+	coll := collections(t, st)
+
+	if _, err := coll.Push("list", []string{"a", "b"}, false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coll.SAdd("set", []string{"x"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if ok, err := st.SetTTL("list", expiresAt); !ok || err != nil {
+		t.Fatalf("SetTTL: %v (%v)", ok, err)
+	}
+	if ok, err := st.SetTTL("set", time.Time{}); !ok || err != nil {
+		t.Fatalf("SetTTL: %v (%v)", ok, err)
+	}
+
+	for _, seg := range segments(t, path) {
+		raw, err := os.ReadFile(seg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(raw), `"op":"put"`) {
+			t.Fatalf("collection is logged as a whole: %s", raw)
+		}
+	}
+
+	check := func(st storage.Storage) {
+		t.Helper()
+
+		list, err := st.Read("list")
+		if err != nil || !list.Value.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("list expires at %v, want %v (%v)", list.Value.ExpiresAt, expiresAt, err)
+		}
+		set, err := st.Read("set")
+		if err != nil || !set.Value.ExpiresAt.IsZero() {
+			t.Fatalf("set expires at %v, want no ttl (%v)", set.Value.ExpiresAt, err)
+		}
+
+		if values, err := collections(t, st).Range("list", 0, -1); err != nil || !reflect.DeepEqual(values, []string{"a", "b"}) {
+			t.Fatalf("Range: %v (%v)", values, err)
+		}
+	}
+
+	check(st)
+
+	st = reopen(t, st, path)
+	check(st)
+}
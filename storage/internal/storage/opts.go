@@ -0,0 +1,105 @@
+package storage
+
+import "time"
+
+const (
+	defaultSyncPolicy       = SyncInterval
+	defaultSyncInterval     = time.Second
+	defaultSnapshotInterval = time.Minute
+	defaultSnapshotKeep     = 3
+
+	defaultCompactionThreshold = 64 << 20
+
+	defaultExpiryInterval = 100 * time.Millisecond
+	defaultExpiryBatch    = 1000
+
+	defaultEvictionPolicy = NoEviction
+
+	defaultShards = 32
+)
+
+// Option configuration pattern
+type Option func(*ImprovedStorage)
+
+// sets how often the write-ahead log is fsynced
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(st *ImprovedStorage) {
+		st.syncPolicy = policy
+	}
+}
+
+// sets the fsync interval for the SyncInterval policy
+func WithSyncInterval(interval time.Duration) Option {
+	return func(st *ImprovedStorage) {
+		st.syncInterval = interval
+	}
+}
+
+// sets how often the log is compacted into a new snapshot
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(st *ImprovedStorage) {
+		st.snapshotInterval = interval
+	}
+}
+
+// sets the amount of snapshot generations kept on disk
+func WithSnapshotKeep(keep int) Option {
+	return func(st *ImprovedStorage) {
+		st.snapshotKeep = keep
+	}
+}
+
+// sets the log size in bytes, after which compaction is started ahead of schedule
+// zero disables size-based compaction
+func WithCompactionThreshold(threshold int64) Option {
+	return func(st *ImprovedStorage) {
+		st.compactionThreshold = threshold
+	}
+}
+
+// sets how often expired entries are actively removed
+func WithExpiryInterval(interval time.Duration) Option {
+	return func(st *ImprovedStorage) {
+		st.expiryInterval = interval
+	}
+}
+
+// sets the amount of expired entries removed at once,
+// before the lock is released
+func WithExpiryBatch(batch int) Option {
+	return func(st *ImprovedStorage) {
+		if batch > 0 {
+			st.expiryBatch = batch
+		}
+	}
+}
+
+// sets the approximate memory limit in bytes
+// zero (default) means no limit
+func WithMaxMemory(bytes int64) Option {
+	return func(st *ImprovedStorage) {
+		st.maxMemory = bytes
+	}
+}
+
+// sets which entries get evicted, once the memory limit is reached
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(st *ImprovedStorage) {
+		st.evictionPolicy = policy
+	}
+}
+
+// sets the feed, which receives changes of the storage
+func WithFeed(feed *Feed) Option {
+	return func(st *ImprovedStorage) {
+		st.feed = feed
+	}
+}
+
+// sets the amount of cache shards, each guarded by its own lock
+// memory limit is shared by them
+func WithShards(shards int) Option {
+	return func(st *ImprovedStorage) {
+		st.shards = shards
+	}
+}
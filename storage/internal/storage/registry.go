@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// features, supported by a storage engine
+type Capabilities struct {
+	// entries expire according to their ExpiresAt
+	TTL bool `json:"ttl"`
+	// implements Scanner
+	Scan bool `json:"scan"`
+	// survives restarts
+	Durable bool `json:"durable"`
+	// implements Compactor
+	Compaction bool `json:"compaction"`
+	// is able to evict entries under a memory limit
+	Eviction bool `json:"eviction"`
+}
+
+// everything an engine may need to be constructed
+type EngineConfig struct {
+	// path (or path prefix) of the engine's data files
+	Path    string
+	InfoLog *logrus.Logger
+	ErrLog  *logrus.Logger
+	// applied by engines, built on top of ImprovedStorage
+	Options []Option
+	// how often the log of a durable engine is fsynced, zero value is SyncAlways
+	// interval is used only by the SyncInterval policy, zero keeps the default one
+	SyncPolicy   SyncPolicy
+	SyncInterval time.Duration
+	// receives changes of the storage, may be nil
+	Feed *Feed
+}
+
+// zero interval falls back to the default one
+func (conf EngineConfig) syncInterval() time.Duration {
+	if conf.SyncInterval > 0 {
+		return conf.SyncInterval
+	}
+
+	return defaultSyncInterval
+}
+
+// named storage engine constructor
+type Engine struct {
+	Name         string
+	Description  string
+	Capabilities Capabilities
+	New          func(conf EngineConfig) (Storage, error)
+}
+
+var (
+	enginesMu sync.RWMutex
+	engines   = make(map[string]Engine)
+)
+
+// makes the engine available by its name
+// panics if the name is already taken
+func Register(engine Engine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	if _, ok := engines[engine.Name]; ok {
+		panic(fmt.Sprintf("storage: engine %v is registered twice", engine.Name))
+	}
+
+	engines[engine.Name] = engine
+}
+
+// constructs the engine, registered under the provided name
+func Open(name string, conf EngineConfig) (Storage, error) {
+	enginesMu.RLock()
+	engine, ok := engines[name]
+	enginesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownEngine, name)
+	}
+
+	return engine.New(conf)
+}
+
+// lists registered engines, sorted by name
+func Engines() []Engine {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+
+	list := make([]Engine, 0, len(engines))
+	for _, engine := range engines {
+		list = append(list, engine)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+func init() {
+	Register(Engine{
+		Name:        "memory",
+		Description: "sharded in-mem cache without persistence",
+		Capabilities: Capabilities{
+			TTL:      true,
+			Scan:     true,
+			Eviction: true,
+		},
+		New: func(conf EngineConfig) (Storage, error) {
+			return NewImprovedStorage("", conf.ErrLog, append([]Option{WithFeed(conf.Feed)}, conf.Options...)...)
+		},
+	})
+
+	Register(Engine{
+		Name:        "json",
+		Description: "single JSON file, re-read on every operation (v1)",
+		Capabilities: Capabilities{
+			TTL:     true,
+			Durable: true,
+		},
+		New: func(conf EngineConfig) (Storage, error) {
+			return NewLocalStorage(conf.Path, conf.InfoLog, conf.ErrLog, WithLocalFeed(conf.Feed)), nil
+		},
+	})
+
+	Register(Engine{
+		Name:        "snapshot",
+		Description: "sharded in-mem cache, persisted with a write-ahead log and snapshots (v2)",
+		Capabilities: Capabilities{
+			TTL:        true,
+			Scan:       true,
+			Durable:    true,
+			Compaction: true,
+			Eviction:   true,
+		},
+		New: func(conf EngineConfig) (Storage, error) {
+			opts := []Option{WithFeed(conf.Feed), WithSyncPolicy(conf.SyncPolicy), WithSyncInterval(conf.syncInterval())}
+
+			return NewImprovedStorage(conf.Path, conf.ErrLog, append(opts, conf.Options...)...)
+		},
+	})
+
+	Register(Engine{
+		Name:        "bitcask",
+		Description: "log-structured segments on disk with an in-mem key directory, for datasets larger than RAM",
+		Capabilities: Capabilities{
+			TTL:        true,
+			Durable:    true,
+			Compaction: true,
+		},
+		New: func(conf EngineConfig) (Storage, error) {
+			opts := []BitcaskOption{WithBitcaskFeed(conf.Feed), WithBitcaskSync(conf.SyncPolicy, conf.syncInterval())}
+
+			return NewBitcaskStorage(conf.Path, conf.ErrLog, opts...)
+		},
+	})
+
+	Register(Engine{
+		Name:        "lsm",
+		Description: "log-structured merge tree with sorted tables on disk, for write-heavy workloads",
+		Capabilities: Capabilities{
+			TTL:        true,
+			Scan:       true,
+			Durable:    true,
+			Compaction: true,
+		},
+		New: func(conf EngineConfig) (Storage, error) {
+			opts := []LSMOption{WithLSMFeed(conf.Feed), WithLSMSync(conf.SyncPolicy, conf.syncInterval())}
+
+			return NewLSMStorage(conf.Path, conf.ErrLog, opts...)
+		},
+	})
+}
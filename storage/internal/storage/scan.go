@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// storage, which keeps its keys ordered
+type Scanner interface {
+	// returns up to limit entries with start <= key < end, ordered by key
+	// empty end means no upper bound, non-positive limit means no limit
+	Scan(start, end Key, limit int) ([]Entry, error)
+	// returns every entry, which key starts with the prefix
+	ScanPrefix(prefix Key) ([]Entry, error)
+}
+
+// shards are scanned one by one, so the result is not
+// a point-in-time view of the whole keyspace
+func (st *ImprovedStorage) Scan(start, end Key, limit int) ([]Entry, error) {
+	return st.cc.scan(start, end, limit, time.Now()), nil
+}
+
+func (st *ImprovedStorage) ScanPrefix(prefix Key) ([]Entry, error) {
+	return st.Scan(prefix, PrefixEnd(prefix), 0)
+}
+
+// returns the smallest key, which is greater than any key with the prefix
+// empty key (no upper bound) is returned if there's no such key
+func PrefixEnd(prefix Key) Key {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return Key(end[:i+1])
+		}
+	}
+
+	return ""
+}
+
+// merges ordered ranges of every shard
+func (cc *cache) scan(start, end Key, limit int, now time.Time) []Entry {
+	entries := []Entry{}
+	for _, sh := range cc.shards {
+		entries = append(entries, sh.scan(start, end, limit, now)...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries
+}
+
+// collects up to limit live entries of the range
+func (sh *shard) scan(start, end Key, limit int, now time.Time) []Entry {
+	sh.RLock()
+	defer sh.RUnlock()
+
+	entries := []Entry{}
+	for node := sh.keys.seek(start); node != nil; node = node.next[0] {
+		if end != "" && node.key >= end {
+			break
+		}
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+
+		val := sh.data[node.key]
+		// expired entries are left for the expiry loop
+		if val.expired(now) {
+			continue
+		}
+
+		entries = append(entries, Entry{Key: node.key, Value: val.materialized()})
+	}
+
+	return entries
+}
@@ -0,0 +1,177 @@
+package storage
+
+import "math/rand/v2"
+
+const (
+	skiplistMaxLevel = 32
+	// probability of a node being promoted to the next level is 1/skiplistBranching
+	skiplistBranching = 4
+)
+
+// ordered set of items
+// every link keeps the amount of nodes it skips, so that items are found by their rank as well
+type skiplist[T any] struct {
+	head  *skipnode[T]
+	level int
+	len   int
+	less  func(a, b T) bool
+}
+
+type skipnode[T any] struct {
+	key  T
+	next []*skipnode[T]
+	// distance to the next node of each level
+	span []int
+}
+
+func newSkiplist[T any](less func(a, b T) bool) *skiplist[T] {
+	return &skiplist[T]{
+		head: &skipnode[T]{
+			next: make([]*skipnode[T], skiplistMaxLevel),
+			span: make([]int, skiplistMaxLevel),
+		},
+		level: 1,
+		less:  less,
+	}
+}
+
+// orders keys of the storage
+func keyLess(a, b Key) bool {
+	return a < b
+}
+
+// inserts the key, if it is not present yet
+func (sl *skiplist[T]) insert(key T) {
+	var (
+		update [skiplistMaxLevel]*skipnode[T]
+		// rank of update[i]
+		rank [skiplistMaxLevel]int
+	)
+
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for node.next[i] != nil && sl.less(node.next[i].key, key) {
+			rank[i] += node.span[i]
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	if next := node.next[0]; next != nil && !sl.less(key, next.key) {
+		return
+	}
+
+	level := sl.randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			update[i] = sl.head
+			update[i].span[i] = sl.len
+		}
+		sl.level = level
+	}
+
+	inserted := &skipnode[T]{key: key, next: make([]*skipnode[T], level), span: make([]int, level)}
+	for i := 0; i < level; i++ {
+		inserted.next[i] = update[i].next[i]
+		update[i].next[i] = inserted
+
+		inserted.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+
+	// links above the new node skip it as well
+	for i := level; i < sl.level; i++ {
+		update[i].span[i]++
+	}
+
+	sl.len++
+}
+
+func (sl *skiplist[T]) delete(key T) {
+	var update [skiplistMaxLevel]*skipnode[T]
+
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && sl.less(node.next[i].key, key) {
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	target := node.next[0]
+	if target == nil || sl.less(key, target.key) {
+		return
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].next[i] == target {
+			update[i].span[i] += target.span[i] - 1
+			update[i].next[i] = target.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+
+	for sl.level > 1 && sl.head.next[sl.level-1] == nil {
+		sl.level--
+	}
+
+	sl.len--
+}
+
+// returns the first node with key >= start
+func (sl *skiplist[T]) seek(start T) *skipnode[T] {
+	node, _ := sl.seekRank(start)
+	return node
+}
+
+// returns the first node with key >= start along with its rank, starting from zero
+// the rank equals the length of the list, if there's no such node
+func (sl *skiplist[T]) seekRank(start T) (*skipnode[T], int) {
+	var rank int
+
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && sl.less(node.next[i].key, start) {
+			rank += node.span[i]
+			node = node.next[i]
+		}
+	}
+
+	return node.next[0], rank
+}
+
+// returns the node of the provided rank, starting from zero
+func (sl *skiplist[T]) byRank(rank int) *skipnode[T] {
+	if rank < 0 || rank >= sl.len {
+		return nil
+	}
+
+	// ranks of the nodes start from one here, as the head takes zero
+	var traversed int
+
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && traversed+node.span[i] <= rank+1 {
+			traversed += node.span[i]
+			node = node.next[i]
+		}
+		if traversed == rank+1 {
+			return node
+		}
+	}
+
+	return nil
+}
+
+func (sl *skiplist[T]) randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.IntN(skiplistBranching) == 0 {
+		level++
+	}
+
+	return level
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// on-disk point-in-time copy of the cache
+type snapshot struct {
+	Generation uint64 `json:"generation"`
+	// last log segment, which is already included
+	WALSegment uint64 `json:"wal_segment"`
+	// crc32 of the raw data
+	Checksum uint32          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// writes and loads snapshot generations
+// each generation is stored as <base>.snap.<generation>
+type snapshotter struct {
+	base string
+	// amount of generations kept on disk
+	keep int
+
+	errLog *logrus.Logger
+}
+
+func newSnapshotter(base string, keep int, errLog *logrus.Logger) *snapshotter {
+	if keep < 1 {
+		keep = 1
+	}
+
+	return &snapshotter{
+		base:   base,
+		keep:   keep,
+		errLog: errLog,
+	}
+}
+
+// crash-safely writes a new snapshot generation:
+// temp file -> fsync -> rename -> fsync of the directory
+func (s *snapshotter) write(snap snapshot) error {
+	snap.Checksum = crc32.ChecksumIEEE(snap.Data)
+
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return ErrJSONMarshall
+	}
+
+	path := s.path(snap.Generation)
+	tmpPath := path + ".tmp"
+
+	fd, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+
+	if _, err := fd.Write(raw); err != nil {
+		fd.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("fd.Write: %v", err)
+	}
+
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	if err := fd.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("fd.Close: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	s.prune()
+
+	return nil
+}
+
+// returns the newest snapshot, which passes validation
+func (s *snapshotter) latest() (snapshot, error) {
+	gens, err := s.generations()
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	// newest generations go first
+	for i := len(gens) - 1; i >= 0; i-- {
+		snap, err := s.load(gens[i])
+		if err != nil {
+			s.logErr(fmt.Errorf("skipping snapshot %v: %v", s.path(gens[i]), err))
+			continue
+		}
+		return snap, nil
+	}
+
+	return snapshot{}, ErrNothingToRestore
+}
+
+// returns the log segment, covered by the oldest valid snapshot on disk
+// log segments up to it are not needed by any of the kept generations
+func (s *snapshotter) oldestSegment() (uint64, error) {
+	gens, err := s.generations()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, gen := range gens {
+		if snap, err := s.load(gen); err == nil {
+			return snap.WALSegment, nil
+		}
+	}
+
+	return 0, ErrNothingToRestore
+}
+
+func (s *snapshotter) load(gen uint64) (snapshot, error) {
+	raw, err := os.ReadFile(s.path(gen))
+	if err != nil {
+		return snapshot{}, ErrFileRead
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return snapshot{}, ErrJSONUnmarshall
+	}
+
+	if snap.Generation != gen || crc32.ChecksumIEEE(snap.Data) != snap.Checksum {
+		return snapshot{}, ErrSnapshotCorrupted
+	}
+
+	return snap, nil
+}
+
+// removes generations, which are older than the last s.keep ones
+// as well as temp files, left by interrupted writes
+func (s *snapshotter) prune() {
+	gens, err := s.generations()
+	if err != nil {
+		s.logErr(err)
+		return
+	}
+
+	for i := 0; i < len(gens)-s.keep; i++ {
+		if err := os.Remove(s.path(gens[i])); err != nil {
+			s.logErr(fmt.Errorf("os.Remove: %v", err))
+		}
+	}
+
+	tmps, _ := filepath.Glob(s.base + ".snap.*.tmp")
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+}
+
+// lists generations, present on disk, in ascending order
+func (s *snapshotter) generations() ([]uint64, error) {
+	paths, err := filepath.Glob(s.base + ".snap.*")
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob: %v", err)
+	}
+
+	gens := []uint64{}
+	for _, path := range paths {
+		gen, err := strconv.ParseUint(strings.TrimPrefix(path, s.base+".snap."), 10, 64)
+		if err != nil {
+			// temp files and other garbage
+			continue
+		}
+		gens = append(gens, gen)
+	}
+
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+
+	return gens, nil
+}
+
+func (s *snapshotter) path(gen uint64) string {
+	return fmt.Sprintf("%v.snap.%020d", s.base, gen)
+}
+
+func (s *snapshotter) logErr(err error) {
+	s.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+}
+
+// persists directory entries (e.g. after a rename)
+func syncDir(dir string) error {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open: %v", err)
+	}
+	defer fd.Close()
+
+	if err := fd.Sync(); err != nil {
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	return nil
+}
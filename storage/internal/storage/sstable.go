@@ -0,0 +1,406 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	// every n-th record gets into the sparse index
+	sstableIndexInterval = 16
+	// meta offset(8) + bloom offset(8) + record count(8) + magic(8)
+	sstableFooterSize  = 32
+	sstableFooterMagic = 0x6c736d7373746162
+)
+
+// immutable sorted table of records
+//
+// file layout: records | meta | bloom filter | footer
+// records are encoded the same way as bitcask ones,
+// meta holds the sparse index and the largest key
+type sstable struct {
+	id   uint64
+	fd   *os.File
+	size int64
+
+	count    uint64
+	smallest Key
+	largest  Key
+
+	// offset, where records end
+	dataEnd int64
+	index   []indexEntry
+	bloom   *bloomFilter
+}
+
+// key of a record and its offset in the table
+type indexEntry struct {
+	key    Key
+	offset int64
+}
+
+// reads meta and bloom filter of the table into memory
+func openTable(id uint64, path string) (*sstable, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %v", err)
+	}
+
+	t, err := readTable(id, fd)
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("table %v: %v", path, err)
+	}
+
+	return t, nil
+}
+
+func readTable(id uint64, fd *os.File) (*sstable, error) {
+	stat, err := fd.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("fd.Stat: %v", err)
+	}
+
+	size := stat.Size()
+	if size < sstableFooterSize {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	footer := make([]byte, sstableFooterSize)
+	if _, err := fd.ReadAt(footer, size-sstableFooterSize); err != nil {
+		return nil, fmt.Errorf("fd.ReadAt: %v", err)
+	}
+
+	var (
+		metaOffset  = int64(binary.LittleEndian.Uint64(footer))
+		bloomOffset = int64(binary.LittleEndian.Uint64(footer[8:]))
+		count       = binary.LittleEndian.Uint64(footer[16:])
+	)
+
+	if binary.LittleEndian.Uint64(footer[24:]) != sstableFooterMagic ||
+		metaOffset > bloomOffset || bloomOffset > size-sstableFooterSize {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	raw := make([]byte, size-sstableFooterSize-metaOffset)
+	if _, err := fd.ReadAt(raw, metaOffset); err != nil {
+		return nil, fmt.Errorf("fd.ReadAt: %v", err)
+	}
+
+	t := &sstable{
+		id:      id,
+		fd:      fd,
+		size:    size,
+		count:   count,
+		dataEnd: metaOffset,
+	}
+
+	if t.bloom, err = decodeBloomFilter(raw[bloomOffset-metaOffset:]); err != nil {
+		return nil, err
+	}
+
+	meta := raw[:bloomOffset-metaOffset]
+	readKey := func() (Key, error) {
+		if len(meta) < 4 {
+			return "", ErrSnapshotCorrupted
+		}
+		n := int(binary.LittleEndian.Uint32(meta))
+		if len(meta) < 4+n {
+			return "", ErrSnapshotCorrupted
+		}
+		key := Key(meta[4 : 4+n])
+		meta = meta[4+n:]
+		return key, nil
+	}
+
+	if t.largest, err = readKey(); err != nil {
+		return nil, err
+	}
+
+	for len(meta) > 0 {
+		key, err := readKey()
+		if err != nil || len(meta) < 8 {
+			return nil, ErrSnapshotCorrupted
+		}
+
+		t.index = append(t.index, indexEntry{key: key, offset: int64(binary.LittleEndian.Uint64(meta))})
+		meta = meta[8:]
+	}
+
+	if len(t.index) > 0 {
+		t.smallest = t.index[0].key
+	}
+
+	return t, nil
+}
+
+// looks the key up in the table
+// returns false if the table doesn't have a record for the key
+func (t *sstable) get(key Key) (lsmRecord, bool, error) {
+	if !t.contains(key) || !t.bloom.mayContain(key) {
+		return lsmRecord{}, false, nil
+	}
+
+	// block of records between two index entries
+	i := t.block(key)
+	end := t.dataEnd
+	if i+1 < len(t.index) {
+		end = t.index[i+1].offset
+	}
+
+	block := make([]byte, end-t.index[i].offset)
+	if _, err := t.fd.ReadAt(block, t.index[i].offset); err != nil {
+		return lsmRecord{}, false, fmt.Errorf("fd.ReadAt: %v", err)
+	}
+
+	for len(block) > 0 {
+		if len(block) < bitcaskHeaderSize {
+			return lsmRecord{}, false, ErrSnapshotCorrupted
+		}
+
+		size := recordSize(block)
+		if size > int64(len(block)) {
+			return lsmRecord{}, false, ErrSnapshotCorrupted
+		}
+
+		k, val, flags, err := decodeRecord(block[:size])
+		if err != nil {
+			return lsmRecord{}, false, err
+		}
+
+		if k == key {
+			return lsmRecord{val: val, tombstone: flags&bitcaskTombstone != 0}, true, nil
+		}
+		// records are sorted
+		if k > key {
+			break
+		}
+
+		block = block[size:]
+	}
+
+	return lsmRecord{}, false, nil
+}
+
+// checks whether the key is within the key range of the table
+func (t *sstable) contains(key Key) bool {
+	return len(t.index) > 0 && key >= t.smallest && key <= t.largest
+}
+
+// checks whether the table intersects with [lo, hi]
+func (t *sstable) overlaps(lo, hi Key) bool {
+	return !(t.largest < lo || t.smallest > hi)
+}
+
+// returns the last index entry with key <= the provided one
+func (t *sstable) block(key Key) int {
+	i := sort.Search(len(t.index), func(i int) bool { return t.index[i].key > key })
+	if i > 0 {
+		i--
+	}
+
+	return i
+}
+
+func (t *sstable) close() error {
+	return t.fd.Close()
+}
+
+// writes records of a new table
+// records should be added in ascending key order
+type tableWriter struct {
+	fd *os.File
+	wr *bufio.Writer
+
+	offset  int64
+	count   uint64
+	index   []indexEntry
+	hashes  []uint64
+	largest Key
+}
+
+func createTable(path string) (*tableWriter, error) {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %v", err)
+	}
+
+	return &tableWriter{fd: fd, wr: bufio.NewWriter(fd)}, nil
+}
+
+// appends a record to the table
+// returns the size of the encoded record
+func (tw *tableWriter) add(key Key, rec lsmRecord) (int64, error) {
+	var flags byte
+	if rec.tombstone {
+		flags = bitcaskTombstone
+	}
+
+	record := encodeRecord(key, rec.val, flags)
+	if _, err := tw.wr.Write(record); err != nil {
+		return 0, fmt.Errorf("wr.Write: %v", err)
+	}
+
+	if tw.count%sstableIndexInterval == 0 {
+		tw.index = append(tw.index, indexEntry{key: key, offset: tw.offset})
+	}
+
+	tw.offset += int64(len(record))
+	tw.count++
+	tw.hashes = append(tw.hashes, bloomHash(key))
+	tw.largest = key
+
+	return int64(len(record)), nil
+}
+
+// writes meta, bloom filter and footer, and fsyncs the table
+func (tw *tableWriter) finish() error {
+	defer tw.fd.Close()
+
+	meta := binary.LittleEndian.AppendUint32(nil, uint32(len(tw.largest)))
+	meta = append(meta, tw.largest...)
+	for _, e := range tw.index {
+		meta = binary.LittleEndian.AppendUint32(meta, uint32(len(e.key)))
+		meta = append(meta, e.key...)
+		meta = binary.LittleEndian.AppendUint64(meta, uint64(e.offset))
+	}
+
+	bloom := newBloomFilter(tw.hashes).encode()
+
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(tw.offset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(tw.offset)+uint64(len(meta)))
+	footer = binary.LittleEndian.AppendUint64(footer, tw.count)
+	footer = binary.LittleEndian.AppendUint64(footer, sstableFooterMagic)
+
+	for _, chunk := range [][]byte{meta, bloom, footer} {
+		if _, err := tw.wr.Write(chunk); err != nil {
+			return fmt.Errorf("wr.Write: %v", err)
+		}
+	}
+
+	if err := tw.wr.Flush(); err != nil {
+		return fmt.Errorf("wr.Flush: %v", err)
+	}
+
+	if err := tw.fd.Sync(); err != nil {
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	return nil
+}
+
+// ordered iterator over records
+type lsmIterator interface {
+	valid() bool
+	key() Key
+	record() lsmRecord
+	next()
+	err() error
+}
+
+// iterates over records of the table, starting with the first key >= start
+type tableIter struct {
+	rd *bufio.Reader
+	// bytes of the data section, which are not read yet
+	left int64
+	cur  Key
+	rec  lsmRecord
+	ok   bool
+	e    error
+}
+
+func (t *sstable) iter(start Key) *tableIter {
+	it := &tableIter{}
+	if len(t.index) == 0 {
+		return it
+	}
+
+	offset := t.index[t.block(start)].offset
+	it.rd = bufio.NewReader(io.NewSectionReader(t.fd, offset, t.dataEnd-offset))
+	it.left = t.dataEnd - offset
+
+	for it.next(); it.ok && it.cur < start; it.next() {
+	}
+
+	return it
+}
+
+func (it *tableIter) valid() bool       { return it.ok }
+func (it *tableIter) key() Key          { return it.cur }
+func (it *tableIter) record() lsmRecord { return it.rec }
+func (it *tableIter) err() error        { return it.e }
+
+func (it *tableIter) next() {
+	it.ok = false
+
+	record, err := readRecord(it.rd, it.left)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			it.e = err
+		}
+		return
+	}
+	it.left -= int64(len(record))
+
+	key, val, flags, err := decodeRecord(record)
+	if err != nil {
+		it.e = err
+		return
+	}
+
+	it.cur, it.rec, it.ok = key, lsmRecord{val: val, tombstone: flags&bitcaskTombstone != 0}, true
+}
+
+// merges several iterators into a single ordered one
+// if a key is present in several iterators, the record of the first one wins
+type mergeIter struct {
+	iters []lsmIterator
+	cur   int
+}
+
+func newMergeIter(iters []lsmIterator) *mergeIter {
+	m := &mergeIter{iters: iters}
+	m.pick()
+
+	return m
+}
+
+func (m *mergeIter) pick() {
+	m.cur = -1
+	for i, it := range m.iters {
+		if it.valid() && (m.cur < 0 || it.key() < m.iters[m.cur].key()) {
+			m.cur = i
+		}
+	}
+}
+
+func (m *mergeIter) valid() bool       { return m.cur >= 0 }
+func (m *mergeIter) key() Key          { return m.iters[m.cur].key() }
+func (m *mergeIter) record() lsmRecord { return m.iters[m.cur].record() }
+
+// skips the current key in every iterator
+func (m *mergeIter) next() {
+	key := m.key()
+	for _, it := range m.iters {
+		if it.valid() && it.key() == key {
+			it.next()
+		}
+	}
+
+	m.pick()
+}
+
+func (m *mergeIter) err() error {
+	for _, it := range m.iters {
+		if err := it.err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
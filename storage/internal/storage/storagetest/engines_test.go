@@ -0,0 +1,11 @@
+package storagetest_test
+
+import (
+	"testing"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage/storagetest"
+)
+
+func TestEngines(t *testing.T) {
+	storagetest.RunEngines(t)
+}
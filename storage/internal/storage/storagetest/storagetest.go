@@ -0,0 +1,763 @@
+// Package storagetest implements a conformance suite for storage.Storage implementations
+//
+// usage (from a _test.go file):
+//
+//	func TestLocalStorage(t *testing.T) {
+//		storagetest.Run(t, func(t testing.TB, path string) storage.Storage {
+//			return storage.NewLocalStorage(path, infoLog, errLog)
+//		}, storagetest.Capabilities{TTL: true, Durable: true})
+//	}
+//
+// or, for every registered engine:
+//
+//	func TestEngines(t *testing.T) {
+//		storagetest.RunEngines(t)
+//	}
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// constructs a storage, which keeps its data at the provided path
+// calling it again with the same path should restore the previous state
+type Factory func(t testing.TB, path string) storage.Storage
+
+// features of the storage under test
+// checks for unsupported features are skipped
+type Capabilities = storage.Capabilities
+
+// runs the whole suite against the storage, produced by the factory
+func Run(t *testing.T, factory Factory, caps Capabilities) {
+	t.Run("CRUD", func(t *testing.T) { testCRUD(t, open(t, factory)) })
+	t.Run("Errors", func(t *testing.T) { testErrors(t, open(t, factory)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, open(t, factory)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, open(t, factory)) })
+
+	t.Run("TTL", func(t *testing.T) {
+		if !caps.TTL {
+			t.Skip("storage doesn't support ttl")
+		}
+		testTTL(t, open(t, factory))
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		if !caps.Scan {
+			t.Skip("storage doesn't support scans")
+		}
+		testScan(t, open(t, factory))
+	})
+
+	t.Run("CAS", func(t *testing.T) {
+		st := open(t, factory)
+		swapper, ok := st.(storage.Swapper)
+		if !ok {
+			t.Skip("storage doesn't support conditional writes")
+		}
+		testCAS(t, st, swapper)
+	})
+
+	t.Run("Counter", func(t *testing.T) {
+		st := open(t, factory)
+		counter, ok := st.(storage.Counter)
+		if !ok {
+			t.Skip("storage doesn't support counters")
+		}
+		testCounter(t, st, counter)
+	})
+
+	t.Run("Collections", func(t *testing.T) {
+		st := open(t, factory)
+		coll, ok := storage.CollectionsOf(st)
+		if !ok {
+			t.Skip("storage doesn't support collections")
+		}
+		testCollections(t, st, coll)
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		if !caps.Durable {
+			t.Skip("storage is not durable")
+		}
+		testPersistence(t, factory)
+	})
+}
+
+// runs the suite against every registered engine
+// with the capabilities, the engine declares
+func RunEngines(t *testing.T) {
+	errLog := logrus.New()
+	errLog.SetOutput(io.Discard)
+
+	for _, engine := range storage.Engines() {
+		t.Run(engine.Name, func(t *testing.T) {
+			Run(t, func(t testing.TB, path string) storage.Storage {
+				st, err := storage.Open(engine.Name, storage.EngineConfig{
+					Path:    path,
+					InfoLog: errLog,
+					ErrLog:  errLog,
+				})
+				if err != nil {
+					t.Fatalf("storage.Open(%v): %v", engine.Name, err)
+				}
+				return st
+			}, engine.Capabilities)
+		})
+	}
+}
+
+// opens a storage in a fresh temp directory
+func open(t *testing.T, factory Factory) storage.Storage {
+	st := factory(t, filepath.Join(t.TempDir(), "data"))
+	t.Cleanup(func() { closeStorage(t, st) })
+
+	return st
+}
+
+func closeStorage(t testing.TB, st storage.Storage) {
+	if closer, ok := st.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	}
+}
+
+func entry(key, data string, expiresAt time.Time) storage.Entry {
+	return storage.EntryFromData(key, data, time.Now(), expiresAt)
+}
+
+func zmember(member string, score float64) storage.ZMember {
+	return storage.ZMember{Member: member, Score: score}
+}
+
+func mustRead(t testing.TB, st storage.Storage, key storage.Key, data string) storage.Entry {
+	t.Helper()
+
+	got, err := st.Read(key)
+	if err != nil {
+		t.Fatalf("Read(%v): %v", key, err)
+	}
+
+	if got.Key != key {
+		t.Errorf("Read(%v): got key %v", key, got.Key)
+	}
+	if got.Value.Data != data {
+		t.Errorf("Read(%v): got data %q, want %q", key, got.Value.Data, data)
+	}
+
+	return got
+}
+
+func mustFail(t testing.TB, op string, err, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Errorf("%v: got error %v, want %v", op, err, want)
+	}
+}
+
+func testCRUD(t *testing.T, st storage.Storage) {
+	if err := st.Create(entry("key", "value", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	mustRead(t, st, "key", "value")
+
+	if err := st.Update(entry("key", "updated", time.Time{})); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	mustRead(t, st, "key", "updated")
+
+	if err := st.Delete("key"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err := st.Read("key")
+	mustFail(t, "Read after Delete", err, storage.ErrKeyNotFound)
+
+	// key can be created again after deletion
+	if err := st.Create(entry("key", "again", time.Time{})); err != nil {
+		t.Fatalf("Create after Delete: %v", err)
+	}
+	mustRead(t, st, "key", "again")
+}
+
+func testErrors(t *testing.T, st storage.Storage) {
+	_, err := st.Read("missing")
+	mustFail(t, "Read", err, storage.ErrKeyNotFound)
+	mustFail(t, "Update", st.Update(entry("missing", "value", time.Time{})), storage.ErrKeyNotFound)
+	mustFail(t, "Delete", st.Delete("missing"), storage.ErrKeyNotFound)
+
+	if err := st.Create(entry("key", "value", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	mustFail(t, "Create existing", st.Create(entry("key", "other", time.Time{})), storage.ErrKeyAlreadyExists)
+
+	// failed create leaves the entry intact
+	mustRead(t, st, "key", "value")
+}
+
+func testUpdate(t *testing.T, st storage.Storage) {
+	expiresAt := time.Now().Add(time.Hour).Round(time.Second)
+
+	if err := st.Create(entry("key", "value", expiresAt)); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// zero ExpiresAt keeps the current ttl
+	if err := st.Update(entry("key", "updated", time.Time{})); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got := mustRead(t, st, "key", "updated")
+	if !got.Value.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ttl after Update: got %v, want %v", got.Value.ExpiresAt, expiresAt)
+	}
+
+	// new ttl replaces the current one
+	newExpiresAt := expiresAt.Add(time.Hour)
+	if err := st.Update(entry("key", "updated", newExpiresAt)); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got = mustRead(t, st, "key", "updated")
+	if !got.Value.ExpiresAt.Equal(newExpiresAt) {
+		t.Errorf("ttl after Update: got %v, want %v", got.Value.ExpiresAt, newExpiresAt)
+	}
+
+	// data is replaced as a whole, empty one included
+	if err := st.Update(entry("key", "", time.Time{})); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	mustRead(t, st, "key", "")
+}
+
+func testTTL(t *testing.T, st storage.Storage) {
+	const ttl = 50 * time.Millisecond
+
+	if err := st.Create(entry("expiring", "value", time.Now().Add(ttl))); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := st.Create(entry("forever", "value", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	mustRead(t, st, "expiring", "value")
+
+	time.Sleep(2 * ttl)
+
+	_, err := st.Read("expiring")
+	mustFail(t, "Read expired", err, storage.ErrKeyNotFound)
+	mustFail(t, "Update expired", st.Update(entry("expiring", "value", time.Time{})), storage.ErrKeyNotFound)
+	mustFail(t, "Delete expired", st.Delete("expiring"), storage.ErrKeyNotFound)
+
+	// entries without ttl never expire
+	mustRead(t, st, "forever", "value")
+
+	// expired key is free to be created again
+	if err := st.Create(entry("expiring", "new", time.Time{})); err != nil {
+		t.Fatalf("Create over expired: %v", err)
+	}
+	mustRead(t, st, "expiring", "new")
+}
+
+func testConcurrency(t *testing.T, st storage.Storage) {
+	const (
+		workers = 8
+		keys    = 25
+	)
+
+	if err := st.Create(entry("shared", "initial", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, workers*keys*4)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < keys; i++ {
+				key := fmt.Sprintf("worker-%v-%v", w, i)
+
+				if err := st.Create(entry(key, key, time.Time{})); err != nil {
+					errs <- fmt.Errorf("Create(%v): %v", key, err)
+				}
+				if err := st.Update(entry("shared", key, time.Time{})); err != nil {
+					errs <- fmt.Errorf("Update(shared): %v", err)
+				}
+				if _, err := st.Read("shared"); err != nil {
+					errs <- fmt.Errorf("Read(shared): %v", err)
+				}
+				// every odd key is deleted
+				if i%2 == 1 {
+					if err := st.Delete(storage.Key(key)); err != nil {
+						errs <- fmt.Errorf("Delete(%v): %v", key, err)
+					}
+				}
+			}
+		}()
+	}
+
+	// concurrent creates of the same key: exactly one should win
+	var (
+		created   int
+		createdMu sync.Mutex
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := st.Create(entry("contended", "value", time.Time{}))
+			if err == nil {
+				createdMu.Lock()
+				created++
+				createdMu.Unlock()
+			} else if !errors.Is(err, storage.ErrKeyAlreadyExists) {
+				errs <- fmt.Errorf("Create(contended): %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if created != 1 {
+		t.Errorf("contended Create succeeded %v times, want 1", created)
+	}
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < keys; i++ {
+			key := storage.Key(fmt.Sprintf("worker-%v-%v", w, i))
+
+			_, err := st.Read(key)
+			if i%2 == 1 {
+				mustFail(t, fmt.Sprintf("Read(%v) after Delete", key), err, storage.ErrKeyNotFound)
+			} else if err != nil {
+				t.Errorf("Read(%v): %v", key, err)
+			}
+		}
+	}
+}
+
+func testScan(t *testing.T, st storage.Storage) {
+	scanner, ok := st.(storage.Scanner)
+	if !ok {
+		t.Fatal("storage declares scans, but doesn't implement storage.Scanner")
+	}
+
+	keys := []string{"a", "b", "user:1:name", "user:1:age", "user:2:name", "z"}
+	for _, key := range keys {
+		if err := st.Create(entry(key, key, time.Time{})); err != nil {
+			t.Fatalf("Create(%v): %v", key, err)
+		}
+	}
+
+	// expired entries are not listed
+	if err := st.Create(entry("user:1:expired", "value", time.Now().Add(-time.Second))); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	check := func(op string, got []storage.Entry, want ...storage.Key) {
+		t.Helper()
+
+		if len(got) != len(want) {
+			t.Errorf("%v: got %v entries, want %v", op, len(got), len(want))
+			return
+		}
+		for i := range want {
+			if got[i].Key != want[i] || got[i].Value.Data != string(want[i]) {
+				t.Errorf("%v: entry %v is %v=%q, want %v", op, i, got[i].Key, got[i].Value.Data, want[i])
+			}
+		}
+	}
+
+	got, err := scanner.Scan("", "", 0)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	check("Scan all", got, "a", "b", "user:1:age", "user:1:name", "user:2:name", "z")
+
+	got, err = scanner.Scan("b", "user:2", 0)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	check("Scan range", got, "b", "user:1:age", "user:1:name")
+
+	got, err = scanner.Scan("b", "", 2)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	check("Scan limit", got, "b", "user:1:age")
+
+	got, err = scanner.ScanPrefix("user:1:")
+	if err != nil {
+		t.Fatalf("ScanPrefix: %v", err)
+	}
+	check("ScanPrefix", got, "user:1:age", "user:1:name")
+}
+
+func testCAS(t *testing.T, st storage.Storage, swapper storage.Swapper) {
+	version := func(key storage.Key) uint64 {
+		got, err := st.Read(key)
+		if err != nil {
+			t.Fatalf("Read(%v): %v", key, err)
+		}
+		return got.Value.Version
+	}
+
+	if err := st.Create(entry("key", "value", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	created := version("key")
+
+	if err := st.Update(entry("key", "updated", time.Time{})); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated := version("key"); updated <= created {
+		t.Fatalf("version after Update: got %v, want > %v", updated, created)
+	}
+	current := version("key")
+
+	mustFail(t, "CompareAndSwap(stale)", swapper.CompareAndSwap("key", created, entry("", "stale", time.Time{}).Value), storage.ErrVersionMismatch)
+	mustFail(t, "CompareAndSwap(absent)", swapper.CompareAndSwap("key", 0, entry("", "stale", time.Time{}).Value), storage.ErrVersionMismatch)
+	mustFail(t, "CompareAndSwap(missing)", swapper.CompareAndSwap("missing", current, entry("", "stale", time.Time{}).Value), storage.ErrVersionMismatch)
+	mustRead(t, st, "key", "updated")
+
+	if err := swapper.CompareAndSwap("key", current, entry("", "swapped", time.Time{}).Value); err != nil {
+		t.Fatalf("CompareAndSwap: %v", err)
+	}
+	mustRead(t, st, "key", "swapped")
+
+	// zero expected version creates the entry
+	if err := swapper.CompareAndSwap("created", 0, entry("", "value", time.Time{}).Value); err != nil {
+		t.Fatalf("CompareAndSwap(create): %v", err)
+	}
+	mustRead(t, st, "created", "value")
+
+	// versions are not reused by the next entry of the same key
+	previous := version("created")
+	if err := st.Delete("created"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := st.Create(entry("created", "recreated", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	mustFail(t, "CompareAndSwap(previous entry)", swapper.CompareAndSwap("created", previous, entry("", "stale", time.Time{}).Value), storage.ErrVersionMismatch)
+	mustRead(t, st, "created", "recreated")
+
+	// read-modify-write loops don't lose updates
+	const (
+		workers    = 8
+		increments = 25
+	)
+
+	if err := st.Create(entry("counter", "0", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				for {
+					got, err := st.Read("counter")
+					if err != nil {
+						t.Errorf("Read: %v", err)
+						return
+					}
+
+					var n int
+					fmt.Sscan(got.Value.Data, &n)
+
+					err = swapper.CompareAndSwap("counter", got.Value.Version, entry("", fmt.Sprint(n+1), time.Time{}).Value)
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, storage.ErrVersionMismatch) {
+						t.Errorf("CompareAndSwap: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	mustRead(t, st, "counter", fmt.Sprint(workers*increments))
+}
+
+func testCounter(t *testing.T, st storage.Storage, counter storage.Counter) {
+	// missing counter is created with the provided ttl
+	if n, err := counter.IncrBy("counter", 5, time.Now().Add(time.Hour)); err != nil || n != 5 {
+		t.Fatalf("IncrBy(missing): got %v, %v, want 5", n, err)
+	}
+	if n, err := counter.IncrBy("counter", -7, time.Time{}); err != nil || n != -2 {
+		t.Fatalf("IncrBy: got %v, %v, want -2", n, err)
+	}
+	mustRead(t, st, "counter", "-2")
+
+	got, err := st.Read("counter")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got.Value.ExpiresAt.IsZero() {
+		t.Fatalf("IncrBy dropped the ttl of the counter")
+	}
+
+	if f, err := counter.IncrByFloat("float", 1.5, time.Time{}); err != nil || f != 1.5 {
+		t.Fatalf("IncrByFloat(missing): got %v, %v, want 1.5", f, err)
+	}
+	if f, err := counter.IncrByFloat("counter", 0.25, time.Time{}); err != nil || f != -1.75 {
+		t.Fatalf("IncrByFloat: got %v, %v, want -1.75", f, err)
+	}
+	mustRead(t, st, "counter", "-1.75")
+
+	if err := st.Create(entry("text", "value", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = counter.IncrBy("text", 1, time.Time{})
+	mustFail(t, "IncrBy(text)", err, storage.ErrNotInteger)
+	_, err = counter.IncrBy("counter", 1, time.Time{})
+	mustFail(t, "IncrBy(float)", err, storage.ErrNotInteger)
+	_, err = counter.IncrByFloat("text", 1, time.Time{})
+	mustFail(t, "IncrByFloat(text)", err, storage.ErrNotFloat)
+	mustRead(t, st, "text", "value")
+
+	if _, err := counter.IncrBy("max", math.MaxInt64, time.Time{}); err != nil {
+		t.Fatalf("IncrBy(max): %v", err)
+	}
+	_, err = counter.IncrBy("max", 1, time.Time{})
+	mustFail(t, "IncrBy(overflow)", err, storage.ErrOverflow)
+
+	// concurrent increments are not lost
+	const (
+		workers    = 8
+		increments = 25
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				if _, err := counter.IncrBy("concurrent", 1, time.Time{}); err != nil {
+					t.Errorf("IncrBy: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	mustRead(t, st, "concurrent", fmt.Sprint(workers*increments))
+}
+
+func testCollections(t *testing.T, st storage.Storage, coll *storage.Collections) {
+	mustEqual := func(op string, got, want any) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v: got %v, want %v", op, got, want)
+		}
+	}
+
+	// lists
+	n, err := coll.Push("list", []string{"b", "c"}, false, time.Now().Add(time.Hour))
+	mustEqual("Push(right)", []any{n, err}, []any{2, nil})
+	n, err = coll.Push("list", []string{"a", "z"}, true, time.Time{})
+	mustEqual("Push(left)", []any{n, err}, []any{4, nil})
+
+	values, err := coll.Range("list", 0, -1)
+	mustEqual("Range", []any{values, err}, []any{[]string{"z", "a", "b", "c"}, nil})
+	values, err = coll.Range("list", -2, 10)
+	mustEqual("Range(negative)", []any{values, err}, []any{[]string{"b", "c"}, nil})
+	values, err = coll.Range("missing", 0, -1)
+	mustEqual("Range(missing)", []any{values, err}, []any{[]string{}, nil})
+
+	values, err = coll.Pop("list", 1, true)
+	mustEqual("Pop(left)", []any{values, err}, []any{[]string{"z"}, nil})
+	values, err = coll.Pop("list", 2, false)
+	mustEqual("Pop(right)", []any{values, err}, []any{[]string{"c", "b"}, nil})
+
+	got, err := st.Read("list")
+	if err != nil || got.Value.Type != storage.TypeList || got.Value.ExpiresAt.IsZero() {
+		t.Fatalf("Read(list): got %+v, %v, want a list with ttl", got, err)
+	}
+
+	// emptied collections are removed
+	values, err = coll.Pop("list", 5, true)
+	mustEqual("Pop(all)", []any{values, err}, []any{[]string{"a"}, nil})
+	_, err = st.Read("list")
+	mustFail(t, "Read(emptied list)", err, storage.ErrKeyNotFound)
+	_, err = coll.Pop("list", 1, true)
+	mustFail(t, "Pop(missing)", err, storage.ErrKeyNotFound)
+
+	// hashes
+	n, err = coll.HSet("hash", map[string]string{"a": "1", "b": "2"}, time.Time{})
+	mustEqual("HSet", []any{n, err}, []any{2, nil})
+	n, err = coll.HSet("hash", map[string]string{"b": "3", "c": "4"}, time.Time{})
+	mustEqual("HSet(existing)", []any{n, err}, []any{1, nil})
+
+	value, err := coll.HGet("hash", "b")
+	mustEqual("HGet", []any{value, err}, []any{"3", nil})
+	_, err = coll.HGet("hash", "missing")
+	mustFail(t, "HGet(missing)", err, storage.ErrFieldNotFound)
+
+	n, err = coll.HDel("hash", []string{"a", "missing"})
+	mustEqual("HDel", []any{n, err}, []any{1, nil})
+
+	hash, err := coll.HGetAll("hash")
+	mustEqual("HGetAll", []any{hash, err}, []any{map[string]string{"b": "3", "c": "4"}, nil})
+
+	// sets
+	n, err = coll.SAdd("set1", []string{"c", "a", "b", "a"}, time.Time{})
+	mustEqual("SAdd", []any{n, err}, []any{3, nil})
+	n, err = coll.SAdd("set2", []string{"b", "c", "d"}, time.Time{})
+	mustEqual("SAdd", []any{n, err}, []any{3, nil})
+	n, err = coll.SRem("set2", []string{"d", "missing"})
+	mustEqual("SRem", []any{n, err}, []any{1, nil})
+
+	members, err := coll.SMembers("set1")
+	mustEqual("SMembers", []any{members, err}, []any{[]string{"a", "b", "c"}, nil})
+	members, err = coll.SInter([]storage.Key{"set1", "set2"})
+	mustEqual("SInter", []any{members, err}, []any{[]string{"b", "c"}, nil})
+	members, err = coll.SInter([]storage.Key{"set1", "missing"})
+	mustEqual("SInter(missing)", []any{members, err}, []any{[]string{}, nil})
+
+	// sorted sets
+	n, err = coll.ZAdd("zset", []storage.ZMember{zmember("c", 3), zmember("a", 1), zmember("b", 2), zmember("a2", 1)}, time.Time{})
+	mustEqual("ZAdd", []any{n, err}, []any{4, nil})
+	n, err = coll.ZAdd("zset", []storage.ZMember{zmember("c", 0.5), zmember("d", 4)}, time.Time{})
+	mustEqual("ZAdd(update)", []any{n, err}, []any{1, nil})
+	_, err = coll.ZAdd("zset", []storage.ZMember{zmember("nan", math.NaN())}, time.Time{})
+	mustFail(t, "ZAdd(NaN)", err, storage.ErrNotFloat)
+
+	zrange, err := coll.ZRange("zset", 0, -1, false)
+	mustEqual("ZRange", []any{zrange, err}, []any{[]storage.ZMember{zmember("c", 0.5), zmember("a", 1), zmember("a2", 1), zmember("b", 2), zmember("d", 4)}, nil})
+	zrange, err = coll.ZRange("zset", 0, 1, true)
+	mustEqual("ZRange(reverse)", []any{zrange, err}, []any{[]storage.ZMember{zmember("d", 4), zmember("b", 2)}, nil})
+	zrange, err = coll.ZRangeByScore("zset", 1, 2, false, 0)
+	mustEqual("ZRangeByScore", []any{zrange, err}, []any{[]storage.ZMember{zmember("a", 1), zmember("a2", 1), zmember("b", 2)}, nil})
+	zrange, err = coll.ZRangeByScore("zset", 1, math.Inf(1), true, 2)
+	mustEqual("ZRangeByScore(reverse)", []any{zrange, err}, []any{[]storage.ZMember{zmember("d", 4), zmember("b", 2)}, nil})
+
+	n, err = coll.ZRank("zset", "b", false)
+	mustEqual("ZRank", []any{n, err}, []any{3, nil})
+	n, err = coll.ZRank("zset", "b", true)
+	mustEqual("ZRank(reverse)", []any{n, err}, []any{1, nil})
+	score, err := coll.ZScore("zset", "c")
+	mustEqual("ZScore", []any{score, err}, []any{0.5, nil})
+	_, err = coll.ZScore("zset", "missing")
+	mustFail(t, "ZScore(missing)", err, storage.ErrMemberNotFound)
+
+	n, err = coll.ZRem("zset", []string{"a", "missing"})
+	mustEqual("ZRem", []any{n, err}, []any{1, nil})
+	n, err = coll.ZCard("zset")
+	mustEqual("ZCard", []any{n, err}, []any{4, nil})
+
+	// operations don't mix up types
+	if err := st.Create(entry("string", "value", time.Time{})); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = coll.Push("hash", []string{"a"}, false, time.Time{})
+	mustFail(t, "Push(hash)", err, storage.ErrWrongType)
+	_, err = coll.HGet("set1", "a")
+	mustFail(t, "HGet(set)", err, storage.ErrWrongType)
+	_, err = coll.SAdd("string", []string{"a"}, time.Time{})
+	mustFail(t, "SAdd(string)", err, storage.ErrWrongType)
+	_, err = coll.SInter([]storage.Key{"set1", "hash"})
+	mustFail(t, "SInter(hash)", err, storage.ErrWrongType)
+	_, err = coll.ZRange("set1", 0, -1, false)
+	mustFail(t, "ZRange(set)", err, storage.ErrWrongType)
+
+	if counter, ok := st.(storage.Counter); ok {
+		_, err = counter.IncrBy("set1", 1, time.Time{})
+		mustFail(t, "IncrBy(set)", err, storage.ErrWrongType)
+	}
+
+	// plain writes replace collections
+	if err := st.Update(entry("hash", "value", time.Time{})); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	_, err = coll.HGetAll("hash")
+	mustFail(t, "HGetAll(replaced)", err, storage.ErrWrongType)
+}
+
+func testPersistence(t *testing.T, factory Factory) {
+	path := filepath.Join(t.TempDir(), "data")
+	expiresAt := time.Now().Add(time.Hour).Round(time.Second)
+
+	st := factory(t, path)
+
+	for _, op := range []error{
+		st.Create(entry("kept", "value", expiresAt)),
+		st.Create(entry("updated", "value", time.Time{})),
+		st.Create(entry("deleted", "value", time.Time{})),
+		st.Update(entry("updated", "new", time.Time{})),
+		st.Delete("deleted"),
+	} {
+		if op != nil {
+			t.Fatalf("populating storage: %v", op)
+		}
+	}
+
+	closeStorage(t, st)
+
+	st = factory(t, path)
+	// storage is reopened once again below
+	defer func() { closeStorage(t, st) }()
+
+	got := mustRead(t, st, "kept", "value")
+	if !got.Value.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ttl after restart: got %v, want %v", got.Value.ExpiresAt, expiresAt)
+	}
+
+	mustRead(t, st, "updated", "new")
+
+	_, err := st.Read("deleted")
+	mustFail(t, "Read deleted after restart", err, storage.ErrKeyNotFound)
+
+	// types of the values survive restarts as well
+	if coll, ok := storage.CollectionsOf(st); ok {
+		if _, err := coll.Push("list", []string{"a", "b"}, false, time.Time{}); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+		if _, err := coll.ZAdd("zset", []storage.ZMember{zmember("b", 2), zmember("a", 1)}, time.Time{}); err != nil {
+			t.Fatalf("ZAdd: %v", err)
+		}
+
+		closeStorage(t, st)
+		st = factory(t, path)
+		coll, _ = storage.CollectionsOf(st)
+
+		values, err := coll.Range("list", 0, -1)
+		if err != nil || !reflect.DeepEqual(values, []string{"a", "b"}) {
+			t.Errorf("list after restart: got %v, %v, want [a b]", values, err)
+		}
+
+		members, err := coll.ZRange("zset", 0, -1, false)
+		if err != nil || !reflect.DeepEqual(members, []storage.ZMember{zmember("a", 1), zmember("b", 2)}) {
+			t.Errorf("sorted set after restart: got %v, %v, want [{a 1} {b 2}]", members, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// storage, which is able to apply several operations atomically
+type Transactor interface {
+	// applies either every operation of the transaction or none of them
+	Txn(txn Txn) error
+}
+
+type TxnOpType string
+
+const (
+	// same semantics as Create
+	TxnAdd TxnOpType = "add"
+	// same semantics as Update
+	TxnSet TxnOpType = "set"
+	// same semantics as Delete
+	TxnDel TxnOpType = "del"
+)
+
+// operations, applied only if every condition holds
+type Txn struct {
+	Conditions []TxnCondition `json:"conditions"`
+	Ops        []TxnOp        `json:"ops"`
+}
+
+// expected state of an entry before the transaction
+type TxnCondition struct {
+	Key Key `json:"key"`
+	// zero means the entry should not exist
+	Version uint64 `json:"version"`
+}
+
+type TxnOp struct {
+	Op    TxnOpType `json:"op"`
+	Key   Key       `json:"key"`
+	Value Value     `json:"value"`
+}
+
+// names the condition or the operation, which failed the transaction
+type TxnError struct {
+	// "condition" or "op"
+	Kind  string
+	Index int
+	Key   Key
+	Err   error
+}
+
+func (e *TxnError) Error() string {
+	return fmt.Sprintf("txn %v %v (key %q) failed: %v", e.Kind, e.Index, e.Key, e.Err)
+}
+
+func (e *TxnError) Unwrap() error {
+	return e.Err
+}
+
+// state of an entry as the transaction goes
+type txnEntry struct {
+	val    Value
+	exists bool
+}
+
+// every shard, touched by the transaction, is locked for the whole run,
+// conditions and operations are checked against a private view,
+// and only then the result is logged as a single record and applied
+func (st *ImprovedStorage) Txn(txn Txn) error {
+	keys := []Key{}
+	for _, cond := range txn.Conditions {
+		keys = append(keys, cond.Key)
+	}
+	for _, op := range txn.Ops {
+		keys = append(keys, op.Key)
+	}
+
+	unlock := st.cc.lockKeys(keys)
+	defer unlock()
+
+	// current state of every touched key
+	before := make(map[Key]txnEntry, len(keys))
+	for _, key := range keys {
+		if _, ok := before[key]; !ok {
+			val, ok := st.cc.shard(key).live(key)
+			before[key] = txnEntry{val: val, exists: ok}
+		}
+	}
+
+	for i, cond := range txn.Conditions {
+		cur := before[cond.Key]
+		if err := checkVersion(cur.val.Version, cur.exists, cond.Version); err != nil {
+			return &TxnError{Kind: "condition", Index: i, Key: cond.Key, Err: err}
+		}
+	}
+
+	after := make(map[Key]txnEntry, len(before))
+	for key, cur := range before {
+		after[key] = cur
+	}
+
+	changed := make(map[Key]bool)
+	for i, op := range txn.Ops {
+		cur, val := after[op.Key], op.Value
+
+		switch op.Op {
+		case TxnAdd:
+			if cur.exists {
+				return &TxnError{Kind: "op", Index: i, Key: op.Key, Err: ErrKeyAlreadyExists}
+			}
+			val.Version = st.versions.next()
+			after[op.Key] = txnEntry{val: val, exists: true}
+		case TxnSet:
+			if !cur.exists {
+				return &TxnError{Kind: "op", Index: i, Key: op.Key, Err: ErrKeyNotFound}
+			}
+			// current ttl is kept, unless a new one is provided
+			if val.ExpiresAt.IsZero() {
+				val.ExpiresAt = cur.val.ExpiresAt
+			}
+			val.Version = st.versions.next()
+			after[op.Key] = txnEntry{val: val, exists: true}
+		case TxnDel:
+			if !cur.exists {
+				return &TxnError{Kind: "op", Index: i, Key: op.Key, Err: ErrKeyNotFound}
+			}
+			after[op.Key] = txnEntry{}
+		default:
+			return &TxnError{Kind: "op", Index: i, Key: op.Key, Err: fmt.Errorf("unknown op %q", op.Op)}
+		}
+
+		changed[op.Key] = true
+	}
+
+	if err := st.reserveTxn(before, after, changed); err != nil {
+		return err
+	}
+
+	// sorted, so that the log doesn't depend on map order
+	written := []Key{}
+	for key := range changed {
+		written = append(written, key)
+	}
+	sort.Slice(written, func(i, j int) bool { return written[i] < written[j] })
+
+	rec := walRecord{Op: walTxn}
+	for _, key := range written {
+		if e := after[key]; e.exists {
+			rec.Ops = append(rec.Ops, walRecord{Op: walPut, Key: key, Value: &e.val})
+		} else {
+			rec.Ops = append(rec.Ops, walRecord{Op: walDel, Key: key})
+		}
+	}
+
+	if len(rec.Ops) == 0 {
+		return nil
+	}
+
+	if err := st.append(rec); err != nil {
+		return err
+	}
+
+	for _, key := range written {
+		sh := st.cc.shard(key)
+		if e := after[key]; e.exists {
+			sh.set(key, e.val)
+			st.feed.put(key, e.val)
+		} else {
+			sh.remove(key)
+			st.feed.del(key)
+		}
+	}
+
+	return nil
+}
+
+// frees memory for the result of the transaction
+// space is reserved at once for every touched shard, so that an aborted reservation doesn't evict anything
+// keys of the transaction itself are never evicted
+func (st *ImprovedStorage) reserveTxn(before, after map[Key]txnEntry, changed map[Key]bool) error {
+	var delta int64
+	for key := range changed {
+		if e := after[key]; e.exists {
+			delta += entrySize(key, e.val)
+		}
+		if e := before[key]; e.exists {
+			delta -= entrySize(key, e.val)
+		}
+	}
+
+	keys := make([]Key, 0, len(before))
+	for key := range before {
+		keys = append(keys, key)
+	}
+
+	return st.cc.reserveDelta(st.cc.shardsOf(keys), delta, keys, st.evict)
+}
+
+// returns distinct shards of the keys, ordered by their position
+func (cc *cache) shardsOf(keys []Key) []*shard {
+	seen := make(map[*shard]bool)
+	shards := []*shard{}
+	for _, key := range keys {
+		if sh := cc.shard(key); !seen[sh] {
+			seen[sh] = true
+			shards = append(shards, sh)
+		}
+	}
+
+	sort.Slice(shards, func(i, j int) bool { return shards[i].index < shards[j].index })
+
+	return shards
+}
+
+// locks shards of every provided key in a fixed order, so that transactions don't deadlock
+// returns a function, which unlocks them
+func (cc *cache) lockKeys(keys []Key) func() {
+	shards := cc.shardsOf(keys)
+
+	for _, sh := range shards {
+		sh.Lock()
+	}
+
+	return func() {
+		for _, sh := range shards {
+			sh.Unlock()
+		}
+	}
+}
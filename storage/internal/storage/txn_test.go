@@ -0,0 +1,126 @@
+package storage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+func TestTxn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	put(t, st, "from", "10")
+	put(t, st, "to", "0")
+
+	err := st.Txn(storage.Txn{
+		Conditions: []storage.TxnCondition{
+			{Key: "from", Version: version(t, st, "from")},
+			{Key: "to", Version: version(t, st, "to")},
+			{Key: "log"},
+		},
+		Ops: []storage.TxnOp{
+			{Op: storage.TxnSet, Key: "from", Value: value("7")},
+			{Op: storage.TxnSet, Key: "to", Value: value("3")},
+			{Op: storage.TxnAdd, Key: "log", Value: value("moved 3")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Txn: %v", err)
+	}
+
+	st = reopen(t, st, path)
+
+	expect(t, st, "from", "7")
+	expect(t, st, "to", "3")
+	expect(t, st, "log", "moved 3")
+}
+
+func TestTxnAborted(t *testing.T) {
+	st := openImproved(t, "")
+
+	put(t, st, "a", "1")
+	put(t, st, "b", "2")
+	stale := version(t, st, "a")
+	put(t, st, "a", "3")
+
+	tests := []struct {
+		name string
+		txn  storage.Txn
+		kind string
+		err  error
+	}{
+		{
+			name: "stale version",
+			txn: storage.Txn{
+				Conditions: []storage.TxnCondition{{Key: "a", Version: stale}},
+				Ops:        []storage.TxnOp{{Op: storage.TxnDel, Key: "b"}},
+			},
+			kind: "condition",
+			err:  storage.ErrVersionMismatch,
+		},
+		{
+			name: "existing key",
+			txn: storage.Txn{
+				Conditions: []storage.TxnCondition{{Key: "b"}},
+			},
+			kind: "condition",
+			err:  storage.ErrVersionMismatch,
+		},
+		{
+			name: "failed op",
+			txn: storage.Txn{
+				Ops: []storage.TxnOp{
+					{Op: storage.TxnDel, Key: "b"},
+					{Op: storage.TxnAdd, Key: "a", Value: value("4")},
+				},
+			},
+			kind: "op",
+			err:  storage.ErrKeyAlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := st.Txn(tt.txn)
+
+			var txnErr *storage.TxnError
+			if !errors.As(err, &txnErr) || txnErr.Kind != tt.kind || !errors.Is(err, tt.err) {
+				t.Fatalf("Txn: got %v, want %v of %v", err, tt.err, tt.kind)
+			}
+
+			// nothing is applied
+			expect(t, st, "a", "3")
+			expect(t, st, "b", "2")
+		})
+	}
+}
+
+func TestTxnTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	put(t, st, "a", "1")
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := segments(t, path)
+
+	// operations of a transaction share a single line, so a torn one drops all of them
+	fd, err := os.OpenFile(segs[len(segs)-1], os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString(`{"op":"txn","ops":[{"op":"del","key":"a"},{"op":"put","key":"b","value":{"data":"2"`)
+	fd.Close()
+
+	st = openImproved(t, path)
+
+	expect(t, st, "a", "1")
+	expectMissing(t, st, "b")
+}
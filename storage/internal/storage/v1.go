@@ -12,6 +12,13 @@ import (
 )
 
 // basically a CRUD repository for entries
+//
+// every implementation should follow the same contract
+// (see storagetest package, which checks it):
+//   - Create fails with ErrKeyAlreadyExists if the key is present
+//   - Read, Update and Delete fail with ErrKeyNotFound if it is not
+//   - expired entries are treated as absent
+//   - Update replaces the data, while zero ExpiresAt keeps the current one
 type Storage interface {
 	Create(entry Entry) error
 	Read(key Key) (Entry, error)
@@ -19,27 +26,69 @@ type Storage interface {
 	Delete(key Key) error
 }
 
+// max amount of expired keys removed per cleanup
+const cleanupBatch = 1000
+
 // storage impl
 // handles entry storing logic
 // as well as ttl cleanups
 type LocalStorage struct {
 	file fileHandler
+	// keys with ttl, ordered by expiration time
+	ttl *expiryIndex
 
 	mu      *sync.Mutex
 	infoLog *logrus.Logger
 	errLog  *logrus.Logger
+
+	// receives changes, may be nil
+	feed *Feed
+	// versions of written entries
+	versions *versionClock
+
+	// closed to stop the cleanup
+	done chan struct{}
+}
+
+// Option configuration pattern
+type LocalOption func(*LocalStorage)
+
+// sets the feed, which receives changes of the storage
+func WithLocalFeed(feed *Feed) LocalOption {
+	return func(ls *LocalStorage) {
+		ls.feed = feed
+	}
 }
 
-func NewLocalStorage(filepath string, infoLog *logrus.Logger, errLog *logrus.Logger) *LocalStorage {
+func NewLocalStorage(filepath string, infoLog *logrus.Logger, errLog *logrus.Logger, opts ...LocalOption) *LocalStorage {
 	file := fileHandler{
 		filepath: filepath,
 	}
 
 	ls := &LocalStorage{
-		file:    file,
-		mu:      &sync.Mutex{},
-		infoLog: infoLog,
-		errLog:  errLog,
+		file:     file,
+		ttl:      newExpiryIndex(),
+		mu:       &sync.Mutex{},
+		versions: newVersionClock(),
+		infoLog:  infoLog,
+		errLog:   errLog,
+		done:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(ls)
+	}
+
+	// building expiry index from the stored entries
+	fileData, err := file.read()
+	if err != nil {
+		ls.logErr(err)
+	} else {
+		for k, v := range *fileData {
+			ls.ttl.set(k, v.ExpiresAt)
+			ls.feed.track(k, v.ExpiresAt)
+			ls.versions.observe(v.Version)
+		}
 	}
 
 	// default cleanup interval - 10 seconds
@@ -49,15 +98,20 @@ func NewLocalStorage(filepath string, infoLog *logrus.Logger, errLog *logrus.Log
 }
 
 func (ls *LocalStorage) Create(entry Entry) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
 	data, err := ls.file.read()
 	if err != nil {
 		return err
 	}
 
 	// check if entry key matches any stored key
-	if _, ok := (*data)[entry.Key]; ok {
+	// expired entries are overwritten
+	if v, ok := (*data)[entry.Key]; ok && !v.expired(time.Now()) {
 		return ErrKeyAlreadyExists
 	} else {
+		entry.Value.Version = ls.versions.next()
 		(*data)[entry.Key] = entry.Value
 	}
 
@@ -65,18 +119,25 @@ func (ls *LocalStorage) Create(entry Entry) error {
 		return err
 	}
 
+	ls.ttl.set(entry.Key, entry.Value.ExpiresAt)
+	ls.feed.put(entry.Key, entry.Value)
+
 	return nil
 }
 
 func (ls *LocalStorage) Read(key Key) (Entry, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
 	data, err := ls.file.read()
 	if err != nil {
 		return Entry{}, err
 	}
 
 	// retrieve and check if key exists
+	// expired entries are left for the cleanup
 	val, ok := (*data)[key]
-	if !ok {
+	if !ok || val.expired(time.Now()) {
 		return Entry{}, ErrKeyNotFound
 	}
 
@@ -84,6 +145,9 @@ func (ls *LocalStorage) Read(key Key) (Entry, error) {
 }
 
 func (ls *LocalStorage) Update(entry Entry) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
 	data, err := ls.file.read()
 	if err != nil {
 		return err
@@ -91,7 +155,7 @@ func (ls *LocalStorage) Update(entry Entry) error {
 
 	// check if entry key matches any stored key
 	v, ok := (*data)[entry.Key]
-	if !ok {
+	if !ok || v.expired(time.Now()) {
 		return ErrKeyNotFound
 	}
 
@@ -100,10 +164,10 @@ func (ls *LocalStorage) Update(entry Entry) error {
 		v.ExpiresAt = entry.Value.ExpiresAt
 	}
 
-	// update value if a new one was provided
-	if entry.Value.Data != "" {
-		v.Data = entry.Value.Data
-	}
+	v.Data = entry.Value.Data
+	v.Type = entry.Value.Type
+	v.UpdatedAt = entry.Value.UpdatedAt
+	v.Version = ls.versions.next()
 
 	(*data)[entry.Key] = v
 
@@ -111,33 +175,59 @@ func (ls *LocalStorage) Update(entry Entry) error {
 		return err
 	}
 
+	ls.ttl.set(entry.Key, v.ExpiresAt)
+	ls.feed.put(entry.Key, v)
+
 	return nil
 }
 
 func (ls *LocalStorage) Delete(key Key) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
 	data, err := ls.file.read()
 	if err != nil {
 		return err
 	}
 
 	// check if entry key matches any stored key
-	if _, ok := (*data)[key]; !ok {
+	if v, ok := (*data)[key]; !ok || v.expired(time.Now()) {
 		return ErrKeyNotFound
-	} else {
-		delete(*data, key)
 	}
 
-	if err := ls.file.flush(*data); err != nil {
+	return ls.del(*data, key)
+}
+
+// removes the entry and flushes the rest of the data
+// lock should be held by the caller
+func (ls *LocalStorage) del(d data, key Key) error {
+	delete(d, key)
+
+	if err := ls.file.flush(d); err != nil {
 		return err
 	}
 
+	ls.ttl.remove(key)
+	ls.feed.del(key)
+
+	return nil
+}
+
+// stops the cleanup
+// data is flushed on every write, so there's nothing else to release
+func (ls *LocalStorage) Close() error {
+	close(ls.done)
 	return nil
 }
 
 func (ls *LocalStorage) Cleanup(cooldown time.Duration) {
 	for {
 		// cleans up expired data each cooldown-amount seconds
-		<-time.After(cooldown)
+		select {
+		case <-time.After(cooldown):
+		case <-ls.done:
+			return
+		}
 
 		now := time.Now()
 
@@ -149,49 +239,63 @@ func (ls *LocalStorage) Cleanup(cooldown time.Duration) {
 		// locking up any I/O on file until cleanup is over
 		ls.mu.Lock()
 
-		fileData, err := ls.file.read()
-		if err != nil {
-			ls.errLog.WithFields(
-				logrus.Fields{
-					"time":  time.Now(),
-					"error": err.Error(),
-				},
-			).Error()
-		}
-
-		// iterating over file data and calculating
-		// whether the expiration time exceedes current time
-		for k, v := range *fileData {
-			if v.ExpiresAt.Before(now) {
-				ls.infoLog.WithFields(logrus.Fields{
-					"status": "found",
-					"data":   fmt.Sprintf("key=%v: value=%v \n", k, v.Data),
-					"at":     now,
-				}).Info()
-				// deleting entry
-				delete(*fileData, k)
-			}
-		}
+		// taking only the keys, which are actually due,
+		// so the file is not touched at all if nothing has expired
+		due := ls.ttl.due(now, cleanupBatch)
 
-		if err := ls.file.flush(*fileData); err != nil {
-			ls.errLog.WithFields(
-				logrus.Fields{
-					"time":  time.Now(),
-					"error": err.Error(),
-				},
-			).Error()
+		if len(due) != 0 {
+			ls.cleanup(due, now)
 		}
 
 		ls.mu.Unlock()
 
 		ls.infoLog.WithFields(logrus.Fields{
-			"status": "ended",
+			"status":  "ended",
+			"expired": len(due),
+			"at":      now,
+		}).Info()
+
+	}
+}
+
+// removes provided expired keys from the file
+// mutex should be held by the caller
+func (ls *LocalStorage) cleanup(due []Key, now time.Time) {
+	fileData, err := ls.file.read()
+	if err != nil {
+		ls.logErr(err)
+		return
+	}
+
+	for _, k := range due {
+		v, ok := (*fileData)[k]
+		if !ok {
+			continue
+		}
+
+		ls.infoLog.WithFields(logrus.Fields{
+			"status": "found",
+			"data":   fmt.Sprintf("key=%v: value=%v \n", k, v.Data),
 			"at":     now,
 		}).Info()
+		// deleting entry
+		delete(*fileData, k)
+	}
 
+	if err := ls.file.flush(*fileData); err != nil {
+		ls.logErr(err)
 	}
 }
 
+func (ls *LocalStorage) logErr(err error) {
+	ls.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+}
+
 // abstraction over file I/O
 type fileHandler struct {
 	mu       *sync.Mutex
@@ -5,145 +5,255 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
-	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// storage impl
+// keeps entries in a sharded in-mem cache
 type ImprovedStorage struct {
-	cc *cache
+	cc   *cache
+	log  *wal
+	snap *snapshotter
 
+	// last written snapshot generation
+	generation uint64
+	compaction compaction
+
+	syncPolicy          SyncPolicy
+	syncInterval        time.Duration
+	snapshotInterval    time.Duration
+	snapshotKeep        int
+	compactionThreshold int64
+	expiryInterval      time.Duration
+	expiryBatch         int
+
+	shards         int
+	maxMemory      int64
+	evictionPolicy EvictionPolicy
+
+	// receives changes, may be nil
+	feed *Feed
+	// versions of written entries
+	versions *versionClock
+
+	done   chan struct{}
 	errLog *logrus.Logger
 }
 
-func NewImprovedStorage(filepath string, errLog *logrus.Logger) (*ImprovedStorage, error) {
+// in-mem storage, persisted with snapshots and a write-ahead log
+// empty filepath makes it memory-only
+func NewImprovedStorage(filepath string, errLog *logrus.Logger, opts ...Option) (*ImprovedStorage, error) {
 	st := &ImprovedStorage{
-		cc: &cache{
-			sync.RWMutex{},
-			make(store),
-		},
+		shards:         defaultShards,
+		evictionPolicy: defaultEvictionPolicy,
+
+		syncPolicy:       defaultSyncPolicy,
+		syncInterval:     defaultSyncInterval,
+		snapshotInterval: defaultSnapshotInterval,
+		snapshotKeep:     defaultSnapshotKeep,
+
+		compactionThreshold: defaultCompactionThreshold,
+		expiryInterval:      defaultExpiryInterval,
+		expiryBatch:         defaultExpiryBatch,
+
+		versions: newVersionClock(),
 
+		done:   make(chan struct{}),
 		errLog: errLog,
 	}
 
-	fd, err := os.OpenFile(filepath, os.O_APPEND|os.O_RDWR, 0777)
-	if err != nil {
-		return nil, fmt.Errorf("os.OpenFile: %v", err)
+	for _, opt := range opts {
+		opt(st)
 	}
 
-	if err := st.restore(fd); err != nil {
-		if !errors.Is(err, ErrNothingToRestore) {
+	st.cc = newCache(st.shards, st.maxMemory, st.evictionPolicy)
+
+	// empty path - memory-only storage
+	if filepath != "" {
+		st.snap = newSnapshotter(filepath, st.snapshotKeep, errLog)
+
+		if err := st.restore(filepath); err != nil {
 			log.Println("failed to restore state: ", err)
+			return nil, err
 		}
-		return nil, err
+
+		go st.compactLoop(st.snapshotInterval)
 	}
 
-	go st.flush(fd, time.Minute)
+	go st.expireLoop(st.expiryInterval)
 
 	return st, nil
 }
 
 func (st *ImprovedStorage) Create(entry Entry) error {
-	if _, ok := st.cc.get(entry.Key); ok {
+	sh := st.cc.shard(entry.Key)
+	sh.Lock()
+	defer sh.Unlock()
+
+	// expired entries are overwritten
+	if _, ok := sh.live(entry.Key); ok {
 		return ErrKeyAlreadyExists
 	}
+	entry.Value.Version = st.versions.next()
 
-	st.cc.put(entry)
-	return nil
+	return st.put(sh, entry)
 }
 
 func (st *ImprovedStorage) Read(key Key) (Entry, error) {
-	val, ok := st.cc.get(key)
+	sh := st.cc.shard(key)
+
+	val, ok := sh.get(key)
 	if !ok {
 		return Entry{}, ErrKeyNotFound
 	}
 
+	if val.Value.expired(time.Now()) {
+		// lazily removing the entry under the write lock
+		sh.Lock()
+		sh.live(key)
+		sh.Unlock()
+
+		return Entry{}, ErrKeyNotFound
+	}
+
 	return val, nil
 }
 
 func (st *ImprovedStorage) Update(entry Entry) error {
-	if _, ok := st.cc.get(entry.Key); !ok {
+	sh := st.cc.shard(entry.Key)
+	sh.Lock()
+	defer sh.Unlock()
+
+	cur, ok := sh.live(entry.Key)
+	if !ok {
 		return ErrKeyNotFound
 	}
 
-	st.cc.put(entry)
-	return nil
+	// current ttl is kept, unless a new one is provided
+	if entry.Value.ExpiresAt.IsZero() {
+		entry.Value.ExpiresAt = cur.ExpiresAt
+	}
+	entry.Value.Version = st.versions.next()
+
+	return st.put(sh, entry)
 }
 
 func (st *ImprovedStorage) Delete(key Key) error {
-	if _, ok := st.cc.get(key); !ok {
+	sh := st.cc.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+
+	if _, ok := sh.live(key); !ok {
 		return ErrKeyNotFound
 	}
 
-	st.cc.del(key)
-	return nil
+	return st.del(sh, key)
 }
 
-func (st *ImprovedStorage) flush(fd *os.File, to time.Duration) {
-	for {
-		time.Sleep(to)
+// logs and removes the entry
+// write lock of the shard should be held by the caller
+func (st *ImprovedStorage) del(sh *shard, key Key) error {
+	if err := st.append(walRecord{Op: walDel, Key: key}); err != nil {
+		return err
+	}
 
-		data, err := json.Marshal(st.cc.data)
-		if err != nil {
-			log.Println("json.Marshal:", err)
-			return
-		}
+	sh.remove(key)
+	st.feed.del(key)
 
-		if _, err := fd.Write(data); err != nil {
-			log.Println("fd.Write:", err)
-		}
+	return nil
+}
+
+// flushes pending log records and releases the files
+func (st *ImprovedStorage) Close() error {
+	close(st.done)
+
+	if st.log == nil {
+		return nil
 	}
+
+	// waiting for a running compaction
+	st.compaction.mu.Lock()
+	defer st.compaction.mu.Unlock()
+
+	return st.log.close()
 }
 
-// restores storage state from disk
-func (st *ImprovedStorage) restore(fd *os.File) error {
-	stat, err := fd.Stat()
-	if err != nil {
-		return fmt.Errorf("fd.Stat: %v", err)
+// appends the record to the log, if the storage is persistent
+func (st *ImprovedStorage) append(rec walRecord) error {
+	if st.log == nil {
+		return nil
 	}
 
-	buf := make([]byte, stat.Size())
-	if _, err := fd.Read(buf); err != nil {
-		return fmt.Errorf("fd.Read: %v", err)
+	return st.log.append(rec)
+}
+
+// logs the entry and only then stores it in cache
+// entries are evicted beforehand if the memory limit is reached
+// shard lock should be held by the caller
+func (st *ImprovedStorage) put(sh *shard, entry Entry) error {
+	size := entrySize(entry.Key, entry.Value)
+
+	// evictions are logged as well, so that evicted entries don't come back on restore
+	if err := st.cc.reserve(sh, entry.Key, size, st.evict); err != nil {
+		return err
 	}
 
-	if err := json.Unmarshal(buf, &st.cc.data); err != nil {
-		return fmt.Errorf("json.Unmarshall: %v", err)
+	if err := st.append(walRecord{Op: walPut, Key: entry.Key, Value: &entry.Value}); err != nil {
+		return err
 	}
 
+	sh.set(entry.Key, entry.Value)
+	st.feed.put(entry.Key, entry.Value)
+
 	return nil
 }
 
-// in-mem storage
-type store map[Key]Value
+// logs eviction of the entry, which is then removed by the shard
+// shard lock should be held by the caller
+func (st *ImprovedStorage) evict(victim Key) error {
+	if err := st.append(walRecord{Op: walDel, Key: victim}); err != nil {
+		return err
+	}
 
-// in-mem storage
-type cache struct {
-	sync.RWMutex
-	data store
-}
+	st.feed.evict(victim)
 
-func (cc *cache) put(entry Entry) {
-	cc.Lock()
-	cc.data[entry.Key] = entry.Value
-	cc.Unlock()
+	return nil
 }
 
-func (cc *cache) get(key Key) (Entry, bool) {
-	cc.RLock()
-	val, ok := cc.data[key]
-	cc.RUnlock()
+// restores storage state from disk:
+// loads the newest valid snapshot and replays the log on top of it
+func (st *ImprovedStorage) restore(filepath string) error {
+	snap, err := st.snap.latest()
+	if err != nil && !errors.Is(err, ErrNothingToRestore) {
+		return fmt.Errorf("snapshotter.latest: %v", err)
+	}
 
-	return Entry{
-		Key:   key,
-		Value: val,
-	}, ok
-}
+	data := make(store)
 
-func (cc *cache) del(key Key) {
-	cc.Lock()
-	delete(cc.data, key)
-	cc.Unlock()
+	if err == nil {
+		if err := json.Unmarshal(snap.Data, &data); err != nil {
+			return fmt.Errorf("json.Unmarshall: %v", err)
+		}
+		st.generation = snap.Generation
+	}
+
+	// replaying mutations, which happened after the snapshot
+	wl, err := openWAL(filepath, snap.WALSegment, data.apply, st.syncPolicy, st.syncInterval, st.errLog)
+	if err != nil {
+		return fmt.Errorf("openWAL: %v", err)
+	}
+	wl.threshold = st.compactionThreshold
+	st.log = wl
+
+	data.expire(time.Now())
+	st.cc.load(data)
+
+	for k, v := range data {
+		st.feed.track(k, v.ExpiresAt)
+		st.versions.observe(v.Version)
+	}
+
+	return nil
 }
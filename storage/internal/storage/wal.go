@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defines how often the write-ahead log is fsynced
+type SyncPolicy int
+
+const (
+	// fsync after every appended record
+	SyncAlways SyncPolicy = iota
+	// fsync in the background every sync interval
+	SyncInterval
+	// never fsync explicitly - leave it to the OS
+	SyncNever
+)
+
+type walOp string
+
+const (
+	walPut walOp = "put"
+	walDel walOp = "del"
+	// several mutations, applied atomically
+	walTxn walOp = "txn"
+	// change of a few elements of a collection
+	walColl walOp = "coll"
+)
+
+// single mutation, written to the log
+type walRecord struct {
+	Op    walOp  `json:"op"`
+	Key   Key    `json:"key,omitempty"`
+	Value *Value `json:"value,omitempty"`
+	// mutations of a transaction
+	// they share a single line, so a torn write drops all of them
+	Ops []walRecord `json:"ops,omitempty"`
+	// change of a collection
+	Coll *collOp `json:"coll,omitempty"`
+}
+
+// append-only write-ahead log
+// each mutation gets appended here before it is acknowledged
+//
+// the log is split into segments <base>.wal.<seq>,
+// records are always appended to the last one
+type wal struct {
+	mu   sync.Mutex
+	base string
+	// current segment
+	seq  uint64
+	fd   *os.File
+	size int64
+
+	policy SyncPolicy
+	// true if some records were written since the last fsync
+	dirty bool
+	// set once a failed record couldn't be cut off, so the log refuses further appends
+	broken bool
+
+	// segment size, after which compaction is requested
+	threshold int64
+	// compaction requests
+	full chan struct{}
+
+	done   chan struct{}
+	errLog *logrus.Logger
+}
+
+// opens the log and replays every segment, written after the provided one
+// segments up to and including "after" are already included into the snapshot
+func openWAL(base string, after uint64, apply func(rec walRecord), policy SyncPolicy, interval time.Duration, errLog *logrus.Logger) (*wal, error) {
+	w := &wal{
+		base:   base,
+		seq:    after + 1,
+		policy: policy,
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		errLog: errLog,
+	}
+
+	segs, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seq := range segs {
+		if seq <= after {
+			continue
+		}
+
+		if err := w.replaySegment(seq, apply, nil); err != nil {
+			return nil, err
+		}
+		w.seq = seq
+	}
+
+	if err := w.openSegment(w.seq); err != nil {
+		return nil, err
+	}
+
+	if policy == SyncInterval {
+		go w.syncLoop(interval)
+	}
+
+	return w, nil
+}
+
+// appends a single record to the end of the log
+func (w *wal) append(rec walRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return ErrJSONMarshall
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.broken {
+		return ErrFileWrite
+	}
+
+	prev := w.size
+	if _, err := w.fd.Write(line); err != nil {
+		w.logErr(fmt.Errorf("fd.Write: %v", err))
+		w.rollback(prev)
+		return ErrFileWrite
+	}
+	w.size += int64(len(line))
+
+	if w.policy == SyncAlways {
+		if err := w.fd.Sync(); err != nil {
+			w.logErr(fmt.Errorf("fd.Sync: %v", err))
+			w.rollback(prev)
+			return ErrFileWrite
+		}
+	} else {
+		w.dirty = true
+	}
+
+	if w.threshold > 0 && w.size >= w.threshold {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// cuts off a failed record, so that the next one is not glued to its fragment
+// and the record, which was reported as failed, doesn't come back on restore
+// if the segment can't be truncated, every further append fails
+// wal lock should be held by the caller
+func (w *wal) rollback(size int64) {
+	if err := w.fd.Truncate(size); err != nil {
+		w.logErr(fmt.Errorf("fd.Truncate: %v", err))
+		w.broken = true
+		return
+	}
+
+	w.size = size
+}
+
+// seals the current segment and starts a new one
+// returns the sequence number of the sealed segment
+func (w *wal) rotate() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.fd.Sync(); err != nil {
+		return 0, fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	sealed, old := w.seq, w.fd
+
+	if err := w.openSegment(w.seq + 1); err != nil {
+		return 0, err
+	}
+
+	if err := old.Close(); err != nil {
+		w.logErr(fmt.Errorf("fd.Close: %v", err))
+	}
+
+	return sealed, nil
+}
+
+// returns true if nothing was written to the current segment
+func (w *wal) empty() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.size == 0
+}
+
+// removes sealed segments up to and including the provided one
+func (w *wal) remove(upTo uint64) error {
+	segs, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range segs {
+		if seq > upTo {
+			break
+		}
+		if err := os.Remove(w.path(seq)); err != nil {
+			return fmt.Errorf("os.Remove: %v", err)
+		}
+	}
+
+	return syncDir(filepath.Dir(w.base))
+}
+
+// reads every record of a segment
+// a torn or corrupted tail (e.g. after a crash mid-write) is truncated
+// if provided, progress is increased by the amount of bytes read
+func (w *wal) replaySegment(seq uint64, apply func(rec walRecord), progress *atomic.Int64) error {
+	fd, err := os.OpenFile(w.path(seq), os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+	defer fd.Close()
+
+	var (
+		rd     = bufio.NewReader(fd)
+		offset int64
+	)
+
+	for {
+		line, err := rd.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// partial line without a newline - the write never completed
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("rd.ReadBytes: %v", err)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			w.logErr(fmt.Errorf("corrupted log record in %v at offset %v: %v", w.path(seq), offset, err))
+			break
+		}
+
+		apply(rec)
+		offset += int64(len(line))
+
+		if progress != nil {
+			progress.Add(int64(len(line)))
+		}
+	}
+
+	// cutting off everything after the last valid record
+	stat, err := fd.Stat()
+	if err != nil {
+		return fmt.Errorf("fd.Stat: %v", err)
+	}
+
+	if stat.Size() > offset {
+		if err := fd.Truncate(offset); err != nil {
+			return fmt.Errorf("fd.Truncate: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// lists segments, present on disk, in ascending order
+func (w *wal) segments() ([]uint64, error) {
+	paths, err := filepath.Glob(w.base + ".wal.*")
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob: %v", err)
+	}
+
+	segs := []uint64{}
+	for _, path := range paths {
+		seq, err := strconv.ParseUint(strings.TrimPrefix(path, w.base+".wal."), 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, seq)
+	}
+
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+
+	return segs, nil
+}
+
+// sums up sizes of the provided segments
+func (w *wal) sizeOf(segs []uint64) int64 {
+	var total int64
+	for _, seq := range segs {
+		if stat, err := os.Stat(w.path(seq)); err == nil {
+			total += stat.Size()
+		}
+	}
+
+	return total
+}
+
+// opens a segment for appending
+// wal lock should be held by the caller
+func (w *wal) openSegment(seq uint64) error {
+	fd, err := os.OpenFile(w.path(seq), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+
+	stat, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("fd.Stat: %v", err)
+	}
+
+	w.seq = seq
+	w.fd = fd
+	w.size = stat.Size()
+	w.dirty = false
+
+	return nil
+}
+
+func (w *wal) path(seq uint64) string {
+	return fmt.Sprintf("%v.wal.%020d", w.base, seq)
+}
+
+// periodically fsyncs the log if it has unsynced records
+func (w *wal) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty {
+				if err := w.fd.Sync(); err != nil {
+					w.logErr(fmt.Errorf("fd.Sync: %v", err))
+				} else {
+					w.dirty = false
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// flushes pending records and closes the log
+func (w *wal) close() error {
+	close(w.done)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.fd.Sync(); err != nil {
+		return fmt.Errorf("fd.Sync: %v", err)
+	}
+
+	return w.fd.Close()
+}
+
+func (w *wal) logErr(err error) {
+	w.errLog.WithFields(
+		logrus.Fields{
+			"time":  time.Now(),
+			"error": err.Error(),
+		},
+	).Error()
+}
@@ -0,0 +1,195 @@
+package storage_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// storage, which may be closed by the test before its cleanup
+type testStorage struct {
+	*storage.ImprovedStorage
+	once sync.Once
+}
+
+func (st *testStorage) Close() (err error) {
+	st.once.Do(func() { err = st.ImprovedStorage.Close() })
+	return err
+}
+
+// opens the storage at the path, so that it's closed once the test is over
+// background snapshots are left to the test itself
+func openImproved(t *testing.T, path string, opts ...storage.Option) *testStorage {
+	t.Helper()
+
+	errLog := logrus.New()
+	errLog.SetOutput(io.Discard)
+
+	opts = append([]storage.Option{storage.WithSyncPolicy(storage.SyncAlways), storage.WithSnapshotInterval(time.Hour)}, opts...)
+
+	improved, err := storage.NewImprovedStorage(path, errLog, opts...)
+	if err != nil {
+		t.Fatalf("NewImprovedStorage: %v", err)
+	}
+
+	st := &testStorage{ImprovedStorage: improved}
+	t.Cleanup(func() { st.Close() })
+
+	return st
+}
+
+// reopens the storage, as if it was restarted
+func reopen(t *testing.T, st *testStorage, path string, opts ...storage.Option) *testStorage {
+	t.Helper()
+
+	if err := st.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	return openImproved(t, path, opts...)
+}
+
+func put(t *testing.T, st storage.Storage, key, data string) {
+	t.Helper()
+
+	if err := st.Update(storage.EntryFromData(key, data, time.Now(), time.Time{})); errors.Is(err, storage.ErrKeyNotFound) {
+		err = st.Create(storage.EntryFromData(key, data, time.Now(), time.Time{}))
+		if err != nil {
+			t.Fatalf("Create(%v): %v", key, err)
+		}
+	} else if err != nil {
+		t.Fatalf("Update(%v): %v", key, err)
+	}
+}
+
+func expect(t *testing.T, st storage.Storage, key, data string) {
+	t.Helper()
+
+	entry, err := st.Read(storage.Key(key))
+	if err != nil {
+		t.Fatalf("Read(%v): %v", key, err)
+	}
+	if entry.Value.Data != data {
+		t.Fatalf("Read(%v) = %q, want %q", key, entry.Value.Data, data)
+	}
+}
+
+func expectMissing(t *testing.T, st storage.Storage, key string) {
+	t.Helper()
+
+	if _, err := st.Read(storage.Key(key)); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("Read(%v): got %v, want %v", key, err, storage.ErrKeyNotFound)
+	}
+}
+
+// returns paths of the log segments in ascending order
+func segments(t *testing.T, path string) []string {
+	t.Helper()
+
+	segs, err := filepath.Glob(path + ".wal.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return segs
+}
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	put(t, st, "a", "1")
+	put(t, st, "b", "2")
+	put(t, st, "a", "3")
+	if err := st.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Create(storage.EntryFromData("c", "4", time.Now(), time.Now().Add(-time.Second))); err != nil {
+		t.Fatal(err)
+	}
+
+	st = reopen(t, st, path)
+
+	expect(t, st, "a", "3")
+	expectMissing(t, st, "b")
+	// expired entries are not restored
+	expectMissing(t, st, "c")
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	put(t, st, "a", "1")
+	put(t, st, "b", "2")
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := segments(t, path)
+	last := segs[len(segs)-1]
+
+	stat, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// crash in the middle of a write
+	fd, err := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString(`{"op":"put","key":"c","value":{"da`)
+	fd.Close()
+
+	st = openImproved(t, path)
+
+	expect(t, st, "a", "1")
+	expect(t, st, "b", "2")
+	expectMissing(t, st, "c")
+
+	if truncated, err := os.Stat(last); err != nil || truncated.Size() != stat.Size() {
+		t.Fatalf("torn tail is not truncated: size %v, want %v (%v)", truncated.Size(), stat.Size(), err)
+	}
+
+	// records, written after the truncation, are not glued to the torn one
+	put(t, st, "d", "3")
+	st = reopen(t, st, path)
+
+	expect(t, st, "b", "2")
+	expect(t, st, "d", "3")
+}
+
+func TestWALCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	st := openImproved(t, path)
+
+	put(t, st, "a", "1")
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := segments(t, path)
+
+	// complete line, which is not a record - everything after it is dropped
+	fd, err := os.OpenFile(segs[len(segs)-1], os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString("garbage\n" + `{"op":"put","key":"b","value":{"data":"2","type":"string"}}` + "\n")
+	fd.Close()
+
+	st = openImproved(t, path)
+
+	expect(t, st, "a", "1")
+	expectMissing(t, st, "b")
+}
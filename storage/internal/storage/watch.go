@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// amount of recent events, kept to resume watches
+	feedHistory = 10000
+	// amount of events, buffered for a watcher, before it is considered lagging
+	watchBuffer = 256
+	// how often expirations of written entries are checked
+	feedExpiryInterval = 100 * time.Millisecond
+	// max amount of expirations, reported at once under the lock
+	feedExpiryBatch = 1000
+)
+
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+	EventExpire EventType = "expire"
+	// entry was removed to free memory
+	EventEvict EventType = "evict"
+)
+
+// change of a single key
+type Event struct {
+	Revision uint64    `json:"revision"`
+	Type     EventType `json:"type"`
+	Key      Key       `json:"key"`
+	// written value, only for put events
+	// element-wise changes of collections, kept natively by the in-mem engine, come without Data
+	Value *Value    `json:"value,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// ordered stream of changes of a storage
+// every event gets the next revision, while recent events are kept in memory,
+// so that a watch can be resumed from the revision it has stopped at
+//
+// engines report puts, deletes and evictions under their own locks,
+// so events of a key are ordered the same way as the writes
+// expirations are tracked by the feed itself, since most engines remove expired entries lazily:
+// entries, written since the feed was created, and entries, restored by engines, are tracked
+//
+// history is not preserved between restarts, though revisions keep growing,
+// as they start from the current unix time in microseconds
+type Feed struct {
+	mu  sync.Mutex
+	rev uint64
+	// recent events, ordered by revision
+	history []Event
+	// keys with ttl, ordered by expiration time
+	ttl      *expiryIndex
+	watchers map[*Watcher]struct{}
+	// receives every event, called under the lock
+	notify func(Event)
+
+	closed bool
+	done   chan struct{}
+}
+
+func NewFeed() *Feed {
+	f := &Feed{
+		rev:      uint64(time.Now().UnixMicro()),
+		ttl:      newExpiryIndex(),
+		watchers: make(map[*Watcher]struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go f.expireLoop(feedExpiryInterval)
+
+	return f
+}
+
+// subscribes to changes of the key or, if prefix is set, of every key with such prefix
+// events are delivered starting with fromRevision, zero one means only new events
+// fails with ErrRevisionUnavailable if some of the requested events are out of the history
+func (f *Feed) Watch(key Key, prefix bool, fromRevision uint64) (*Watcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, ErrFeedClosed
+	}
+
+	w := &Watcher{feed: f, key: key, prefix: prefix, start: f.rev}
+
+	var replay []Event
+	if fromRevision != 0 {
+		if fromRevision > f.rev+1 || fromRevision <= f.rev && (len(f.history) == 0 || f.history[0].Revision > fromRevision) {
+			return nil, ErrRevisionUnavailable
+		}
+		w.start = fromRevision - 1
+
+		for _, ev := range f.history {
+			if ev.Revision >= fromRevision && w.matches(ev.Key) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	// replayed events don't count against the buffer
+	w.events = make(chan Event, len(replay)+watchBuffer)
+	for _, ev := range replay {
+		w.events <- ev
+	}
+
+	f.watchers[w] = struct{}{}
+
+	return w, nil
+}
+
+// returns the revision of the latest event
+func (f *Feed) Revision() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rev
+}
+
+// ends every watch and stops tracking expirations
+func (f *Feed) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+	close(f.done)
+
+	for w := range f.watchers {
+		f.stop(w, ErrFeedClosed)
+	}
+
+	return nil
+}
+
+// reports the written value
+// feed may be nil, so that engines don't have to check for it
+func (f *Feed) put(key Key, val Value) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+
+	// previous value has expired, but the feed hasn't noticed yet
+	if item, ok := f.ttl.items[key]; ok && !item.at.After(now) {
+		f.publish(Event{Type: EventExpire, Key: key, At: now})
+	}
+
+	f.publish(Event{Type: EventPut, Key: key, Value: &val, At: now})
+	f.ttl.set(key, val.ExpiresAt)
+}
+
+// sets the function, which receives every event
+// it is called under the feed lock, so it should never block
+func (f *Feed) Notify(fn func(Event)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.notify = fn
+}
+
+// reports the removed key
+// feed may be nil, so that engines don't have to check for it
+func (f *Feed) del(key Key) {
+	f.remove(key, EventDelete)
+}
+
+// reports the key, removed to free memory
+func (f *Feed) evict(key Key) {
+	f.remove(key, EventEvict)
+}
+
+func (f *Feed) remove(key Key, typ EventType) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.publish(Event{Type: typ, Key: key, At: time.Now()})
+	f.ttl.remove(key)
+}
+
+// starts tracking expiration of the restored entry, without reporting it
+// entries, which have already expired, are skipped
+func (f *Feed) track(key Key, expiresAt time.Time) {
+	if f == nil || !expiresAt.After(time.Now()) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ttl.set(key, expiresAt)
+}
+
+func (f *Feed) expireLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			// in batches, so that writers of every engine don't wait for a mass expiry to be reported,
+			// the rest is left for the next tick once the deadline passes
+			deadline := time.Now().Add(interval / 4)
+			for time.Now().Before(deadline) {
+				if f.expireDue(time.Now(), feedExpiryBatch) < feedExpiryBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// reports up to limit due expirations
+// returns the amount of reported ones
+func (f *Feed) expireDue(now time.Time, limit int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	due := f.ttl.due(now, limit)
+	for _, key := range due {
+		f.publish(Event{Type: EventExpire, Key: key, At: now})
+	}
+
+	return len(due)
+}
+
+// assigns the next revision to the event and hands it to the watchers
+// watchers, which don't keep up, are stopped, so that writes never wait for them
+// lock should be held by the caller
+func (f *Feed) publish(ev Event) {
+	f.rev++
+	ev.Revision = f.rev
+
+	// trimming the history once it doubles, so that it's not copied on every event
+	if len(f.history) >= 2*feedHistory {
+		n := copy(f.history, f.history[len(f.history)-feedHistory:])
+		f.history = f.history[:n]
+	}
+	f.history = append(f.history, ev)
+
+	if f.notify != nil {
+		f.notify(ev)
+	}
+
+	for w := range f.watchers {
+		if !w.matches(ev.Key) {
+			continue
+		}
+
+		select {
+		case w.events <- ev:
+		default:
+			f.stop(w, ErrWatcherLagging)
+		}
+	}
+}
+
+// lock should be held by the caller
+func (f *Feed) stop(w *Watcher, err error) {
+	if _, ok := f.watchers[w]; !ok {
+		return
+	}
+
+	delete(f.watchers, w)
+	w.err = err
+	close(w.events)
+}
+
+// subscription to changes of a key or a prefix
+type Watcher struct {
+	feed   *Feed
+	key    Key
+	prefix bool
+	// revision, after which events are delivered
+	start uint64
+
+	events chan Event
+	// reason the watch is over, guarded by the feed lock
+	err error
+}
+
+// returns events of the watched keys
+// channel is closed once the watch is over, see Err
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// returns the revision, after which events are delivered
+// resuming the watch from the next one doesn't miss any events
+func (w *Watcher) Start() uint64 {
+	return w.start
+}
+
+// returns the reason the watch is over:
+// ErrWatcherLagging, ErrFeedClosed or nil if the watch was stopped or is still going
+func (w *Watcher) Err() error {
+	w.feed.mu.Lock()
+	defer w.feed.mu.Unlock()
+
+	return w.err
+}
+
+// ends the watch
+func (w *Watcher) Stop() {
+	w.feed.mu.Lock()
+	defer w.feed.mu.Unlock()
+
+	w.feed.stop(w, nil)
+}
+
+func (w *Watcher) matches(key Key) bool {
+	if w.prefix {
+		return strings.HasPrefix(string(key), string(w.key))
+	}
+
+	return key == w.key
+}
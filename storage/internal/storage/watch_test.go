@@ -0,0 +1,45 @@
+package storage_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/key-value-storage/storage/internal/storage"
+)
+
+// mass expiry is reported in batches, every expired key gets its event
+func TestFeedMassExpiry(t *testing.T) {
+	const keys = 5000
+
+	feed := storage.NewFeed()
+	defer feed.Close()
+
+	st := openImproved(t, "", storage.WithFeed(feed))
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	for i := range keys {
+		if err := st.Create(storage.EntryFromData(strconv.Itoa(i), "v", time.Now(), expiresAt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := feed.Revision()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for feed.Revision()-start < keys {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v expirations reported, want %v", feed.Revision()-start, keys)
+		}
+
+		// writes are not blocked for the whole expiry
+		if err := st.Create(storage.EntryFromData("other", "v", time.Now(), time.Time{})); err == nil {
+			if err := st.Delete("other"); err != nil {
+				t.Fatal(err)
+			}
+			start += 2
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
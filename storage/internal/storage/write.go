@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// storage, which writes entries along with their exact ttl
+// unlike Update, zero ExpiresAt means that the entry never expires, instead of keeping the current ttl
+type Writer interface {
+	// writes the entry according to the options
+	Put(entry Entry, opts PutOptions) error
+	// sets the ttl of the entry, keeping its value, zero expiresAt removes the ttl
+	// returns false if the entry already has such ttl
+	SetTTL(key Key, expiresAt time.Time) (bool, error)
+}
+
+type PutOptions struct {
+	// fails with ErrKeyAlreadyExists if the entry exists
+	OnlyNew bool
+	// fails with ErrKeyNotFound if the entry doesn't exist
+	OnlyExisting bool
+	// keeps the ttl of the current entry instead of the provided one
+	// created entry doesn't expire
+	KeepTTL bool
+	// if set, the entry is written only if its current version matches, fails with ErrVersionMismatch otherwise
+	Version uint64
+}
+
+func put(m modifier, entry Entry, opts PutOptions) error {
+	_, err := m.modify(entry.Key, func(cur Value, exists bool) (Value, error) {
+		if opts.OnlyNew && exists {
+			return Value{}, ErrKeyAlreadyExists
+		}
+		if opts.OnlyExisting && !exists {
+			return Value{}, ErrKeyNotFound
+		}
+		if opts.Version != 0 && (!exists || cur.Version != opts.Version) {
+			return Value{}, ErrVersionMismatch
+		}
+
+		val := entry.Value
+		if opts.KeepTTL {
+			val.ExpiresAt = cur.ExpiresAt
+		}
+
+		return val, nil
+	})
+
+	return err
+}
+
+func setTTL(m modifier, key Key, expiresAt time.Time) (bool, error) {
+	_, err := m.modify(key, func(cur Value, exists bool) (Value, error) {
+		if !exists {
+			return Value{}, ErrKeyNotFound
+		}
+		if cur.ExpiresAt.Equal(expiresAt) {
+			return Value{}, errUnchanged
+		}
+
+		cur.ExpiresAt = expiresAt
+		return cur, nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (st *ImprovedStorage) Put(entry Entry, opts PutOptions) error {
+	return put(st, entry, opts)
+}
+
+// native collections change ttl in place, instead of being encoded and logged as a whole
+func (st *ImprovedStorage) SetTTL(key Key, expiresAt time.Time) (bool, error) {
+	sh := st.cc.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+
+	cur, ok := sh.live(key)
+	if !ok {
+		return false, ErrKeyNotFound
+	}
+	if cur.ExpiresAt.Equal(expiresAt) {
+		return false, nil
+	}
+
+	if cur.coll != nil {
+		return true, st.expireNative(sh, key, cur, expiresAt)
+	}
+
+	cur.ExpiresAt = expiresAt
+	cur.Version = st.versions.next()
+
+	return true, st.put(sh, Entry{Key: key, Value: cur})
+}
+
+func (ls *LocalStorage) Put(entry Entry, opts PutOptions) error {
+	return put(ls, entry, opts)
+}
+
+func (ls *LocalStorage) SetTTL(key Key, expiresAt time.Time) (bool, error) {
+	return setTTL(ls, key, expiresAt)
+}
+
+func (bc *BitcaskStorage) Put(entry Entry, opts PutOptions) error {
+	return put(bc, entry, opts)
+}
+
+func (bc *BitcaskStorage) SetTTL(key Key, expiresAt time.Time) (bool, error) {
+	return setTTL(bc, key, expiresAt)
+}
+
+func (st *LSMStorage) Put(entry Entry, opts PutOptions) error {
+	return put(st, entry, opts)
+}
+
+func (st *LSMStorage) SetTTL(key Key, expiresAt time.Time) (bool, error) {
+	return setTTL(st, key, expiresAt)
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"math"
+	"time"
+)
+
+// member of a sorted set along with its score
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// members are ordered by score, members with equal scores are ordered lexicographically
+// sorted sets are encoded as JSON arrays in that order
+func (a ZMember) less(b ZMember) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+
+	return a.Member < b.Member
+}
+
+// adds members to the sorted set or updates their scores
+// returns the amount of members, which weren't in the set before
+func (c *Collections) ZAdd(key Key, members []ZMember, expiresAt time.Time) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) || math.IsInf(m.Score, 0) {
+			return 0, ErrNotFloat
+		}
+	}
+
+	var added int
+
+	err := c.modify(key, TypeZSet, expiresAt, func(coll nativeColl, _ bool) (*collOp, error) {
+		zs := coll.(*nativeZSet)
+
+		// only members, which scores change, are logged, the last score of a member wins
+		last := make(map[string]int, len(members))
+		for i, m := range members {
+			last[m.Member] = i
+		}
+
+		changed := []ZMember{}
+		for i, m := range members {
+			if last[m.Member] != i {
+				continue
+			}
+
+			score, ok := zs.score(m.Member)
+			if !ok {
+				added++
+			}
+			if !ok || score != m.Score {
+				changed = append(changed, m)
+			}
+		}
+
+		if len(changed) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collZAdd, Members: changed}, nil
+	})
+
+	return added, err
+}
+
+// removes members from the sorted set
+// returns the amount of members, which were actually removed
+func (c *Collections) ZRem(key Key, members []string) (int, error) {
+	var removed []string
+
+	err := c.modify(key, TypeZSet, time.Time{}, func(coll nativeColl, _ bool) (*collOp, error) {
+		zs := coll.(*nativeZSet)
+
+		seen := make(map[string]bool, len(members))
+		for _, member := range members {
+			if _, ok := zs.score(member); ok && !seen[member] {
+				seen[member] = true
+				removed = append(removed, member)
+			}
+		}
+
+		if len(removed) == 0 {
+			return nil, nil
+		}
+
+		return &collOp{Kind: collZRem, Values: removed}, nil
+	})
+
+	return len(removed), err
+}
+
+func (c *Collections) ZScore(key Key, member string) (float64, error) {
+	var (
+		score float64
+		ok    bool
+	)
+
+	err := c.read(key, TypeZSet, func(coll nativeColl) {
+		score, ok = coll.(*nativeZSet).score(member)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		return 0, ErrMemberNotFound
+	}
+
+	return score, nil
+}
+
+// returns position of the member in ascending order of scores,
+// or in descending order if reverse is set
+func (c *Collections) ZRank(key Key, member string, reverse bool) (int, error) {
+	var (
+		rank int
+		ok   bool
+	)
+
+	err := c.read(key, TypeZSet, func(coll nativeColl) {
+		rank, ok = coll.(*nativeZSet).rank(member)
+		if reverse {
+			rank = coll.len() - 1 - rank
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		return 0, ErrMemberNotFound
+	}
+
+	return rank, nil
+}
+
+// returns the amount of members in the sorted set
+func (c *Collections) ZCard(key Key) (int, error) {
+	var n int
+
+	err := c.read(key, TypeZSet, func(coll nativeColl) {
+		n = coll.len()
+	})
+
+	return n, err
+}
+
+// returns members with ranks between start and stop, both inclusive
+// negative ranks count from the end, -1 being the last member
+func (c *Collections) ZRange(key Key, start, stop int, reverse bool) ([]ZMember, error) {
+	var members []ZMember
+
+	err := c.read(key, TypeZSet, func(coll nativeColl) {
+		n := coll.len()
+		lo, hi := rangeBounds(n, start, stop)
+
+		// ranks of the reversed order are mirrored
+		if reverse {
+			lo, hi = n-hi, n-lo
+		}
+
+		members = coll.(*nativeZSet).slice(lo, hi, reverse)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// returns up to limit members with scores between min and max, both inclusive
+// members are returned in ascending order, or in descending one if reverse is set
+// zero limit means no limit
+func (c *Collections) ZRangeByScore(key Key, min, max float64, reverse bool, limit int) ([]ZMember, error) {
+	var members []ZMember
+
+	err := c.read(key, TypeZSet, func(coll nativeColl) {
+		zs := coll.(*nativeZSet)
+
+		lo, hi := zs.scoreBounds(min, max)
+		if limit > 0 && hi-lo > limit {
+			if reverse {
+				lo = hi - limit
+			} else {
+				hi = lo + limit
+			}
+		}
+
+		members = zs.slice(lo, hi, reverse)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
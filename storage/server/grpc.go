@@ -0,0 +1,69 @@
+package server
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// service, served over gRPC
+type GRPCService interface {
+	// registers handlers of the service
+	Register(registrar grpc.ServiceRegistrar)
+	// ends long-running calls (e.g. streams), so that the shutdown doesn't wait for them
+	Close()
+}
+
+// gRPC listener, running alongside the http server
+type GRPCServer struct {
+	addr     string
+	service  GRPCService
+	grpcServ *grpc.Server
+}
+
+func NewGRPC(addr string, service GRPCService) *GRPCServer {
+	grpcServ := grpc.NewServer()
+	service.Register(grpcServ)
+
+	return &GRPCServer{
+		addr:     addr,
+		service:  service,
+		grpcServ: grpcServ,
+	}
+}
+
+func (s *GRPCServer) Serve() {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatal("grpc server error: ", err)
+	}
+
+	// returns once the server is stopped
+	if err := s.grpcServ.Serve(listener); err != nil {
+		log.Println("grpc server error:", err)
+	}
+}
+
+// graceful shutdown
+// waits for running calls to finish, but no longer than defaultShutdownTimeout
+func (s *GRPCServer) Close() error {
+	log.Println("grpc server shutdown")
+
+	s.service.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServ.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(defaultShutdownTimeout):
+		s.grpcServ.Stop()
+	}
+
+	return nil
+}
@@ -13,6 +13,13 @@ func WithShutdownTimeout(timeout time.Duration) Option {
 	}
 }
 
+// registers a function, called once the shutdown starts
+func WithOnShutdown(fn func()) Option {
+	return func(s *Server) {
+		s.httpServ.RegisterOnShutdown(fn)
+	}
+}
+
 func WithAddr(addr string) Option {
 	return func(s *Server) {
 		s.httpServ.Addr = addr
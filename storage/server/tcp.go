@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// serves connections of a TCP protocol
+type ConnHandler interface {
+	// returns once the connection is closed or should be closed
+	ServeConn(conn net.Conn)
+}
+
+// listener of a TCP protocol, running alongside the http server
+type TCPServer struct {
+	name    string
+	addr    string
+	handler ConnHandler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	// running connection handlers
+	wg sync.WaitGroup
+}
+
+// name of the protocol is used in logs
+func NewTCP(name, addr string, handler ConnHandler) *TCPServer {
+	return &TCPServer{
+		name:    name,
+		addr:    addr,
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// accepts connections, until the server is closed
+func (s *TCPServer) Serve() {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Fatalf("%v server error: %v", s.name, err)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// e.g. too many open files, so waiting for some of them to be closed
+			log.Printf("%v server accept error: %v", s.name, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			s.handler.ServeConn(conn)
+		}()
+	}
+}
+
+func (s *TCPServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return true
+}
+
+func (s *TCPServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	conn.Close()
+	s.wg.Done()
+}
+
+// graceful shutdown
+// stops accepting connections and waits for running commands to finish
+func (s *TCPServer) Close() error {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	log.Printf("%v server shutdown", s.name)
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	// interrupting reads of idle connections, so that handlers return after the current command
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}